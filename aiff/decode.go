@@ -0,0 +1,376 @@
+package aiff
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// Decode takes a Reader containing audio data in AIFF or AIFF-C format and returns a
+// StreamSeekCloser, which streams that audio. If r can't seek, like a pipe or a network
+// connection, the Seek method only seeks forward by discarding the audio in between and returns
+// an error otherwise. If reading fails while discarding, Seek returns the error and the position
+// is left where the reading stopped.
+//
+// Besides big-endian integer PCM, the AIFF-C compression types "sowt" (little-endian integer
+// PCM), "fl32" and "fl64" (IEEE floats) are decoded. The COMM chunk may follow the SSND chunk
+// only if r can seek.
+//
+// Do not close the supplied Reader, instead, use the Close method of the returned
+// StreamSeekCloser when you want to release the resources.
+func Decode(r io.Reader) (s beep.StreamSeekCloser, format beep.Format, err error) {
+	d := decoder{r: r}
+	if seeker, ok := r.(io.Seeker); ok {
+		// Files like stdin may be pipes which can't seek.
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			d.seeker = seeker
+			d.start = start
+		}
+	}
+	defer func() { // hacky way to always close r if an error occurred
+		if closer, ok := d.r.(io.Closer); ok {
+			if err != nil {
+				closer.Close()
+			}
+		}
+	}()
+
+	var form struct {
+		ID   [4]byte
+		Size uint32
+		Type [4]byte
+	}
+	if err := binary.Read(r, binary.BigEndian, &form); err != nil {
+		return nil, beep.Format{}, errors.Wrap(err, "aiff: missing FORM header")
+	}
+	if string(form.ID[:]) != "FORM" {
+		return nil, beep.Format{}, fmt.Errorf("aiff: missing FORM at the beginning > %s", string(form.ID[:]))
+	}
+	var aifc bool
+	switch string(form.Type[:]) {
+	case "AIFF":
+	case "AIFC":
+		aifc = true
+	default:
+		return nil, beep.Format{}, errors.New("aiff: unsupported file type")
+	}
+
+	var (
+		comm     *commChunk
+		ssnd     bool
+		ssndSize int64 // size of the sound data
+		offset   = int64(12)
+		chunk    struct {
+			ID   [4]byte
+			Size uint32
+		}
+	)
+	for comm == nil || !ssnd {
+		if err := binary.Read(r, binary.BigEndian, &chunk); err != nil {
+			if err == io.EOF && comm == nil {
+				return nil, beep.Format{}, errors.New("aiff: missing COMM chunk")
+			}
+			if err == io.EOF {
+				return nil, beep.Format{}, errors.New("aiff: missing SSND chunk")
+			}
+			return nil, beep.Format{}, errors.Wrap(err, "aiff: missing chunk header")
+		}
+		id, size := string(chunk.ID[:]), int64(chunk.Size)
+		offset += 8
+		switch id {
+		case "COMM":
+			body := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return nil, beep.Format{}, errors.Wrap(err, "aiff: missing COMM chunk body")
+			}
+			comm, err = parseComm(body[:size], aifc)
+			if err != nil {
+				return nil, beep.Format{}, err
+			}
+			offset += int64(len(body))
+			if ssnd {
+				// The sound data came first.
+				if _, err := d.seeker.Seek(d.start+d.hsz, io.SeekStart); err != nil {
+					return nil, beep.Format{}, errors.Wrap(err, "aiff: seek error")
+				}
+			}
+		case "SSND":
+			var ssndHeader struct {
+				Offset    uint32 // offset of the sound data after the block size
+				BlockSize uint32
+			}
+			if err := binary.Read(r, binary.BigEndian, &ssndHeader); err != nil {
+				return nil, beep.Format{}, errors.Wrap(err, "aiff: missing SSND chunk header")
+			}
+			if size < 8+int64(ssndHeader.Offset) {
+				return nil, beep.Format{}, errors.New("aiff: invalid SSND chunk size")
+			}
+			if _, err := io.CopyN(io.Discard, r, int64(ssndHeader.Offset)); err != nil {
+				return nil, beep.Format{}, errors.Wrap(err, "aiff: missing SSND chunk body")
+			}
+			ssnd = true
+			ssndSize = size - 8 - int64(ssndHeader.Offset)
+			d.hsz = offset + 8 + int64(ssndHeader.Offset)
+			offset += size + size%2
+			if comm == nil {
+				if d.seeker == nil {
+					return nil, beep.Format{}, errors.New("aiff: COMM chunk after the SSND chunk, but the resource isn't io.Seeker")
+				}
+				if _, err := d.seeker.Seek(d.start+offset, io.SeekStart); err != nil {
+					return nil, beep.Format{}, errors.Wrap(err, "aiff: seek error")
+				}
+			}
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, beep.Format{}, errors.Wrapf(err, "aiff: missing %s chunk body", id)
+			}
+			offset += size + size%2
+		}
+	}
+
+	if comm.NumChans <= 0 {
+		return nil, beep.Format{}, errors.New("aiff: invalid number of channels (less than 1)")
+	}
+	d.numChans = int(comm.NumChans)
+	d.sampleSize = int(comm.SampleSize)
+	switch comm.compression {
+	case "NONE", "twos":
+	case "sowt":
+		d.littleEndian = true
+	case "fl32", "FL32":
+		d.float = true
+		d.sampleSize = 32
+	case "fl64", "FL64":
+		d.float = true
+		d.sampleSize = 64
+	default:
+		return nil, beep.Format{}, fmt.Errorf("aiff: unsupported compression type - %q", comm.compression)
+	}
+	if !d.float && (d.sampleSize < 1 || d.sampleSize > 32) {
+		return nil, beep.Format{}, errors.New("aiff: unsupported sample size, 1 to 32 bits are supported")
+	}
+	d.width = (d.sampleSize + 7) / 8
+	rate := math.Round(fromExtended(comm.SampleRate))
+	if !(rate >= 1 && rate <= math.MaxInt32) {
+		return nil, beep.Format{}, errors.New("aiff: invalid sample rate")
+	}
+
+	// The number of frames in the COMM chunk is authoritative, but the sound data may end early.
+	d.dataSize = min(int64(comm.NumFrames)*int64(d.frameWidth()), ssndSize)
+	d.dataSize -= d.dataSize % int64(d.frameWidth())
+
+	format = beep.Format{
+		SampleRate:  beep.SampleRate(rate),
+		NumChannels: d.numChans,
+		Precision:   d.width,
+	}
+	return &d, format, nil
+}
+
+// commChunk is the COMM chunk, which describes the format of the sound data.
+type commChunk struct {
+	NumChans   int16
+	NumFrames  uint32
+	SampleSize int16 // in bits
+	SampleRate [10]byte
+
+	compression string // of AIFF-C files, "NONE" for AIFF files
+}
+
+func parseComm(p []byte, aifc bool) (*commChunk, error) {
+	var c commChunk
+	if len(p) < 18 {
+		return nil, errors.New("aiff: invalid COMM chunk size")
+	}
+	c.NumChans = int16(binary.BigEndian.Uint16(p))
+	c.NumFrames = binary.BigEndian.Uint32(p[2:])
+	c.SampleSize = int16(binary.BigEndian.Uint16(p[6:]))
+	copy(c.SampleRate[:], p[8:18])
+	c.compression = "NONE"
+	if aifc {
+		if len(p) < 22 {
+			return nil, errors.New("aiff: missing compression type")
+		}
+		c.compression = string(p[18:22])
+	}
+	return &c, nil
+}
+
+// fromExtended converts an 80-bit IEEE 754 extended precision number, as used for the sample
+// rate, to a float64.
+func fromExtended(p [10]byte) float64 {
+	exp := int(binary.BigEndian.Uint16(p[:]) & 0x7fff)
+	mant := binary.BigEndian.Uint64(p[2:])
+	// The mantissa has an explicit integer bit, followed by 63 fraction bits.
+	x := math.Ldexp(float64(mant), exp-16383-63)
+	if p[0]&0x80 != 0 {
+		x = -x
+	}
+	return x
+}
+
+// toExtended converts x to an 80-bit IEEE 754 extended precision number.
+func toExtended(x float64) (p [10]byte) {
+	if x == 0 {
+		return p
+	}
+	var sign uint16
+	if x < 0 {
+		sign = 0x8000
+		x = -x
+	}
+	frac, exp := math.Frexp(x) // x = frac * 2^exp with frac in [0.5, 1)
+	binary.BigEndian.PutUint16(p[:], sign|uint16(exp-1+16383))
+	binary.BigEndian.PutUint64(p[2:], uint64(math.Ldexp(frac, 64)))
+	return p
+}
+
+type decoder struct {
+	r            io.Reader
+	seeker       io.Seeker // nil if r can't seek
+	start        int64     // offset of the file if seeker isn't nil
+	numChans     int
+	sampleSize   int  // number of bits which are used of each sample, starting with the most significant one
+	width        int  // bytes per sample
+	float        bool // whether samples are IEEE floats
+	littleEndian bool
+	hsz          int64 // offset of the sound data
+	dataSize     int64
+	pos          int64
+	err          error
+	buf          []byte
+	left         int // number of bytes of a partial frame at the start of buf
+}
+
+func (d *decoder) frameWidth() int {
+	return d.numChans * d.width
+}
+
+func (d *decoder) Stream(samples [][2]float64) (n int, ok bool) {
+	if d.err != nil || d.pos >= d.dataSize {
+		return 0, false
+	}
+	bytesPerFrame := d.frameWidth()
+	wantBytes := len(samples) * bytesPerFrame
+	numBytes := int(min(int64(wantBytes), d.dataSize-d.pos))
+	if numBytes < bytesPerFrame {
+		return 0, false
+	}
+	if len(d.buf) < numBytes {
+		buf := make([]byte, numBytes)
+		copy(buf, d.buf[:d.left])
+		d.buf = buf
+	}
+
+	// The whole request is read, because returning fewer samples signals the end of the audio.
+	// A partial frame at the end of a read, like after seeking, is kept for the next call.
+	read, err := io.ReadFull(d.r, d.buf[d.left:numBytes])
+	numBytes = d.left + read
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		d.err = errors.Wrap(err, "aiff")
+	}
+
+	p := d.buf[:numBytes]
+	for i, j := 0, 0; i <= numBytes-bytesPerFrame; i, j = i+bytesPerFrame, j+1 {
+		left := d.decodeSample(p[i:])
+		right := left
+		if d.numChans >= 2 {
+			right = d.decodeSample(p[i+d.width:])
+		}
+		samples[j][0] = left
+		samples[j][1] = right
+	}
+	n = numBytes / bytesPerFrame
+	d.left = copy(d.buf, p[n*bytesPerFrame:])
+	d.pos += int64(n * bytesPerFrame)
+	return n, n > 0
+}
+
+// decodeSample decodes a single sample from the start of p.
+func (d *decoder) decodeSample(p []byte) float64 {
+	if d.float {
+		if d.width == 4 {
+			return float64(math.Float32frombits(binary.BigEndian.Uint32(p)))
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(p))
+	}
+
+	// Integer samples are aligned to the most significant bits of an int32.
+	var u uint32
+	for i := 0; i < d.width; i++ {
+		b := p[i]
+		if d.littleEndian {
+			b = p[d.width-1-i]
+		}
+		u |= uint32(b) << (24 - 8*i)
+	}
+	x := int32(u)
+	// Ignore the bits below the sample size, which should be zero anyway.
+	x &^= 1<<(32-d.sampleSize) - 1
+	return float64(x) / (1 << 31)
+}
+
+func (d *decoder) Err() error {
+	return d.err
+}
+
+func (d *decoder) Len() int {
+	return int(d.dataSize / int64(d.frameWidth()))
+}
+
+func (d *decoder) Position() int {
+	return int(d.pos / int64(d.frameWidth()))
+}
+
+func (d *decoder) Seek(p int) error {
+	if p < 0 || d.Len() < p {
+		return fmt.Errorf("aiff: seek position %v out of range [%v, %v]", p, 0, d.Len())
+	}
+	pos := int64(p) * int64(d.frameWidth())
+	if d.seeker == nil {
+		if pos < d.pos {
+			return errors.New("aiff: seek error: can't seek backwards, because the resource isn't io.Seeker")
+		}
+		// Discard the audio up to the position. Like in Stream, the bytes of a partial frame
+		// are kept, so that the position stays consistent with r if reading fails midway.
+		bytesPerFrame := d.frameWidth()
+		if len(d.buf) < 64*bytesPerFrame {
+			buf := make([]byte, 64*bytesPerFrame)
+			copy(buf, d.buf[:d.left])
+			d.buf = buf
+		}
+		for d.pos < pos {
+			numBytes := int(min(pos-d.pos, int64(len(d.buf)/bytesPerFrame*bytesPerFrame)))
+			read, err := io.ReadFull(d.r, d.buf[d.left:numBytes])
+			frames := (d.left + read) / bytesPerFrame
+			d.left = copy(d.buf, d.buf[frames*bytesPerFrame:d.left+read])
+			d.pos += int64(frames * bytesPerFrame)
+			if err != nil {
+				return errors.Wrap(err, "aiff: seek error")
+			}
+		}
+		return nil
+	}
+	_, err := d.seeker.Seek(d.start+d.hsz+pos, io.SeekStart)
+	if err != nil {
+		return errors.Wrap(err, "aiff: seek error")
+	}
+	d.pos = pos
+	d.left = 0
+	return nil
+}
+
+func (d *decoder) Close() error {
+	if closer, ok := d.r.(io.Closer); ok {
+		err := closer.Close()
+		if err != nil {
+			return errors.Wrap(err, "aiff")
+		}
+	}
+	return nil
+}
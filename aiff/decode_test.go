@@ -0,0 +1,266 @@
+package aiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/orcaman/writerseeker"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+type chunk struct {
+	id   string
+	body []byte
+}
+
+// file builds a FORM file of the given type from chunks.
+func file(formType string, chunks ...chunk) []byte {
+	p := []byte("FORM\x00\x00\x00\x00" + formType)
+	for _, c := range chunks {
+		p = append(p, c.id...)
+		p = binary.BigEndian.AppendUint32(p, uint32(len(c.body)))
+		p = append(p, c.body...)
+		if len(c.body)%2 != 0 {
+			p = append(p, 0)
+		}
+	}
+	binary.BigEndian.PutUint32(p[4:], uint32(len(p)-8))
+	return p
+}
+
+// comm returns a COMM chunk, which is in AIFF-C format if compression isn't empty.
+func comm(channels, frames, sampleSize int, rate float64, compression string) chunk {
+	p := binary.BigEndian.AppendUint16(nil, uint16(channels))
+	p = binary.BigEndian.AppendUint32(p, uint32(frames))
+	p = binary.BigEndian.AppendUint16(p, uint16(sampleSize))
+	ext := toExtended(rate)
+	p = append(p, ext[:]...)
+	if compression != "" {
+		p = append(p, compression...)
+		p = append(p, pstring("")...)
+	}
+	return chunk{"COMM", p}
+}
+
+// ssnd returns a SSND chunk with the given offset before the sound data.
+func ssnd(offset int, data []byte) chunk {
+	p := binary.BigEndian.AppendUint32(nil, uint32(offset))
+	p = binary.BigEndian.AppendUint32(p, 0)
+	p = append(p, make([]byte, offset)...)
+	return chunk{"SSND", append(p, data...)}
+}
+
+func TestExtended(t *testing.T) {
+	tests := []struct {
+		rate     float64
+		extended [10]byte
+	}{
+		{8000, [10]byte{0x40, 0x0b, 0xfa}},
+		{44100, [10]byte{0x40, 0x0e, 0xac, 0x44}},
+		{48000, [10]byte{0x40, 0x0e, 0xbb, 0x80}},
+		{0.5, [10]byte{0x3f, 0xfe, 0x80}},
+		{-1, [10]byte{0xbf, 0xff, 0x80}},
+		{0, [10]byte{}},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.extended, toExtended(test.rate), "%v", test.rate)
+		assert.Equal(t, test.rate, fromExtended(test.extended), "%v", test.rate)
+	}
+	assert.Equal(t, 22050.5, fromExtended(toExtended(22050.5)))
+}
+
+func TestDecode_PCM(t *testing.T) {
+	tests := []struct {
+		name        string
+		compression string
+		sampleSize  int
+		data        []byte
+		expected    []float64
+	}{
+		{"8 bits", "", 8, []byte{0x40, 0xc0}, []float64{0.5, -0.5}},
+		{"12 bits", "", 12, []byte{0x40, 0x00, 0xff, 0xf0}, []float64{0.5, -1.0 / (1 << 11)}},
+		{"16 bits", "", 16, []byte{0x40, 0x00, 0x80, 0x00}, []float64{0.5, -1}},
+		{"24 bits", "", 24, []byte{0x40, 0x00, 0x00, 0xff, 0xff, 0xff}, []float64{0.5, -1.0 / (1 << 23)}},
+		{"32 bits", "", 32, []byte{0x40, 0x00, 0x00, 0x00, 0xc0, 0x00, 0x00, 0x00}, []float64{0.5, -0.5}},
+		{"AIFC NONE", "NONE", 16, []byte{0x40, 0x00, 0x80, 0x00}, []float64{0.5, -1}},
+		{"AIFC twos", "twos", 16, []byte{0x40, 0x00, 0x80, 0x00}, []float64{0.5, -1}},
+		{"AIFC sowt", "sowt", 16, []byte{0x00, 0x40, 0x00, 0x80}, []float64{0.5, -1}},
+		{"AIFC sowt 24 bits", "sowt", 24, []byte{0x00, 0x00, 0x40, 0xff, 0xff, 0xff}, []float64{0.5, -1.0 / (1 << 23)}},
+		{"AIFC fl32", "fl32", 32, []byte{0x3f, 0x00, 0x00, 0x00, 0xbf, 0xc0, 0x00, 0x00}, []float64{0.5, -1.5}},
+		{"AIFC fl64", "fl64", 64, []byte{0x3f, 0xe0, 0, 0, 0, 0, 0, 0, 0xbf, 0xf8, 0, 0, 0, 0, 0, 0}, []float64{0.5, -1.5}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			formType := "AIFF"
+			if test.compression != "" {
+				formType = "AIFC"
+			}
+			frames := len(test.expected)
+			f := file(formType, comm(1, frames, test.sampleSize, 22050, test.compression), ssnd(0, test.data))
+
+			s, format, err := Decode(bytes.NewReader(f))
+			assert.NoError(t, err)
+			assert.Equal(t, beep.Format{SampleRate: 22050, NumChannels: 1, Precision: (test.sampleSize + 7) / 8}, format)
+			assert.Equal(t, frames, s.Len())
+
+			var expected [][2]float64
+			for _, x := range test.expected {
+				expected = append(expected, [2]float64{x, x})
+			}
+			testtools.AssertSamplesEqual(t, expected, testtools.Collect(s))
+			assert.NoError(t, s.Err())
+
+			assert.NoError(t, s.Seek(1))
+			testtools.AssertSamplesEqual(t, expected[1:], testtools.Collect(s))
+		})
+	}
+}
+
+func TestDecode_Stereo(t *testing.T) {
+	// The third channel is ignored.
+	data := []byte{0x40, 0x00, 0xc0, 0x00, 0x10, 0x00}
+	f := file("AIFF", comm(3, 1, 16, 44100, ""), ssnd(4, data))
+
+	s, format, err := Decode(bytes.NewReader(f))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, format.NumChannels)
+	testtools.AssertSamplesEqual(t, [][2]float64{{0.5, -0.5}}, testtools.Collect(s))
+}
+
+func TestDecoder_DoesNotAllocate(t *testing.T) {
+	frames := 10000
+	f := file("AIFF", comm(2, frames, 16, 44100, ""), ssnd(0, make([]byte, frames*4)))
+	s, _, err := Decode(bytes.NewReader(f))
+	assert.NoError(t, err)
+
+	testtools.AssertStreamerDoesNotAllocate(t, s)
+}
+
+func TestDecode_ChunkOrder(t *testing.T) {
+	data := []byte{0x40, 0x00, 0xc0, 0x00, 0x20, 0x00}
+	expected := [][2]float64{{0.5, 0.5}, {-0.5, -0.5}, {0.25, 0.25}}
+	f := file("AIFF",
+		chunk{"NAME", []byte("odd")},
+		ssnd(2, data),
+		chunk{"ANNO", []byte("before the COMM chunk")},
+		comm(1, 3, 16, 44100, ""),
+	)
+
+	s, _, err := Decode(bytes.NewReader(f))
+	assert.NoError(t, err)
+	testtools.AssertSamplesEqual(t, expected, testtools.Collect(s))
+	assert.NoError(t, s.Seek(1))
+	testtools.AssertSamplesEqual(t, expected[1:], testtools.Collect(s))
+
+	_, _, err = Decode(struct{ io.Reader }{bytes.NewReader(f)})
+	assert.Error(t, err, "the reader must seek back to the sound data")
+}
+
+func TestDecode_FramesBeyondSoundData(t *testing.T) {
+	f := file("AIFF", comm(2, 100, 16, 44100, ""), ssnd(0, make([]byte, 4*3+1)))
+	s, _, err := Decode(bytes.NewReader(f))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, s.Len())
+	assert.Len(t, testtools.Collect(s), 3)
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	tests := map[string][]byte{
+		"no FORM":          []byte("RIFF\x00\x00\x00\x04WAVE"),
+		"wrong type":       file("8SVX"),
+		"no COMM":          file("AIFF", ssnd(0, nil)),
+		"no SSND":          file("AIFF", comm(1, 0, 16, 44100, "")),
+		"no channels":      file("AIFF", comm(0, 0, 16, 44100, ""), ssnd(0, nil)),
+		"sample size":      file("AIFF", comm(1, 0, 33, 44100, ""), ssnd(0, nil)),
+		"sample rate":      file("AIFF", comm(1, 0, 16, 0, ""), ssnd(0, nil)),
+		"compression":      file("AIFC", comm(1, 0, 16, 44100, "ima4"), ssnd(0, nil)),
+		"short COMM chunk": file("AIFF", chunk{"COMM", make([]byte, 10)}, ssnd(0, nil)),
+	}
+	for name, f := range tests {
+		_, _, err := Decode(bytes.NewReader(f))
+		assert.Error(t, err, name)
+	}
+}
+
+func TestDecode_PartialReads(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 3}
+	s, _ := testtools.RandomDataStreamer(1000)
+	var w writerseeker.WriterSeeker
+	assert.NoError(t, Encode(&w, s, format))
+	data, err := io.ReadAll(w.Reader())
+	assert.NoError(t, err)
+
+	d, _, err := Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	expected := testtools.Collect(d)
+
+	d, _, err = Decode(iotest.OneByteReader(bytes.NewReader(data)))
+	assert.NoError(t, err)
+	var actual [][2]float64
+	buf := make([][2]float64, 7)
+	for {
+		n, ok := d.Stream(buf)
+		if !ok {
+			break
+		}
+		actual = append(actual, buf[:n]...)
+	}
+	assert.NoError(t, d.Err())
+	testtools.AssertSamplesEqual(t, expected, actual)
+
+	// Without io.Seeker, seeking only works forward.
+	d, _, err = Decode(iotest.HalfReader(bytes.NewReader(data)))
+	assert.NoError(t, err)
+	testtools.CollectNum(11, d)
+	assert.NoError(t, d.Seek(500))
+	testtools.AssertSamplesEqual(t, expected[500:510], testtools.CollectNum(10, d))
+	assert.Error(t, d.Seek(100))
+}
+
+func TestDecode_ChunkedReader(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	s, _ := testtools.RandomDataStreamer(10000)
+	var w writerseeker.WriterSeeker
+	assert.NoError(t, Encode(&w, s, format))
+
+	// Short reads must not end the audio early, which a Mixer would take as drained.
+	d, _, err := Decode(testtools.NewChunkedReader(w.Reader(), 100))
+	assert.NoError(t, err)
+	var m beep.Mixer
+	m.KeepAlive(false)
+	m.Add(d)
+	assert.Len(t, testtools.Collect(&m), 10000)
+	assert.NoError(t, d.Err())
+}
+
+func TestDecode_NonSeekableReadError(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 3}
+	s, _ := testtools.RandomDataStreamer(1000)
+	var w writerseeker.WriterSeeker
+	assert.NoError(t, Encode(&w, s, format))
+	data, err := io.ReadAll(w.Reader())
+	assert.NoError(t, err)
+
+	d, _, err := Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	expected := testtools.Collect(d)
+	headerSize := len(data) - d.Len()*format.Width()
+
+	// The reader fails in the middle of the frame at 300.
+	r := testtools.NewFailOnceReader(bytes.NewReader(data), int64(headerSize+300*format.Width()+4), io.ErrClosedPipe)
+	d, _, err = Decode(iotest.HalfReader(r))
+	assert.NoError(t, err)
+	testtools.CollectNum(11, d)
+	assert.ErrorIs(t, d.Seek(500), io.ErrClosedPipe)
+	assert.Equal(t, 300, d.Position(), "the position is where the reading stopped")
+	assert.NoError(t, d.Err())
+	assert.NoError(t, d.Seek(600))
+	testtools.AssertSamplesEqual(t, expected[600:610], testtools.CollectNum(10, d))
+	assert.NoError(t, d.Err())
+}
@@ -0,0 +1,250 @@
+package aiff
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/pkg/errors"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// aifcVersion is the timestamp of the AIFF-C version in the FVER chunk.
+const aifcVersion = 0xA2805140
+
+// EncodeOption configures how Encode writes the audio.
+type EncodeOption func(opts *encodeOptions)
+
+type encodeOptions struct {
+	dither   beep.Dither
+	shaping  beep.NoiseShaping
+	float    bool
+	metadata *Metadata
+}
+
+// Dither sets the dither and noise shaping used when the samples are quantized to integers.
+// By default, samples are quantized without dither.
+func Dither(dither beep.Dither, shaping beep.NoiseShaping) EncodeOption {
+	return func(opts *encodeOptions) {
+		opts.dither = dither
+		opts.shaping = shaping
+	}
+}
+
+// Float makes Encode write an AIFF-C file with IEEE floating point samples ("fl32" or "fl64")
+// instead of integers. The precision of the format must be 4 or 8 bytes. Floating point samples
+// aren't clipped.
+func Float() EncodeOption {
+	return func(opts *encodeOptions) {
+		opts.float = true
+	}
+}
+
+// WithMetadata makes Encode write the markers and the instrument of m. They are written before
+// the audio data.
+func WithMetadata(m *Metadata) EncodeOption {
+	return func(opts *encodeOptions) {
+		opts.metadata = m
+	}
+}
+
+// Encode writes all audio streamed from s to w in AIFF format, or AIFF-C format for floating
+// point samples.
+//
+// Format precision must be 1, 2, 3 or 4 bytes for integer samples and 4 or 8 bytes for floating
+// point samples, see Float.
+func Encode(w io.WriteSeeker, s beep.Streamer, format beep.Format, opts ...EncodeOption) error {
+	var o encodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if format.NumChannels <= 0 {
+		return errors.New("aiff: invalid number of channels (less than 1)")
+	}
+	if format.NumChannels > math.MaxInt16 {
+		return errors.New("aiff: invalid number of channels (too many)")
+	}
+	if o.float && format.Precision != 4 && format.Precision != 8 {
+		return errors.New("aiff: unsupported precision, 4 or 8 is supported for floating point samples")
+	}
+	if !o.float && (format.Precision < 1 || format.Precision > 4) {
+		return errors.New("aiff: unsupported precision, 1, 2, 3 or 4 is supported")
+	}
+	if err := beep.CheckDither(o.dither, o.shaping); err != nil {
+		return errors.Wrap(err, "aiff")
+	}
+
+	var metadata []byte
+	if o.metadata != nil {
+		metadata = o.metadata.encode()
+	}
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Wrap(err, "aiff")
+	}
+	if _, err := w.Write(header(format, o.float, metadata, 0)); err != nil {
+		return errors.Wrap(err, "aiff")
+	}
+
+	var (
+		bw      = bufio.NewWriter(w)
+		q       = beep.NewQuantizer(format, o.dither, o.shaping)
+		samples = make([][2]float64, 512)
+		buffer  = make([]byte, len(samples)*format.Width())
+		written int64
+	)
+	for {
+		n, ok := s.Stream(samples)
+		if !ok {
+			break
+		}
+		buf := buffer
+		for _, sample := range samples[:n] {
+			if o.float {
+				buf = buf[encodeFloat(format, buf, sample):]
+			} else {
+				buf = buf[encodeSigned(q, buf, sample):]
+			}
+		}
+		nn, err := bw.Write(buffer[:n*format.Width()])
+		written += int64(nn)
+		if err != nil {
+			return errors.Wrap(err, "aiff")
+		}
+	}
+	if written%2 != 0 {
+		// Chunks are padded to an even size.
+		if err := bw.WriteByte(0); err != nil {
+			return errors.Wrap(err, "aiff")
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return errors.Wrap(err, "aiff")
+	}
+
+	// finalize header
+	frames := written / int64(format.Width())
+	h := header(format, o.float, metadata, frames)
+	if int64(len(h))+written+written%2 > math.MaxUint32 {
+		return errors.New("aiff: audio too long, AIFF files are limited to 4 GiB")
+	}
+	if _, err := w.Seek(start, io.SeekStart); err != nil {
+		return errors.Wrap(err, "aiff")
+	}
+	if _, err := w.Write(h); err != nil {
+		return errors.Wrap(err, "aiff")
+	}
+	if _, err := w.Seek(0, io.SeekEnd); err != nil {
+		return errors.Wrap(err, "aiff")
+	}
+	return nil
+}
+
+// header returns the chunks of a file with the given number of frames up to the start of the
+// sound data.
+func header(f beep.Format, float bool, metadata []byte, frames int64) []byte {
+	var b bytes.Buffer
+	write := func(data any) {
+		// Writing to a bytes.Buffer can't fail.
+		_ = binary.Write(&b, binary.BigEndian, data)
+	}
+	dataSize := frames * int64(f.Width())
+
+	comm := commChunk{
+		NumChans:   int16(f.NumChannels),
+		NumFrames:  uint32(frames),
+		SampleSize: int16(f.Precision * 8),
+		SampleRate: toExtended(float64(f.SampleRate)),
+	}
+	commSize := 18
+	formType := "AIFF"
+	var compression, compressionName string
+	if float {
+		formType = "AIFC"
+		compression, compressionName = "fl32", "32-bit floating point"
+		if f.Precision == 8 {
+			compression, compressionName = "fl64", "64-bit floating point"
+		}
+		commSize += 4 + len(pstring(compressionName))
+	}
+
+	formSize := 4 + 8 + int64(commSize) + int64(len(metadata)) + 8 + 8 + dataSize + dataSize%2
+	if float {
+		formSize += 8 + 4
+	}
+
+	write([]byte("FORM"))
+	write(uint32(formSize))
+	write([]byte(formType))
+	if float {
+		// AIFF-C files require the version of the format.
+		write([]byte("FVER"))
+		write(uint32(4))
+		write(uint32(aifcVersion))
+	}
+	write([]byte("COMM"))
+	write(uint32(commSize))
+	write(comm.NumChans)
+	write(comm.NumFrames)
+	write(comm.SampleSize)
+	write(comm.SampleRate)
+	if float {
+		write([]byte(compression))
+		write(pstring(compressionName))
+	}
+	write(metadata)
+	write([]byte("SSND"))
+	write(uint32(8 + dataSize))
+	write(uint32(0)) // offset
+	write(uint32(0)) // block size
+	return b.Bytes()
+}
+
+// encodeSigned encodes a single sample in big-endian signed format.
+func encodeSigned(q *beep.Quantizer, p []byte, sample [2]float64) (n int) {
+	f := q.Format()
+	n = q.EncodeSigned(p, sample)
+	// The Quantizer encodes in little-endian byte order.
+	for c := 0; c < f.NumChannels; c++ {
+		x := p[c*f.Precision : (c+1)*f.Precision]
+		for i, j := 0, len(x)-1; i < j; i, j = i+1, j-1 {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	return n
+}
+
+// encodeFloat encodes a single sample as big-endian floating point numbers of the precision of f.
+func encodeFloat(f beep.Format, p []byte, sample [2]float64) (n int) {
+	put := func(i int, x float64) {
+		if f.Precision == 4 {
+			binary.BigEndian.PutUint32(p[i*4:], math.Float32bits(float32(x)))
+		} else {
+			binary.BigEndian.PutUint64(p[i*8:], math.Float64bits(x))
+		}
+	}
+	if f.NumChannels == 1 {
+		put(0, (sample[0]+sample[1])/2)
+		return f.Width()
+	}
+	put(0, sample[0])
+	put(1, sample[1])
+	for c := 2; c < f.NumChannels; c++ {
+		put(c, 0)
+	}
+	return f.Width()
+}
+
+// pstring returns s as Pascal-style string, which starts with its length and is padded to an even
+// size.
+func pstring(s string) []byte {
+	s = s[:min(len(s), 255)]
+	p := append([]byte{byte(len(s))}, s...)
+	if len(p)%2 != 0 {
+		p = append(p, 0)
+	}
+	return p
+}
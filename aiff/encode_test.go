@@ -0,0 +1,107 @@
+package aiff
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/orcaman/writerseeker"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/generators"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+func TestEncode(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	s := testtools.NewDataStreamer([][2]float64{{0.5, -0.5}, {0, -1}})
+
+	var w writerseeker.WriterSeeker
+	assert.NoError(t, Encode(&w, s, format))
+	encoded, err := io.ReadAll(w.Reader())
+	assert.NoError(t, err)
+
+	// Everything is encoded using big endian.
+	assert.Equal(t, []byte{
+		'F', 'O', 'R', 'M',
+		0x00, 0x00, 0x00, 0x36, // 54 bytes
+		'A', 'I', 'F', 'F',
+
+		'C', 'O', 'M', 'M',
+		0x00, 0x00, 0x00, 0x12, // 18 bytes
+		0x00, 0x02, // channels
+		0x00, 0x00, 0x00, 0x02, // frames
+		0x00, 0x10, // bits per sample
+		0x40, 0x0e, 0xac, 0x44, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, // 44100 Hz
+
+		'S', 'S', 'N', 'D',
+		0x00, 0x00, 0x00, 0x10, // 16 bytes
+		0x00, 0x00, 0x00, 0x00, // offset
+		0x00, 0x00, 0x00, 0x00, // block size
+		0x40, 0x00, 0xc0, 0x00, // first frame
+		0x00, 0x00, 0x80, 0x00, // second frame
+	}, encoded)
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	for _, float := range []bool{false, true} {
+		for _, precision := range []int{1, 2, 3, 4, 8} {
+			if float != (precision >= 4) {
+				continue
+			}
+			for _, channels := range []int{1, 2, 3} {
+				t.Run(fmt.Sprintf("float=%v/precision=%d/channels=%d", float, precision, channels), func(t *testing.T) {
+					format := beep.Format{SampleRate: 48000, NumChannels: channels, Precision: precision}
+					var opts []EncodeOption
+					if float {
+						opts = append(opts, Float())
+					}
+					// An odd number of bytes is padded.
+					s, data := testtools.RandomDataStreamer(1001)
+
+					var w writerseeker.WriterSeeker
+					assert.NoError(t, Encode(&w, s, format, opts...))
+
+					d, f, err := Decode(w.BytesReader())
+					assert.NoError(t, err)
+					assert.Equal(t, format, f)
+					assert.Equal(t, len(data), d.Len())
+
+					actual := testtools.Collect(d)
+					assert.Len(t, actual, len(data))
+					delta := 2 / math.Ldexp(1, precision*8-1)
+					if float {
+						delta = 1e-6
+					}
+					for i := range data {
+						expected := data[i]
+						if channels == 1 {
+							expected[0] = (expected[0] + expected[1]) / 2
+							expected[1] = expected[0]
+						}
+						assert.InDelta(t, expected[0], actual[i][0], delta)
+						assert.InDelta(t, expected[1], actual[i][1], delta)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestEncode_Invalid(t *testing.T) {
+	tests := []struct {
+		format beep.Format
+		opts   []EncodeOption
+	}{
+		{beep.Format{SampleRate: 44100, NumChannels: 0, Precision: 2}, nil},
+		{beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 5}, nil},
+		{beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}, []EncodeOption{Float()}},
+		{beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}, []EncodeOption{Dither(beep.Dither(99), beep.NoiseShapingNone)}},
+	}
+	for _, test := range tests {
+		var w writerseeker.WriterSeeker
+		assert.Error(t, Encode(&w, generators.Silence(10), test.format, test.opts...))
+	}
+}
@@ -0,0 +1,238 @@
+package aiff
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// Metadata holds the marker and instrument chunks of an AIFF file.
+type Metadata struct {
+	// Markers are the markers (MARK chunk), which point to positions in the audio.
+	Markers []Marker
+
+	// Instrument holds how a sampler plays the audio and its loops (INST chunk).
+	Instrument *Instrument
+}
+
+// Marker is a marker of an AIFF file.
+type Marker struct {
+	ID       int16
+	Position int // in frames, the marker is before the frame at the position
+	Name     string
+}
+
+// Instrument is the INST chunk, which describes how a sampler plays the audio.
+type Instrument struct {
+	BaseNote     int8 // MIDI note number of the audio as recorded
+	Detune       int8 // in cents
+	LowNote      int8
+	HighNote     int8
+	LowVelocity  int8
+	HighVelocity int8
+	Gain         int16 // in dB
+	SustainLoop  Loop
+	ReleaseLoop  Loop
+}
+
+// LoopPlayMode is how a Loop is played.
+type LoopPlayMode int16
+
+const (
+	NoLooping LoopPlayMode = iota
+	ForwardLooping
+	ForwardBackwardLooping
+)
+
+// Loop is a loop of an Instrument between two markers.
+type Loop struct {
+	PlayMode LoopPlayMode
+	Begin    int16 // marker ID
+	End      int16 // marker ID
+}
+
+// Marker returns the marker with the given ID.
+func (m *Metadata) Marker(id int16) (Marker, bool) {
+	for _, marker := range m.Markers {
+		if marker.ID == id {
+			return marker, true
+		}
+	}
+	return Marker{}, false
+}
+
+// LoopOptions returns the options to play l with beep.Loop2. The loop is always played forward,
+// since Loop2 doesn't support other directions. It's an error if l doesn't loop or its markers
+// are missing.
+func (m *Metadata) LoopOptions(l Loop) ([]beep.LoopOption, error) {
+	if l.PlayMode == NoLooping {
+		return nil, errors.New("aiff: the loop isn't played")
+	}
+	begin, ok := m.Marker(l.Begin)
+	if !ok {
+		return nil, fmt.Errorf("aiff: missing loop begin marker %d", l.Begin)
+	}
+	end, ok := m.Marker(l.End)
+	if !ok {
+		return nil, fmt.Errorf("aiff: missing loop end marker %d", l.End)
+	}
+	return []beep.LoopOption{beep.LoopBetween(begin.Position, end.Position)}, nil
+}
+
+// ReadMetadata reads the marker and instrument chunks of an AIFF or AIFF-C file from r. The audio
+// data is skipped by seeking if r is an io.Seeker, otherwise it's read and discarded.
+func ReadMetadata(r io.Reader) (*Metadata, error) {
+	var form struct {
+		ID   [4]byte
+		Size uint32
+		Type [4]byte
+	}
+	if err := binary.Read(r, binary.BigEndian, &form); err != nil {
+		return nil, errors.Wrap(err, "aiff: missing FORM header")
+	}
+	if string(form.ID[:]) != "FORM" {
+		return nil, fmt.Errorf("aiff: missing FORM at the beginning > %s", string(form.ID[:]))
+	}
+	if string(form.Type[:]) != "AIFF" && string(form.Type[:]) != "AIFC" {
+		return nil, errors.New("aiff: unsupported file type")
+	}
+
+	var (
+		m     Metadata
+		chunk struct {
+			ID   [4]byte
+			Size uint32
+		}
+	)
+	for {
+		if err := binary.Read(r, binary.BigEndian, &chunk); err != nil {
+			if err == io.EOF {
+				return &m, nil
+			}
+			return nil, errors.Wrap(err, "aiff: missing chunk header")
+		}
+		id, size := string(chunk.ID[:]), int64(chunk.Size)
+		if id != "MARK" && id != "INST" {
+			if err := skip(r, size+size%2); err != nil {
+				return nil, errors.Wrapf(err, "aiff: missing %s chunk body", id)
+			}
+			continue
+		}
+
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, errors.Wrapf(err, "aiff: missing %s chunk body", id)
+		}
+		if size%2 != 0 {
+			// Some files lack the padding of their last chunk.
+			if _, err := io.ReadFull(r, make([]byte, 1)); err != nil && err != io.EOF {
+				return nil, errors.Wrap(err, "aiff")
+			}
+		}
+		switch id {
+		case "MARK":
+			m.Markers = parseMarkers(body)
+		case "INST":
+			m.Instrument = parseInstrument(body)
+		}
+	}
+}
+
+// skip skips n bytes of r.
+func skip(r io.Reader, n int64) error {
+	if seeker, ok := r.(io.Seeker); ok {
+		cur, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		end, err := seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		if cur+n > end {
+			return io.ErrUnexpectedEOF
+		}
+		_, err = seeker.Seek(cur+n, io.SeekStart)
+		return err
+	}
+	_, err := io.CopyN(io.Discard, r, n)
+	return err
+}
+
+func parseMarkers(p []byte) []Marker {
+	if len(p) < 2 {
+		return nil
+	}
+	n := int(binary.BigEndian.Uint16(p))
+	p = p[2:]
+	markers := make([]Marker, 0, n)
+	for i := 0; i < n && len(p) >= 7; i++ {
+		marker := Marker{
+			ID:       int16(binary.BigEndian.Uint16(p)),
+			Position: int(binary.BigEndian.Uint32(p[2:])),
+		}
+		// The name is a Pascal-style string padded to an even size.
+		length := int(p[6])
+		marker.Name = string(p[7:min(7+length, len(p))])
+		markers = append(markers, marker)
+		p = p[min(6+len(pstring(marker.Name)), len(p)):]
+	}
+	return markers
+}
+
+func parseInstrument(p []byte) *Instrument {
+	if len(p) < 20 {
+		return nil
+	}
+	loop := func(p []byte) Loop {
+		return Loop{
+			PlayMode: LoopPlayMode(binary.BigEndian.Uint16(p)),
+			Begin:    int16(binary.BigEndian.Uint16(p[2:])),
+			End:      int16(binary.BigEndian.Uint16(p[4:])),
+		}
+	}
+	return &Instrument{
+		BaseNote:     int8(p[0]),
+		Detune:       int8(p[1]),
+		LowNote:      int8(p[2]),
+		HighNote:     int8(p[3]),
+		LowVelocity:  int8(p[4]),
+		HighVelocity: int8(p[5]),
+		Gain:         int16(binary.BigEndian.Uint16(p[6:])),
+		SustainLoop:  loop(p[8:]),
+		ReleaseLoop:  loop(p[14:]),
+	}
+}
+
+// encode returns the metadata as chunks.
+func (m *Metadata) encode() []byte {
+	var b bytes.Buffer
+	write := func(data any) {
+		// Writing to a bytes.Buffer can't fail.
+		_ = binary.Write(&b, binary.BigEndian, data)
+	}
+
+	if len(m.Markers) > 0 {
+		markers := binary.BigEndian.AppendUint16(nil, uint16(len(m.Markers)))
+		for _, marker := range m.Markers {
+			markers = binary.BigEndian.AppendUint16(markers, uint16(marker.ID))
+			markers = binary.BigEndian.AppendUint32(markers, uint32(marker.Position))
+			markers = append(markers, pstring(marker.Name)...)
+		}
+		write([]byte("MARK"))
+		write(uint32(len(markers)))
+		write(markers)
+	}
+
+	if inst := m.Instrument; inst != nil {
+		write([]byte("INST"))
+		write(uint32(20))
+		write(inst)
+	}
+	return b.Bytes()
+}
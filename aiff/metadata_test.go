@@ -0,0 +1,95 @@
+package aiff
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/orcaman/writerseeker"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+func testMetadata() *Metadata {
+	return &Metadata{
+		Markers: []Marker{
+			{ID: 1, Position: 2, Name: "Sustain begin"},
+			{ID: 2, Position: 5, Name: "Sustain end"},
+			{ID: 3, Position: 8},
+		},
+		Instrument: &Instrument{
+			BaseNote:     60,
+			Detune:       -5,
+			LowNote:      0,
+			HighNote:     127,
+			LowVelocity:  1,
+			HighVelocity: 127,
+			Gain:         -3,
+			SustainLoop:  Loop{PlayMode: ForwardLooping, Begin: 1, End: 2},
+		},
+	}
+}
+
+func TestMetadata_RoundTrip(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	s, data := testtools.RandomDataStreamer(10)
+	m := testMetadata()
+
+	var w writerseeker.WriterSeeker
+	assert.NoError(t, Encode(&w, s, format, WithMetadata(m)))
+
+	got, err := ReadMetadata(w.BytesReader())
+	assert.NoError(t, err)
+	assert.Equal(t, m, got)
+
+	// Without io.Seeker, the audio data is read and discarded.
+	got, err = ReadMetadata(struct{ io.Reader }{w.BytesReader()})
+	assert.NoError(t, err)
+	assert.Equal(t, m, got)
+
+	// The decoder skips the metadata.
+	d, _, err := Decode(w.BytesReader())
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), d.Len())
+}
+
+func TestReadMetadata_None(t *testing.T) {
+	var w writerseeker.WriterSeeker
+	assert.NoError(t, Encode(&w, beep.Silence(3), beep.Format{SampleRate: 44100, NumChannels: 1, Precision: 1}))
+
+	got, err := ReadMetadata(w.BytesReader())
+	assert.NoError(t, err)
+	assert.Equal(t, &Metadata{}, got)
+}
+
+func TestReadMetadata_AfterSoundData(t *testing.T) {
+	m := testMetadata()
+	f := file("AIFF", comm(1, 3, 8, 44100, ""), ssnd(0, []byte{1, 2, 3}))
+	f = append(f, m.encode()...)
+
+	got, err := ReadMetadata(bytes.NewReader(f))
+	assert.NoError(t, err)
+	assert.Equal(t, m, got)
+}
+
+func TestMetadata_LoopOptions(t *testing.T) {
+	m := testMetadata()
+	s, data := testtools.RandomDataStreamer(10)
+
+	opts, err := m.LoopOptions(m.Instrument.SustainLoop)
+	assert.NoError(t, err)
+	looped, err := beep.Loop2(s, append(opts, beep.LoopTimes(1))...)
+	assert.NoError(t, err)
+
+	var expected [][2]float64
+	expected = append(expected, data[:5]...)
+	expected = append(expected, data[2:]...)
+	testtools.AssertSamplesEqual(t, expected, testtools.Collect(looped))
+
+	_, err = m.LoopOptions(m.Instrument.ReleaseLoop)
+	assert.Error(t, err, "the release loop isn't played")
+	_, err = m.LoopOptions(Loop{PlayMode: ForwardLooping, Begin: 1, End: 4})
+	assert.Error(t, err, "the end marker is missing")
+}
@@ -1,6 +1,7 @@
 package beep
 
 import (
+	"encoding/binary"
 	"fmt"
 	"math"
 	"time"
@@ -44,12 +45,12 @@ func (f Format) Width() int {
 
 // EncodeSigned encodes a single sample in f.Width() bytes to p in signed format.
 func (f Format) EncodeSigned(p []byte, sample [2]float64) (n int) {
-	return f.encode(true, p, sample)
+	return f.encode(true, p, sample, nil)
 }
 
 // EncodeUnsigned encodes a single sample in f.Width() bytes to p in unsigned format.
 func (f Format) EncodeUnsigned(p []byte, sample [2]float64) (n int) {
-	return f.encode(false, p, sample)
+	return f.encode(false, p, sample, nil)
 }
 
 // DecodeSigned decodes a single sample encoded in f.Width() bytes from p in signed format.
@@ -62,14 +63,120 @@ func (f Format) DecodeUnsigned(p []byte) (sample [2]float64, n int) {
 	return f.decode(false, p)
 }
 
-func (f Format) encode(signed bool, p []byte, sample [2]float64) (n int) {
+// Encoding is the way samples are stored as bytes, see Format.Encode, Format.Decode and
+// NewReader. The precision of the format determines the size of each sample.
+//
+// The zero value is signed integers in little-endian byte order, the same as EncodeSigned and
+// DecodeSigned, which is ffmpeg's s16le format for a precision of 2.
+type Encoding struct {
+	// Float selects IEEE floating point samples, which have a precision of 4 or 8 bytes, instead
+	// of integers. Floating point samples aren't clipped.
+	Float bool
+
+	// Unsigned selects unsigned integers, which are offset by half of their range, instead of
+	// signed integers. It's ignored for floating point samples.
+	Unsigned bool
+
+	// BigEndian selects big-endian byte order instead of little-endian byte order.
+	BigEndian bool
+}
+
+// Encode encodes a single sample in f.Width() bytes to p in the given encoding.
+func (f Format) Encode(enc Encoding, p []byte, sample [2]float64) (n int) {
+	return f.encodeAs(enc, p, sample, nil)
+}
+
+// Decode decodes a single sample encoded in f.Width() bytes from p in the given encoding.
+func (f Format) Decode(enc Encoding, p []byte) (sample [2]float64, n int) {
+	for c := 0; c < min(f.NumChannels, 2); c++ {
+		sample[c] = enc.decodeSample(f.Precision, p[c*f.Precision:])
+	}
+	if f.NumChannels == 1 {
+		sample[1] = sample[0]
+	}
+	return sample, f.Width()
+}
+
+// encodeAs encodes sample to p in the given encoding. If q isn't nil, it's used to quantize
+// integer samples.
+func (f Format) encodeAs(enc Encoding, p []byte, sample [2]float64, q *Quantizer) (n int) {
+	if !enc.Float {
+		n = f.encode(!enc.Unsigned, p, sample, q)
+		if enc.BigEndian {
+			// Reverse the bytes of each sample.
+			for c := 0; c < f.NumChannels; c++ {
+				x := p[c*f.Precision : (c+1)*f.Precision]
+				for i, j := 0, len(x)-1; i < j; i, j = i+1, j-1 {
+					x[i], x[j] = x[j], x[i]
+				}
+			}
+		}
+		return n
+	}
+
+	put := func(c int, x float64) {
+		if f.Precision == 4 {
+			enc.byteOrder().PutUint32(p[c*4:], math.Float32bits(float32(x)))
+		} else {
+			enc.byteOrder().PutUint64(p[c*8:], math.Float64bits(x))
+		}
+	}
+	if f.NumChannels == 1 {
+		put(0, (sample[0]+sample[1])/2)
+		return f.Width()
+	}
+	put(0, sample[0])
+	put(1, sample[1])
+	for c := 2; c < f.NumChannels; c++ {
+		put(c, 0)
+	}
+	return f.Width()
+}
+
+// decodeSample decodes a single sample of a single channel from p.
+func (enc Encoding) decodeSample(precision int, p []byte) float64 {
+	if enc.Float {
+		if precision == 4 {
+			return float64(math.Float32frombits(enc.byteOrder().Uint32(p)))
+		}
+		return math.Float64frombits(enc.byteOrder().Uint64(p))
+	}
+	var xUint64 uint64
+	for i := 0; i < precision; i++ {
+		b := p[precision-1-i]
+		if enc.BigEndian {
+			b = p[i]
+		}
+		xUint64 = xUint64<<8 | uint64(b)
+	}
+	if enc.Unsigned {
+		return unsignedToFloat(precision, xUint64)
+	}
+	return signedToFloat(precision, xUint64)
+}
+
+func (enc Encoding) byteOrder() binary.ByteOrder {
+	if enc.BigEndian {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// encode encodes sample to p. If q isn't nil, it's used to quantize the left and right channels.
+func (f Format) encode(signed bool, p []byte, sample [2]float64, q *Quantizer) (n int) {
 	switch {
 	case f.NumChannels == 1:
 		x := util.Clamp((sample[0]+sample[1])/2, -1, 1)
+		if q != nil {
+			x = q.quantize(0, f.Precision, x)
+		}
 		p = p[encodeFloat(signed, f.Precision, p, x):]
 	case f.NumChannels >= 2:
 		for c := range sample {
 			x := util.Clamp(sample[c], -1, 1)
+			if q != nil {
+				x = q.quantize(c, f.Precision, x)
+			}
 			p = p[encodeFloat(signed, f.Precision, p, x):]
 		}
 		for c := len(sample); c < f.NumChannels; c++ {
@@ -128,33 +235,42 @@ func decodeFloat(signed bool, precision int, p []byte) (x float64, n int) {
 	return unsignedToFloat(precision, xUint64), precision
 }
 
+// fullScale returns 2^(precision*8-1), the magnitude of the most negative signed integer of the
+// given precision.
+func fullScale(precision int) float64 {
+	return float64(uint64(1) << uint(precision*8-1))
+}
+
 func floatToSigned(precision int, x float64) uint64 {
+	scale := fullScale(precision)
 	if x < 0 {
-		compl := uint64(-x * math.Exp2(float64(precision)*8-1))
+		compl := uint64(-x * scale)
 		return uint64(1<<uint(precision*8)) - compl
 	}
-	return uint64(math.Min(x*math.Exp2(float64(precision)*8-1), math.Exp2(float64(precision)*8-1)-1))
+	return uint64(math.Min(x*scale, scale-1))
 }
 
 func floatToUnsigned(precision int, x float64) uint64 {
-	return uint64(math.Min((x+1)/2*math.Exp2(float64(precision)*8), math.Exp2(float64(precision)*8)-1))
+	scale := 2 * fullScale(precision)
+	return uint64(math.Min((x+1)/2*scale, scale-1))
 }
 
 func signedToFloat(precision int, xUint64 uint64) float64 {
 	if xUint64 >= 1<<uint(precision*8-1) {
 		compl := 1<<uint(precision*8) - xUint64
-		return -float64(int64(compl)) / math.Exp2(float64(precision)*8-1)
+		return -float64(int64(compl)) / fullScale(precision)
 	}
-	return float64(int64(xUint64)) / math.Exp2(float64(precision)*8-1)
+	return float64(int64(xUint64)) / fullScale(precision)
 }
 
 func unsignedToFloat(precision int, xUint64 uint64) float64 {
-	return float64(xUint64)/(math.Exp2(float64(precision)*8))*2 - 1
+	return float64(xUint64)/(2*fullScale(precision))*2 - 1
 }
 
 // Buffer is a storage for audio data. You can think of it as a bytes.Buffer for audio samples.
 type Buffer struct {
 	f    Format
+	q    *Quantizer
 	data []byte
 	tmp  []byte
 }
@@ -174,6 +290,18 @@ func (b *Buffer) Len() int {
 	return len(b.data) / b.f.Width()
 }
 
+// SetDither configures the dither and noise shaping used when samples are added to the Buffer
+// by Append. By default, samples are quantized without dither, like Format.EncodeSigned does.
+//
+// Samples which are already in the Buffer are not affected.
+func (b *Buffer) SetDither(dither Dither, shaping NoiseShaping) {
+	if dither == DitherNone && shaping == NoiseShapingNone {
+		b.q = nil
+		return
+	}
+	b.q = NewQuantizer(b.f, dither, shaping)
+}
+
 // Pop removes n samples from the beginning of the Buffer.
 //
 // Existing Streamers are not affected.
@@ -192,7 +320,7 @@ func (b *Buffer) Append(s Streamer) {
 			break
 		}
 		for _, sample := range samples[:n] {
-			b.f.EncodeSigned(b.tmp, sample)
+			b.f.encode(true, b.tmp, sample, b.q)
 			b.data = append(b.data, b.tmp...)
 		}
 	}
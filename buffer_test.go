@@ -9,6 +9,7 @@ import (
 
 	"github.com/gopxl/beep/v2"
 	"github.com/gopxl/beep/v2/generators"
+	"github.com/gopxl/beep/v2/internal/testtools"
 )
 
 type bufferFormatTestCase struct {
@@ -160,6 +161,62 @@ func TestFormatEncode(t *testing.T) {
 	}
 }
 
+func TestFormatEncoding(t *testing.T) {
+	for _, test := range bufferFormatTests {
+		t.Run(test.Name, func(t *testing.T) {
+			format := beep.Format{
+				SampleRate:  44100,
+				Precision:   test.Precision,
+				NumChannels: test.NumChannels,
+			}
+
+			// Big-endian samples have their bytes reversed.
+			bigEndian := make([]byte, 0, len(test.Bytes))
+			for c := 0; c < test.NumChannels; c++ {
+				for i := test.Precision - 1; i >= 0; i-- {
+					bigEndian = append(bigEndian, test.Bytes[c*test.Precision+i])
+				}
+			}
+
+			for _, bigEndianOrder := range []bool{false, true} {
+				enc := beep.Encoding{Unsigned: !test.Signed, BigEndian: bigEndianOrder}
+				expected := test.Bytes
+				if bigEndianOrder {
+					expected = bigEndian
+				}
+
+				bytes := make([]byte, format.Width())
+				assert.Equal(t, len(expected), format.Encode(enc, bytes, test.Samples))
+				assert.Equal(t, expected, bytes)
+
+				if !test.SkipDecodeTest {
+					sample, n := format.Decode(enc, expected)
+					assert.Equal(t, len(expected), n)
+					assert.Equal(t, test.Samples, sample)
+				}
+			}
+		})
+	}
+}
+
+func TestFormatEncoding_Float(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 4}
+	sample := [2]float64{0.5, -1.5}
+
+	bytes := make([]byte, format.Width())
+	format.Encode(beep.Encoding{Float: true}, bytes, sample)
+	assert.Equal(t, []byte{0x00, 0x00, 0x00, 0x3f, 0x00, 0x00, 0xc0, 0xbf}, bytes, "floats aren't clipped")
+	decoded, _ := format.Decode(beep.Encoding{Float: true}, bytes)
+	assert.Equal(t, sample, decoded)
+
+	format.Precision = 8
+	bytes = make([]byte, format.Width())
+	format.Encode(beep.Encoding{Float: true, BigEndian: true}, bytes, sample)
+	assert.Equal(t, []byte{0x3f, 0xe0, 0, 0, 0, 0, 0, 0, 0xbf, 0xf8, 0, 0, 0, 0, 0, 0}, bytes)
+	decoded, _ = format.Decode(beep.Encoding{Float: true, BigEndian: true}, bytes)
+	assert.Equal(t, sample, decoded)
+}
+
 func TestFormatEncodeDecode(t *testing.T) {
 	formats := make(chan beep.Format)
 	go func() {
@@ -237,3 +294,11 @@ func TestBufferAppendPop(t *testing.T) {
 		}
 	}
 }
+
+func TestBufferStreamer_DoesNotAllocate(t *testing.T) {
+	s, _ := testtools.RandomDataStreamer(10000)
+	b := beep.NewBuffer(beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2})
+	b.Append(s)
+
+	testtools.AssertStreamerDoesNotAllocate(t, b.Streamer(0, b.Len()))
+}
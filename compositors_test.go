@@ -237,3 +237,19 @@ func TestDup(t *testing.T) {
 		}
 	}
 }
+
+func TestCompositors_DoNotAllocate(t *testing.T) {
+	newStreamer := func() beep.StreamSeeker {
+		s, _ := testtools.RandomDataStreamer(10000)
+		return s
+	}
+
+	loop, err := beep.Loop2(newStreamer(), beep.LoopBetween(100, 200))
+	assert.NoError(t, err)
+
+	testtools.AssertStreamerDoesNotAllocate(t, beep.Take(10000, newStreamer()))
+	testtools.AssertStreamerDoesNotAllocate(t, loop)
+	testtools.AssertStreamerDoesNotAllocate(t, beep.Seq(newStreamer()))
+	testtools.AssertStreamerDoesNotAllocate(t, beep.Mix(newStreamer(), newStreamer()))
+	testtools.AssertStreamerDoesNotAllocate(t, &beep.Ctrl{Streamer: newStreamer()})
+}
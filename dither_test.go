@@ -0,0 +1,97 @@
+package beep_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+func TestQuantizer_WithoutDitherMatchesFormat(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	q := beep.NewQuantizer(format, beep.DitherNone, beep.NoiseShapingNone)
+
+	_, data := testtools.RandomDataStreamer(1000)
+	expected := make([]byte, format.Width())
+	actual := make([]byte, format.Width())
+	for _, sample := range data {
+		format.EncodeSigned(expected, sample)
+		q.EncodeSigned(actual, sample)
+		assert.Equal(t, expected, actual)
+
+		format.EncodeUnsigned(expected, sample)
+		q.EncodeUnsigned(actual, sample)
+		assert.Equal(t, expected, actual)
+	}
+}
+
+func TestQuantizer_Dither(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 1, Precision: 1}
+	lsb := 1.0 / (1 << 7)
+
+	for _, shaping := range []beep.NoiseShaping{beep.NoiseShapingNone, beep.NoiseShapingFirstOrder, beep.NoiseShapingLipshitz} {
+		q := beep.NewQuantizer(format, beep.DitherTPDF, shaping)
+
+		// A constant signal at a quarter of the least significant bit is lost completely
+		// when truncated, but survives on average when dithered.
+		const numSamples = 20000
+		x := lsb / 4
+		buf := make([]byte, format.Width())
+		var sum float64
+		nonZero := false
+		for i := 0; i < numSamples; i++ {
+			q.EncodeSigned(buf, [2]float64{x, x})
+			decoded, _ := format.DecodeSigned(buf)
+			sum += decoded[0]
+			if decoded[0] != 0 {
+				nonZero = true
+			}
+			assert.LessOrEqual(t, math.Abs(decoded[0]-x), 8*lsb, "noise shaping: %d", shaping)
+		}
+		assert.True(t, nonZero)
+		assert.InDelta(t, x, sum/numSamples, lsb/10, "noise shaping: %d", shaping)
+
+		format.EncodeSigned(buf, [2]float64{x, x})
+		decoded, _ := format.DecodeSigned(buf)
+		assert.Equal(t, 0.0, decoded[0])
+	}
+}
+
+func TestQuantizer_Reset(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	q := beep.NewQuantizer(format, beep.DitherTPDF, beep.NoiseShapingLipshitz)
+	_, data := testtools.RandomDataStreamer(100)
+
+	encode := func() []byte {
+		var result []byte
+		buf := make([]byte, format.Width())
+		for _, sample := range data {
+			q.EncodeSigned(buf, sample)
+			result = append(result, buf...)
+		}
+		return result
+	}
+
+	first := encode()
+	q.Reset()
+	assert.Equal(t, first, encode())
+}
+
+func TestBuffer_SetDither(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	s, data := testtools.RandomDataStreamer(1000)
+
+	b := beep.NewBuffer(format)
+	b.SetDither(beep.DitherTPDF, beep.NoiseShapingFirstOrder)
+	b.Append(s)
+
+	actual := testtools.Collect(b.Streamer(0, b.Len()))
+	assert.Len(t, actual, len(data))
+	for i := range data {
+		assert.InDelta(t, data[i][0], actual[i][0], 4.0/(1<<15))
+		assert.InDelta(t, data[i][1], actual[i][1], 4.0/(1<<15))
+	}
+}
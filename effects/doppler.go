@@ -1,6 +1,10 @@
 package effects
 
-import "github.com/gopxl/beep/v2"
+import (
+	"slices"
+
+	"github.com/gopxl/beep/v2"
+)
 
 // Doppler simulates a "sound at a distance". If the sound starts at a far distance,
 // it'll take some time to reach the ears of the listener.
@@ -41,10 +45,13 @@ func (d *doppler) Stream(samples [][2]float64) (n int, ok bool) {
 
 	d.r.SetRatio(float64(len(samples)) / float64(len(samples)+difference))
 
-	d.space = append(d.space, make([][2]float64, len(samples)+difference)...)
-	rn, _ := d.r.Stream(d.space[len(d.space)-len(samples)-difference:])
-	d.space = d.space[:len(d.space)-len(samples)-difference+rn]
-	for i := len(d.space) - rn; i < len(d.space); i++ {
+	// Grow the space in place to avoid allocating on every call.
+	toStream := max(len(samples)+difference, 0)
+	start := len(d.space)
+	d.space = slices.Grow(d.space, toStream)[:start+toStream]
+	rn, _ := d.r.Stream(d.space[start:])
+	d.space = d.space[:start+rn]
+	for i := start; i < len(d.space); i++ {
 		d.space[i][0] /= distance * distance
 		d.space[i][1] /= distance * distance
 	}
@@ -53,7 +60,7 @@ func (d *doppler) Stream(samples [][2]float64) (n int, ok bool) {
 		return 0, false
 	}
 	n = copy(samples, d.space)
-	d.space = d.space[n:]
+	d.space = d.space[:copy(d.space, d.space[n:])]
 	return n, true
 }
 
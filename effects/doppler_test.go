@@ -0,0 +1,28 @@
+package effects_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2/effects"
+	"github.com/gopxl/beep/v2/generators"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+func TestDoppler_DoesNotAllocate(t *testing.T) {
+	tone, err := generators.SineTone(44100, 440)
+	assert.NoError(t, err)
+
+	distance := 2.0
+	d := effects.Doppler(2, 44100/343.0, tone, func(delta int) float64 {
+		// Move back and forth between 1 and 3 meters.
+		distance += float64(delta) / 44100
+		if distance > 3 {
+			distance = 1
+		}
+		return distance
+	})
+
+	testtools.AssertStreamerDoesNotAllocate(t, d)
+}
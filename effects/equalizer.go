@@ -15,9 +15,12 @@ type (
 		sections []section
 	}
 
+	// section is a second order IIR filter. The coefficients and the past
+	// input and output values are stored per channel. xPast[c][0] and
+	// yPast[c][0] hold the most recent values.
 	section struct {
-		a, b         [2][]float64
-		xPast, yPast [][2]float64
+		a, b         [2][3]float64
+		xPast, yPast [2][2]float64
 	}
 
 	// EqualizerSections is the interfacd that is passed into NewEqualizer
@@ -98,8 +101,8 @@ func (m StereoEqualizerSections) sections(fs float64) []section {
 // Stream streams the wrapped Streamer modified by Equalizer.
 func (e *equalizer) Stream(samples [][2]float64) (n int, ok bool) {
 	n, ok = e.streamer.Stream(samples)
-	for _, s := range e.sections {
-		s.apply(samples)
+	for i := range e.sections {
+		e.sections[i].apply(samples[:n])
 	}
 	return n, ok
 }
@@ -116,21 +119,21 @@ func (m MonoEqualizerSection) section(fs float64) section {
 		math.Sqrt(math.Abs(math.Pow(math.Pow(10.0, m.G/20.0), 2.0)-
 			math.Pow(math.Pow(10.0, m.GB/20.0), 2.0)))
 
-	b := []float64{
+	b := [3]float64{
 		(math.Pow(10.0, m.G0/20.0) + math.Pow(10.0, m.G/20.0)*beta) / (1 + beta),
 		(-2 * math.Pow(10.0, m.G0/20.0) * math.Cos(m.F0*math.Pi/(fs/2.0))) / (1 + beta),
 		(math.Pow(10.0, m.G0/20) - math.Pow(10.0, m.G/20.0)*beta) / (1 + beta),
 	}
 
-	a := []float64{
+	a := [3]float64{
 		1.0,
 		-2 * math.Cos(m.F0*math.Pi/(fs/2.0)) / (1 + beta),
 		(1 - beta) / (1 + beta),
 	}
 
 	return section{
-		a: [2][]float64{a, a},
-		b: [2][]float64{b, b},
+		a: [2][3]float64{a, a},
+		b: [2][3]float64{b, b},
 	}
 }
 
@@ -139,56 +142,24 @@ func (s StereoEqualizerSection) section(fs float64) section {
 	r := s.Right.section(fs)
 
 	return section{
-		a: [2][]float64{l.a[0], r.a[0]},
-		b: [2][]float64{l.b[0], r.b[0]},
+		a: [2][3]float64{l.a[0], r.a[0]},
+		b: [2][3]float64{l.b[0], r.b[0]},
 	}
 }
 
+// apply filters x in place.
 func (s *section) apply(x [][2]float64) {
-	ord := len(s.a[0]) - 1
-	np := len(x) - 1
+	for i := range x {
+		for c := range x[i] {
+			a, b := &s.a[c], &s.b[c]
+			xp, yp := &s.xPast[c], &s.yPast[c]
 
-	if np < ord {
-		x = append(x, make([][2]float64, ord-np)...)
-		np = ord
-	}
-
-	y := make([][2]float64, len(x))
-
-	if len(s.xPast) < len(x) {
-		s.xPast = append(s.xPast, make([][2]float64, len(x)-len(s.xPast))...)
-	}
-
-	if len(s.yPast) < len(x) {
-		s.yPast = append(s.yPast, make([][2]float64, len(x)-len(s.yPast))...)
-	}
-
-	for i := 0; i < len(x); i++ {
-		for j := 0; j < ord+1; j++ {
-			if i-j < 0 {
-				y[i][0] = y[i][0] + s.b[0][j]*s.xPast[len(s.xPast)-j][0]
-				y[i][1] = y[i][1] + s.b[1][j]*s.xPast[len(s.xPast)-j][1]
-			} else {
-				y[i][0] = y[i][0] + s.b[0][j]*x[i-j][0]
-				y[i][1] = y[i][1] + s.b[1][j]*x[i-j][1]
-			}
-		}
+			y := b[0]*x[i][c] + b[1]*xp[0] + b[2]*xp[1] - a[1]*yp[0] - a[2]*yp[1]
+			y /= a[0]
 
-		for j := 0; j < ord; j++ {
-			if i-j-1 < 0 {
-				y[i][0] = y[i][0] - s.a[0][j+1]*s.yPast[len(s.yPast)-j-1][0]
-				y[i][1] = y[i][1] - s.a[1][j+1]*s.yPast[len(s.yPast)-j-1][1]
-			} else {
-				y[i][0] = y[i][0] - s.a[0][j+1]*y[i-j-1][0]
-				y[i][1] = y[i][1] - s.a[1][j+1]*y[i-j-1][1]
-			}
+			xp[1], xp[0] = xp[0], x[i][c]
+			yp[1], yp[0] = yp[0], y
+			x[i][c] = y
 		}
-
-		y[i][0] = y[i][0] / s.a[0][0]
-		y[i][1] = y[i][1] / s.a[1][0]
 	}
-
-	s.xPast = x[:]
-	s.yPast = y[:]
-	copy(x, y)
 }
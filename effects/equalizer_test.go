@@ -0,0 +1,53 @@
+package effects_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/effects"
+	"github.com/gopxl/beep/v2/generators"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+func TestEqualizer_Gain(t *testing.T) {
+	const sr = beep.SampleRate(44100)
+	sections := effects.MonoEqualizerSections{
+		{F0: 1000, Bf: 200, GB: 3, G0: 0, G: 6},
+	}
+
+	peak := func(freq float64) float64 {
+		tone, err := generators.SineTone(sr, freq)
+		assert.NoError(t, err)
+		eq := effects.NewEqualizer(tone, sr, sections)
+
+		// Skip the transient response of the filter.
+		testtools.CollectNum(sr.N(1e8), eq)
+
+		var p float64
+		for _, s := range testtools.CollectNum(sr.N(1e8), eq) {
+			p = max(p, math.Abs(s[0]), math.Abs(s[1]))
+		}
+		return p
+	}
+
+	// A 6dB boost doubles the amplitude at the center frequency.
+	assert.InDelta(t, 2.0, peak(1000), 0.01)
+	// Frequencies far away from the section aren't affected.
+	assert.InDelta(t, 1.0, peak(10000), 0.01)
+}
+
+func TestEqualizer_DoesNotAllocate(t *testing.T) {
+	tone, err := generators.SineTone(44100, 440)
+	assert.NoError(t, err)
+	eq := effects.NewEqualizer(tone, 44100, effects.StereoEqualizerSections{
+		{
+			Left:  effects.MonoEqualizerSection{F0: 200, Bf: 5, GB: 3, G0: 0, G: 8},
+			Right: effects.MonoEqualizerSection{F0: 250, Bf: 5, GB: 3, G0: 0, G: 8},
+		},
+	})
+
+	testtools.AssertStreamerDoesNotAllocate(t, eq)
+}
@@ -0,0 +1,191 @@
+package effects
+
+import (
+	"math"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// Limiter returns a Streamer which keeps the peaks of s within [-threshold, threshold] by
+// lowering its gain. The sample rate sr must match that of s.
+//
+// The limiter looks ahead by the lookahead duration: the gain is lowered gradually before a peak
+// arrives instead of abruptly when it does, which avoids the distortion of clipping. This delays
+// the audio by the lookahead duration. After a peak, the gain recovers over roughly the release
+// duration.
+//
+// When s is drained, the delayed samples are streamed before the Limiter is drained as well. The
+// returned Streamer propagates s's errors through Err once the delayed samples are streamed.
+func Limiter(s beep.Streamer, sr beep.SampleRate, threshold float64, lookahead, release time.Duration) beep.Streamer {
+	size := max(sr.N(lookahead), 1)
+	l := &limiter{
+		s:         s,
+		threshold: threshold,
+		release:   1,
+		delay:     make([][2]float64, size),
+		minVals:   make([]float64, size),
+		minIdx:    make([]int, size),
+		gains:     make([]float64, size),
+		gain:      1,
+		sum:       float64(size),
+		tail:      size - 1,
+	}
+	if n := float64(sr.N(release)); n > 0 {
+		l.release = 1 - math.Exp(-1/n)
+	}
+	for i := range l.gains {
+		l.gains[i] = 1
+	}
+	return l
+}
+
+type limiter struct {
+	s         beep.Streamer
+	threshold float64
+	release   float64 // coefficient of the exponential gain recovery per sample
+
+	t     int          // number of processed samples
+	delay [][2]float64 // the samples of the lookahead window
+
+	// minVals and minIdx are a ring buffer holding a monotonic queue, used to find the minimum of
+	// the gains required by the samples in the lookahead window.
+	minVals       []float64
+	minIdx        []int
+	minHead, minN int
+
+	// gains holds the last smoothed gains, which are averaged to ramp the gain down.
+	gains []float64
+	gain  float64
+	sum   float64
+
+	ended   bool
+	tail    int  // number of delayed samples left to stream after s is drained
+	drained bool // whether the delayed samples are streamed as well
+}
+
+func (l *limiter) Stream(samples [][2]float64) (n int, ok bool) {
+	for n < len(samples) {
+		if !l.ended {
+			sn, sok := l.s.Stream(samples[n:])
+			for i := n; i < n+sn; i++ {
+				samples[i] = l.process(samples[i])
+			}
+			n += sn
+			if !sok || sn == 0 {
+				l.ended = true
+			}
+			continue
+		}
+		if l.tail == 0 {
+			break
+		}
+		samples[n] = l.process([2]float64{})
+		n++
+		l.tail--
+	}
+	if n == 0 {
+		l.drained = true
+		return 0, false
+	}
+	return n, true
+}
+
+func (l *limiter) Err() error {
+	// An error of s is held back while the delayed samples are streamed.
+	if !l.drained {
+		return nil
+	}
+	return l.s.Err()
+}
+
+// process adds x to the lookahead window and returns the oldest sample of the window with the
+// limiter's gain applied.
+//
+// For the oldest sample, every gain in the averaged history is the minimum over a window which
+// contains that sample, so the applied gain never exceeds the gain the sample requires.
+func (l *limiter) process(x [2]float64) [2]float64 {
+	size := len(l.delay)
+	pos := l.t % size
+
+	required := 1.0
+	if peak := max(math.Abs(x[0]), math.Abs(x[1])); peak > l.threshold {
+		required = l.threshold / peak
+	}
+
+	// Push the required gain to the monotonic queue and drop the values that left the window.
+	for l.minN > 0 && l.minVals[(l.minHead+l.minN-1)%size] >= required {
+		l.minN--
+	}
+	back := (l.minHead + l.minN) % size
+	l.minVals[back], l.minIdx[back] = required, l.t
+	l.minN++
+	for l.minIdx[l.minHead] <= l.t-size {
+		l.minHead = (l.minHead + 1) % size
+		l.minN--
+	}
+	target := l.minVals[l.minHead]
+
+	if target < l.gain {
+		l.gain = target
+	} else {
+		l.gain += (target - l.gain) * l.release
+	}
+
+	l.sum += l.gain - l.gains[pos]
+	l.gains[pos] = l.gain
+	if pos == size-1 {
+		// Recompute the sum now and then, so that rounding errors don't accumulate.
+		l.sum = 0
+		for _, g := range l.gains {
+			l.sum += g
+		}
+	}
+	gain := l.sum / float64(size)
+
+	l.delay[pos] = x
+	y := l.delay[(pos+1)%size]
+	l.t++
+	return [2]float64{y[0] * gain, y[1] * gain}
+}
+
+// softClipKnee is the level above which SoftClip starts compressing the signal.
+const softClipKnee = 0.75
+
+// SoftClip returns a Streamer which saturates the samples of s smoothly instead of clipping them
+// hard at [-1, 1]. Samples within [-0.75, 0.75] pass unchanged. Louder samples are compressed
+// towards ±1, which they never exceed.
+//
+// The returned Streamer propagates s's errors through Err.
+func SoftClip(s beep.Streamer) beep.Streamer {
+	return &softClip{s}
+}
+
+type softClip struct {
+	Streamer beep.Streamer
+}
+
+func (c *softClip) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = c.Streamer.Stream(samples)
+	for i := range samples[:n] {
+		samples[i][0] = softClipSample(samples[i][0])
+		samples[i][1] = softClipSample(samples[i][1])
+	}
+	return n, ok
+}
+
+func (c *softClip) Err() error {
+	return c.Streamer.Err()
+}
+
+func softClipSample(x float64) float64 {
+	const room = 1 - softClipKnee
+	switch {
+	case x > softClipKnee:
+		return softClipKnee + room*math.Tanh((x-softClipKnee)/room)
+	case x < -softClipKnee:
+		return -softClipKnee - room*math.Tanh((-x-softClipKnee)/room)
+	default:
+		return x
+	}
+}
@@ -0,0 +1,94 @@
+package effects_test
+
+import (
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/effects"
+	"github.com/gopxl/beep/v2/generators"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+func TestLimiter_PassesQuietAudioDelayed(t *testing.T) {
+	const sr = beep.SampleRate(1000)
+	s, data := testtools.RandomDataStreamer(500)
+	l := effects.Limiter(s, sr, 1, 10*time.Millisecond, 100*time.Millisecond)
+
+	got := testtools.Collect(l)
+	assert.Len(t, got, 509)
+	testtools.AssertSamplesEqual(t, make([][2]float64, 9), got[:9])
+	testtools.AssertSamplesEqual(t, data, got[9:])
+}
+
+func TestLimiter_ReportsErrorAfterDelayedSamples(t *testing.T) {
+	const sr = beep.SampleRate(1000)
+	s, data := testtools.RandomDataStreamer(500)
+	l := effects.Limiter(testtools.NewDelayedErrorStreamer(s, len(data), io.ErrUnexpectedEOF), sr, 1, 10*time.Millisecond, 100*time.Millisecond)
+
+	var got [][2]float64
+	buf := make([][2]float64, 64)
+	for {
+		n, ok := l.Stream(buf)
+		if !ok {
+			break
+		}
+		got = append(got, buf[:n]...)
+		assert.NoError(t, l.Err(), "the error must be held back until the delayed samples are streamed")
+	}
+	assert.Len(t, got, 509)
+	testtools.AssertSamplesEqual(t, data, got[9:])
+	assert.ErrorIs(t, l.Err(), io.ErrUnexpectedEOF)
+
+	n, ok := l.Stream(buf)
+	assert.Zero(t, n)
+	assert.False(t, ok)
+}
+
+func TestLimiter_KeepsPeaksBelowThreshold(t *testing.T) {
+	const sr = beep.SampleRate(44100)
+	tone, err := generators.SineTone(sr, 440)
+	assert.NoError(t, err)
+
+	// Bursts of a tone at four times the threshold, separated by silence.
+	loud := &effects.Gain{Streamer: tone, Gain: 3}
+	s := beep.Seq(
+		beep.Take(sr.N(100*time.Millisecond), loud),
+		beep.Silence(sr.N(50*time.Millisecond)),
+		beep.Take(sr.N(100*time.Millisecond), loud),
+	)
+	l := effects.Limiter(s, sr, 0.5, 5*time.Millisecond, 50*time.Millisecond)
+
+	var peak float64
+	for _, x := range testtools.Collect(l) {
+		peak = max(peak, math.Abs(x[0]), math.Abs(x[1]))
+	}
+	assert.LessOrEqual(t, peak, 0.5+1e-9)
+	assert.Greater(t, peak, 0.45, "the limiter shouldn't lower the gain more than necessary")
+}
+
+func TestLimiter_DoesNotAllocate(t *testing.T) {
+	s, _ := testtools.RandomDataStreamer(100000)
+	testtools.AssertStreamerDoesNotAllocate(t, effects.Limiter(s, 44100, 0.5, 5*time.Millisecond, 50*time.Millisecond))
+}
+
+func TestSoftClip(t *testing.T) {
+	s := effects.SoftClip(testtools.NewDataStreamer([][2]float64{
+		{0.5, -0.75},
+		{1, -1},
+		{4, -100},
+	}))
+	got := testtools.Collect(s)
+
+	assert.Equal(t, [2]float64{0.5, -0.75}, got[0], "samples below the knee must pass unchanged")
+	assert.Less(t, got[1][0], 1.0)
+	assert.Greater(t, got[1][0], 0.75)
+	assert.Equal(t, -got[1][0], got[1][1])
+	assert.Greater(t, got[2][0], got[1][0])
+	assert.LessOrEqual(t, got[2][0], 1.0)
+	assert.GreaterOrEqual(t, got[2][1], -1.0)
+}
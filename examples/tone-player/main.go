@@ -60,30 +60,18 @@ func main() {
 	// Play 2 seconds of each tone
 	two := sr.N(2 * time.Second)
 
-	ch := make(chan struct{})
-	sounds := []beep.Streamer{
-		beep.Callback(print("sine")),
-		beep.Take(two, sine),
-		beep.Callback(print("triangle")),
-		beep.Take(two, triangle),
-		beep.Callback(print("square")),
-		beep.Take(two, square),
-		beep.Callback(print("sawtooth")),
-		beep.Take(two, sawtooth),
-		beep.Callback(print("sawtooth reversed")),
-		beep.Take(two, sawtoothReversed),
-		beep.Callback(func() {
-			ch <- struct{}{}
-		}),
+	tones := []struct {
+		name     string
+		streamer beep.Streamer
+	}{
+		{"sine", sine},
+		{"triangle", triangle},
+		{"square", square},
+		{"sawtooth", sawtooth},
+		{"sawtooth reversed", sawtoothReversed},
 	}
-	speaker.Play(beep.Seq(sounds...))
-
-	<-ch
-}
-
-// a simple clousure to wrap fmt.Println
-func print(s string) func() {
-	return func() {
-		fmt.Println(s)
+	for _, tone := range tones {
+		fmt.Println(tone.name)
+		speaker.PlayAndWait(beep.Take(two, tone.streamer))
 	}
 }
@@ -27,10 +27,5 @@ func main() {
 
 	resampled := beep.Resample(4, format.SampleRate, sr, streamer)
 
-	done := make(chan bool)
-	speaker.Play(beep.Seq(resampled, beep.Callback(func() {
-		done <- true
-	})))
-
-	<-done
+	speaker.PlayAndWait(resampled)
 }
@@ -6,7 +6,6 @@ import (
 	"os"
 	"time"
 
-	"github.com/gopxl/beep/v2"
 	"github.com/gopxl/beep/v2/mp3"
 	"github.com/gopxl/beep/v2/speaker"
 )
@@ -25,14 +24,11 @@ func main() {
 
 	speaker.Init(format.SampleRate, format.SampleRate.N(time.Second/10))
 
-	done := make(chan bool)
-	speaker.Play(beep.Seq(streamer, beep.Callback(func() {
-		done <- true
-	})))
+	playback := speaker.Start(streamer)
 
 	for {
 		select {
-		case <-done:
+		case <-playback.Done():
 			return
 		case <-time.After(time.Second):
 			speaker.Lock()
@@ -31,14 +31,11 @@ func main() {
 	}
 	fast := beep.ResampleRatio(4, 5, loopStreamer)
 
-	done := make(chan bool)
-	speaker.Play(beep.Seq(fast, beep.Callback(func() {
-		done <- true
-	})))
+	playback := speaker.Start(fast)
 
 	for {
 		select {
-		case <-done:
+		case <-playback.Done():
 			return
 		case <-time.After(time.Second):
 			speaker.Lock()
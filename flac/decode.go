@@ -1,22 +1,45 @@
 package flac
 
 import (
+	"bufio"
+	"fmt"
 	"io"
+	"math"
+	"sort"
 
 	"github.com/mewkiz/flac"
 	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
 	"github.com/pkg/errors"
 
 	"github.com/gopxl/beep/v2"
 )
 
 // Decode takes a Reader containing audio data in FLAC format and returns a StreamSeekCloser,
-// which streams that audio. The Seek method will panic if r is not io.Seeker.
+// which streams that audio.
+//
+// If r is an io.Seeker, Seek jumps close to the position using the SEEKTABLE metadata block if
+// there is one, or the frames decoded so far, and decodes the frames from there. Otherwise, like
+// for HTTP downloads, Seek only seeks forward by decoding and discarding the frames in between
+// and returns an error otherwise. If decoding fails while seeking, Seek returns the error and
+// keeps the position, or leaves it at the last decoded frame if r can't seek.
+//
+// The precision of the format is the number of bytes holding a sample, for example 3 for 20-bit
+// audio, but the samples keep their exact values. Audio with more than two channels is
+// downmixed to stereo, see the channel layouts of the FLAC format. The center channels are
+// mixed into both sides at -3 dB, the surround channels into their side at -3 dB and the LFE
+// channel is dropped. The mix is normalized so that it doesn't clip.
+//
+// The returned StreamSeekCloser implements MetadataStreamer, which provides the tags, pictures
+// and cue sheet.
+//
+// Unlike the WAV decoder, Stream allocates memory, because the mewkiz/flac library does while decoding
+// frames. Wrap the streamer in beep.Prefetch to keep decoding off the audio thread.
 //
 // Do not close the supplied Reader, instead, use the Close method of the returned
 // StreamSeekCloser when you want to release the resources.
 func Decode(r io.Reader) (s beep.StreamSeekCloser, format beep.Format, err error) {
-	d := decoder{r: r}
+	d := decoder{r: r, pr: &positionReader{r: r}}
 	defer func() { // hacky way to always close r if an error occurred
 		if closer, ok := d.r.(io.Closer); ok {
 			if err != nil {
@@ -25,41 +48,158 @@ func Decode(r io.Reader) (s beep.StreamSeekCloser, format beep.Format, err error
 		}
 	}()
 
-	rs, seeker := r.(io.ReadSeeker)
-	if seeker {
-		d.stream, err = flac.NewSeek(rs)
-		d.seekEnabled = true
-	} else {
-		d.stream, err = flac.New(r)
+	if seeker, ok := r.(io.Seeker); ok {
+		// Files like stdin may be pipes which can't seek.
+		if pos, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			d.seeker = seeker
+			d.pr.pos = pos
+		}
 	}
+
+	// The stream reads the frames from br itself, so that the offsets of the frames are known.
+	d.br = bufio.NewReader(d.pr)
+	d.stream, err = flac.Parse(d.br)
 	if err != nil {
 		return nil, beep.Format{}, errors.Wrap(err, "flac")
 	}
+	d.start = d.offset()
+	d.metadata = metadataFromBlocks(d.stream.Blocks)
+	for _, block := range d.stream.Blocks {
+		if table, ok := block.Body.(*meta.SeekTable); ok {
+			d.points = seekPoints(table, d.stream.Info.NSamples)
+		}
+		// The metadata is kept in d.metadata, so the parsed blocks aren't needed anymore.
+		block.Body = nil
+	}
 
 	// Read the first frame
-	d.frame, err = d.stream.ParseNext()
-	if err != nil {
+	if err := d.next(); err != nil {
 		return nil, beep.Format{}, errors.Wrap(err, "flac")
 	}
-	d.hasFixedBlockSize = d.frame.HasFixedBlockSize
 
 	format = beep.Format{
 		SampleRate:  beep.SampleRate(d.stream.Info.SampleRate),
 		NumChannels: int(d.stream.Info.NChannels),
-		Precision:   int(d.stream.Info.BitsPerSample / 8),
+		Precision:   (int(d.stream.Info.BitsPerSample) + 7) / 8,
+	}
+	if format.NumChannels > 2 {
+		d.mix = downmix(format.NumChannels)
 	}
 	return &d, format, nil
 }
 
+// seekPoints returns the points of the seek table which are usable, in order.
+func seekPoints(table *meta.SeekTable, numSamples uint64) []meta.SeekPoint {
+	var points []meta.SeekPoint
+	for _, point := range table.Points {
+		if point.SampleNum == meta.PlaceholderPoint || (numSamples > 0 && point.SampleNum >= numSamples) {
+			continue
+		}
+		if len(points) > 0 && point.SampleNum <= points[len(points)-1].SampleNum {
+			continue
+		}
+		points = append(points, point)
+	}
+	return points
+}
+
+// downmix returns the weights of the channels of the FLAC channel layout with the given number
+// of channels in the left and right channel of the stereo mix.
+func downmix(numChannels int) [][2]float64 {
+	const h = math.Sqrt2 / 2 // -3 dB
+	var mix [][2]float64
+	switch numChannels {
+	case 3: // L, R, C
+		mix = [][2]float64{{1, 0}, {0, 1}, {h, h}}
+	case 4: // L, R, back L, back R
+		mix = [][2]float64{{1, 0}, {0, 1}, {h, 0}, {0, h}}
+	case 5: // L, R, C, back L, back R
+		mix = [][2]float64{{1, 0}, {0, 1}, {h, h}, {h, 0}, {0, h}}
+	case 6: // L, R, C, LFE, back L, back R
+		mix = [][2]float64{{1, 0}, {0, 1}, {h, h}, {0, 0}, {h, 0}, {0, h}}
+	case 7: // L, R, C, LFE, back C, side L, side R
+		mix = [][2]float64{{1, 0}, {0, 1}, {h, h}, {0, 0}, {h * h, h * h}, {h, 0}, {0, h}}
+	default: // L, R, C, LFE, back L, back R, side L, side R
+		mix = [][2]float64{{1, 0}, {0, 1}, {h, h}, {0, 0}, {h, 0}, {0, h}, {h, 0}, {0, h}}
+	}
+	var sum [2]float64
+	for _, w := range mix {
+		sum[0] += w[0]
+		sum[1] += w[1]
+	}
+	for i := range mix {
+		mix[i][0] /= sum[0]
+		mix[i][1] /= sum[1]
+	}
+	return mix
+}
+
 type decoder struct {
-	r           io.Reader
-	stream      *flac.Stream
-	frame       *frame.Frame
-	posInFrame  int
-	err         error
-	seekEnabled bool
+	r      io.Reader
+	pr     *positionReader
+	br     *bufio.Reader
+	seeker io.Seeker // nil if r can't seek
+	start  int64     // offset of the first frame
+	stream *flac.Stream
+	mix    [][2]float64 // weights of the channels if there are more than two
+
+	metadata *Metadata
+
+	// points are the positions of frames to seek to. They come from the seek table, followed by
+	// frames decoded after the last point of the table.
+	points []meta.SeekPoint
+
+	frame      *frame.Frame // nil at the end of the stream
+	frameStart int          // position of the first sample of frame
+	posInFrame int
+	err        error
+}
+
+// positionReader keeps track of the position in r.
+type positionReader struct {
+	r   io.Reader
+	pos int64
+}
+
+func (r *positionReader) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	r.pos += int64(n)
+	return n, err
+}
+
+// offset returns the position in r of the next frame.
+func (d *decoder) offset() int64 {
+	return d.pr.pos - int64(d.br.Buffered())
+}
+
+// next decodes the frame after the current one, or the frame at the position of r if there is
+// no current frame. The frame is nil at the end of the stream. If decoding fails, the current
+// frame is kept.
+func (d *decoder) next() error {
+	offset := d.offset() - d.start
+	f, err := d.stream.ParseNext()
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if d.frame != nil {
+		d.frameStart += int(d.frame.BlockSize)
+	}
+	d.frame = nil
+	d.posInFrame = 0
+	if err == io.EOF {
+		return nil
+	}
+	d.frame = f
 
-	hasFixedBlockSize bool
+	// Frames are remembered about once per second to seek back to them.
+	if n := len(d.points); n == 0 || d.frameStart >= int(d.points[n-1].SampleNum)+int(d.stream.Info.SampleRate) {
+		d.points = append(d.points, meta.SeekPoint{
+			SampleNum: uint64(d.frameStart),
+			Offset:    uint64(offset),
+			NSamples:  f.BlockSize,
+		})
+	}
+	return nil
 }
 
 func (d *decoder) Stream(samples [][2]float64) (n int, ok bool) {
@@ -70,18 +210,13 @@ func (d *decoder) Stream(samples [][2]float64) (n int, ok bool) {
 	for len(samples) > 0 {
 		samplesLeft := int(d.frame.BlockSize) - d.posInFrame
 		if samplesLeft <= 0 {
-			// Read next frame
-			var err error
-			d.frame, err = d.stream.ParseNext()
-			if err != nil {
-				d.frame = nil
-				if err == io.EOF {
-					return n, n > 0
-				}
+			if err := d.next(); err != nil {
 				d.err = errors.Wrap(err, "flac")
 				return 0, false
 			}
-			d.posInFrame = 0
+			if d.frame == nil {
+				return n, n > 0
+			}
 			continue
 		}
 
@@ -100,17 +235,29 @@ func (d *decoder) Stream(samples [][2]float64) (n int, ok bool) {
 func (d *decoder) decodeFrameRangeInto(frame *frame.Frame, start, num int, into [][2]float64) {
 	bps := d.stream.Info.BitsPerSample
 	numChannels := d.stream.Info.NChannels
-	s := 1 << (bps - 1)
-	q := 1 / float64(s)
+	q := math.Ldexp(1, -int(bps-1))
 
-	if numChannels == 1 {
+	switch {
+	case d.mix != nil:
+		for i := range into[:num] {
+			into[i] = [2]float64{}
+		}
+		for c, w := range d.mix {
+			samples := frame.Subframes[c].Samples[start:]
+			for i := 0; i < num; i++ {
+				v := float64(samples[i]) * q
+				into[i][0] += v * w[0]
+				into[i][1] += v * w[1]
+			}
+		}
+	case numChannels == 1:
 		samples1 := frame.Subframes[0].Samples[start:]
 		for i := 0; i < num; i++ {
 			v := float64(samples1[i]) * q
 			into[i][0] = v
 			into[i][1] = v
 		}
-	} else {
+	default:
 		samples1 := frame.Subframes[0].Samples[start:]
 		samples2 := frame.Subframes[1].Samples[start:]
 		for i := 0; i < num; i++ {
@@ -125,74 +272,96 @@ func (d *decoder) Err() error {
 }
 
 func (d *decoder) Len() int {
+	if d.stream.Info.NSamples == 0 {
+		// The length is unknown.
+		return d.Position()
+	}
 	return int(d.stream.Info.NSamples)
 }
 
 func (d *decoder) Position() int {
-	if d.frame == nil {
-		return d.Len()
+	return d.frameStart + d.posInFrame
+}
+
+func (d *decoder) Seek(p int) error {
+	if p < 0 || (d.stream.Info.NSamples > 0 && p > d.Len()) {
+		return fmt.Errorf("flac: seek position %v out of range [%v, %v]", p, 0, d.Len())
+	}
+	if d.frame != nil && d.frameStart <= p && p < d.frameStart+int(d.frame.BlockSize) {
+		d.posInFrame = p - d.frameStart
+		return nil
 	}
 
-	// Temporary workaround until https://github.com/mewkiz/flac/pull/73 is resolved.
-	if d.hasFixedBlockSize {
-		return int(d.frame.Num)*int(d.stream.Info.BlockSizeMax) + d.posInFrame
+	if d.seeker == nil {
+		if p < d.Position() {
+			return errors.New("flac: seek error: can't seek backwards, because the resource isn't io.Seeker")
+		}
+		return d.decodeUntil(p)
 	}
 
-	return int(d.frame.SampleNumber()) + d.posInFrame
-}
+	// If seeking fails, the current frame is restored together with the position of r after it.
+	frame, frameStart, posInFrame, offset := d.frame, d.frameStart, d.posInFrame, d.offset()
 
-func (d *decoder) Seek(p int) error {
-	if !d.seekEnabled {
-		return errors.New("flac.decoder.Seek: not enabled")
-	}
-
-	// Temporary workaround until https://github.com/mewkiz/flac/pull/73 is resolved.
-	// frame.SampleNumber() doesn't work for the last frame of a fixed block size stream
-	// with the result that seeking to that frame doesn't work either. Therefore, if such
-	// a seek is requested, we seek to one of the frames before it and consume until the
-	// desired position is reached.
-	if d.hasFixedBlockSize {
-		lastFrameStartLowerBound := d.Len() - int(d.stream.Info.BlockSizeMax)
-		if p >= lastFrameStartLowerBound {
-			// Seek to & consume an earlier frame.
-			_, err := d.stream.Seek(uint64(lastFrameStartLowerBound - 1))
-			if err != nil {
-				return errors.Wrap(err, "flac")
-			}
-			for {
-				d.frame, err = d.stream.ParseNext()
-				if err != nil {
-					return errors.Wrap(err, "flac")
-				}
-				// Calculate the frame start position manually, because this doesn't
-				// work for the last frame.
-				frameStart := d.frame.Num * uint64(d.stream.Info.BlockSizeMax)
-				if frameStart+uint64(d.frame.BlockSize) >= d.stream.Info.NSamples {
-					// Found the desired frame.
-					d.posInFrame = p - int(frameStart)
-					return nil
-				}
-			}
+	// Jump to the last known frame before p, unless the current frame is closer.
+	i := sort.Search(len(d.points), func(i int) bool {
+		return int(d.points[i].SampleNum) > p
+	})
+	var point meta.SeekPoint // the first frame
+	if i > 0 {
+		point = d.points[i-1]
+	}
+	if p < d.frameStart || int(point.SampleNum) > d.frameStart {
+		if err := d.seekReader(d.start + int64(point.Offset)); err != nil {
+			return errors.Wrap(err, "flac: seek error")
 		}
+		d.frame = nil
+		d.frameStart = int(point.SampleNum)
+		d.posInFrame = 0
 	}
 
-	// d.stream.Seek() doesn't seek to the exact position p, instead
-	// it seeks to the start of the frame p is in. The frame position
-	// is returned and stored in pos.
-	pos, err := d.stream.Seek(uint64(p))
-	if err != nil {
-		return errors.Wrap(err, "flac")
+	if err := d.decodeUntil(p); err != nil {
+		if restoreErr := d.seekReader(offset); restoreErr != nil {
+			return errors.Wrap(restoreErr, "flac: seek error")
+		}
+		d.frame, d.frameStart, d.posInFrame = frame, frameStart, posInFrame
+		return err
 	}
-	d.posInFrame = p - int(pos)
+	return nil
+}
 
-	d.frame, err = d.stream.ParseNext()
-	if err != nil {
-		return errors.Wrap(err, "flac")
+// seekReader moves r to the given offset and discards the buffered data.
+func (d *decoder) seekReader(offset int64) error {
+	if _, err := d.seeker.Seek(offset, io.SeekStart); err != nil {
+		return err
 	}
+	d.pr.pos = offset
+	d.br.Reset(d.pr)
+	return nil
+}
 
+// decodeUntil decodes the frames up to the one containing p and moves to p. If decoding fails,
+// the last decoded frame is kept.
+func (d *decoder) decodeUntil(p int) error {
+	for d.frame == nil || p >= d.frameStart+int(d.frame.BlockSize) {
+		if err := d.next(); err != nil {
+			return errors.Wrap(err, "flac: seek error")
+		}
+		if d.frame == nil {
+			if p == d.frameStart {
+				// The end of the stream.
+				return nil
+			}
+			return fmt.Errorf("flac: seek position %v beyond the end of the audio", p)
+		}
+	}
+	d.posInFrame = p - d.frameStart
 	return nil
 }
 
+func (d *decoder) Metadata() *Metadata {
+	return d.metadata
+}
+
 func (d *decoder) Close() error {
 	if closer, ok := d.r.(io.Closer); ok {
 		err := closer.Close()
@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"io"
 	"log"
+	"math"
 	"os"
 	"testing"
 
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+	"github.com/orcaman/writerseeker"
 	"github.com/stretchr/testify/assert"
 
+	"github.com/gopxl/beep/v2"
 	"github.com/gopxl/beep/v2/flac"
 	"github.com/gopxl/beep/v2/internal/testtools"
 	"github.com/gopxl/beep/v2/wav"
@@ -187,3 +192,226 @@ func BenchmarkDecoder_Stream(b *testing.B) {
 		assert.NoError(b, err)
 	})
 }
+
+// encodeVerbatim encodes the samples of the channels as a single frame without compression. The
+// frame is padded with silence to the minimum block size of 16 samples.
+func encodeVerbatim(t *testing.T, bps int, channels [][]int32) []byte {
+	for i := range channels {
+		for len(channels[i]) < 16 {
+			channels[i] = append(channels[i], 0)
+		}
+	}
+	return encodeFrames(t, bps, true, channels)
+}
+
+// encodeFrames encodes each frame, given as the samples of the channels, without compression.
+func encodeFrames(t *testing.T, bps int, fixedBlockSize bool, frames ...[][]int32) []byte {
+	info := &meta.StreamInfo{
+		BlockSizeMin:  16,
+		BlockSizeMax:  uint16(len(frames[0][0])),
+		SampleRate:    44100,
+		NChannels:     uint8(len(frames[0])),
+		BitsPerSample: uint8(bps),
+	}
+	var w writerseeker.WriterSeeker
+	enc, err := mewkiz_flac.NewEncoder(&w, info)
+	assert.NoError(t, err)
+	for _, channels := range frames {
+		subframes := make([]*frame.Subframe, len(channels))
+		for i, samples := range channels {
+			subframes[i] = &frame.Subframe{
+				SubHeader: frame.SubHeader{Pred: frame.PredVerbatim},
+				Samples:   samples,
+				NSamples:  len(samples),
+			}
+		}
+		err = enc.WriteFrame(&frame.Frame{
+			Header: frame.Header{
+				HasFixedBlockSize: fixedBlockSize,
+				BlockSize:         uint16(len(channels[0])),
+				SampleRate:        info.SampleRate,
+				Channels:          frame.Channels(len(channels) - 1),
+				BitsPerSample:     uint8(bps),
+			},
+			Subframes: subframes,
+		})
+		assert.NoError(t, err)
+	}
+	assert.NoError(t, enc.Close())
+	data, err := io.ReadAll(w.Reader())
+	assert.NoError(t, err)
+	return data
+}
+
+func TestDecoder_OddBitDepth(t *testing.T) {
+	for _, test := range []struct {
+		bps, precision int
+	}{{12, 2}, {20, 3}} {
+		max := int32(1)<<(test.bps-1) - 1
+		data := encodeVerbatim(t, test.bps, [][]int32{
+			{0, 1, -1, max, -max - 1, 12345 % max},
+			{1, 0, 0, 0, 0, -1},
+		})
+		s, format, err := flac.Decode(bytes.NewReader(data))
+		assert.NoError(t, err)
+		assert.Equal(t, beep.Format{SampleRate: 44100, NumChannels: 2, Precision: test.precision}, format)
+
+		q := math.Ldexp(1, -(test.bps - 1))
+		testtools.AssertSamplesEqual(t, [][2]float64{
+			{0, q},
+			{q, 0},
+			{-q, 0},
+			{float64(max) * q, 0},
+			{-1, 0},
+			{float64(12345%max) * q, -q},
+		}, testtools.CollectNum(6, s))
+	}
+}
+
+func TestDecoder_Downmix(t *testing.T) {
+	const h = math.Sqrt2 / 2
+	q := math.Ldexp(1, -15)
+
+	// L, R, C
+	data := encodeVerbatim(t, 16, [][]int32{{1000, 0}, {-1000, 0}, {2000, 4000}})
+	s, format, err := flac.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, format.NumChannels)
+	testtools.AssertSamplesEqual(t, [][2]float64{
+		{(1000 + h*2000) * q / (1 + h), (-1000 + h*2000) * q / (1 + h)},
+		{h * 4000 * q / (1 + h), h * 4000 * q / (1 + h)},
+	}, testtools.CollectNum(2, s))
+
+	// L, R, C, LFE, back L, back R; the LFE channel is dropped.
+	data = encodeVerbatim(t, 16, [][]int32{{1000}, {2000}, {0}, {8000}, {3000}, {-3000}})
+	s, _, err = flac.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	testtools.AssertSamplesEqual(t, [][2]float64{
+		{(1000 + h*3000) * q / (1 + 2*h), (2000 - h*3000) * q / (1 + 2*h)},
+	}, testtools.CollectNum(1, s))
+}
+
+func TestDecoder_SeekVariableBlockSize(t *testing.T) {
+	var (
+		frames   [][][]int32
+		expected [][2]float64
+	)
+	for _, size := range []int{100, 17, 256, 33, 1000, 16} {
+		channel := make([]int32, size)
+		for i := range channel {
+			channel[i] = int32(len(expected))
+			expected = append(expected, [2]float64{float64(len(expected)) / (1 << 15), float64(len(expected)) / (1 << 15)})
+		}
+		frames = append(frames, [][]int32{channel})
+	}
+	data := encodeFrames(t, 16, false, frames...)
+
+	s, _, err := flac.Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	assert.Equal(t, len(expected), s.Len())
+	for _, p := range []int{0, 99, 100, 116, 117, 500, 1421, 1405, 3, len(expected) - 1, len(expected)} {
+		assert.NoError(t, s.Seek(p))
+		assert.Equal(t, p, s.Position())
+		testtools.AssertSamplesEqual(t, expected[p:min(p+50, len(expected))], testtools.CollectNum(50, s))
+	}
+}
+
+// countingReadSeeker counts the bytes read from r.
+type countingReadSeeker struct {
+	r *bytes.Reader
+	n int
+}
+
+func (r *countingReadSeeker) Read(p []byte) (n int, err error) {
+	n, err = r.r.Read(p)
+	r.n += n
+	return n, err
+}
+
+func (r *countingReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return r.r.Seek(offset, whence)
+}
+
+func TestDecoder_SeekTable(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	noise, data := testtools.RandomDataStreamer(100 * 4096)
+	var w writerseeker.WriterSeeker
+	assert.NoError(t, flac.Encode(&w, noise, format, flac.SeekTable(100)))
+	expected := testtools.Collect(beep.FromReader(beep.NewReader(testtools.NewDataStreamer(data), format), format))
+
+	r := &countingReadSeeker{r: w.BytesReader()}
+	s, _, err := flac.Decode(r)
+	assert.NoError(t, err)
+
+	// Only the frame containing the position is read.
+	for _, p := range []int{90*4096 + 5, 10 * 4096, 99*4096 + 4095} {
+		r.n = 0
+		assert.NoError(t, s.Seek(p))
+		assert.Less(t, r.n, 40000)
+		assert.Equal(t, p, s.Position())
+		testtools.AssertSamplesEqual(t, expected[p:min(p+100, len(expected))], testtools.CollectNum(100, s))
+	}
+}
+
+func TestDecoder_SeekWithoutSeeker(t *testing.T) {
+	data, err := os.ReadFile(testtools.TestFilePath("valid_44100hz_22050_samples_ffmpeg.flac"))
+	assert.NoError(t, err)
+	wavFile, err := os.Open(testtools.TestFilePath("valid_44100hz_22050_samples.wav"))
+	assert.NoError(t, err)
+	defer wavFile.Close()
+	wavStream, _, err := wav.Decode(wavFile)
+	assert.NoError(t, err)
+	expected := testtools.Collect(wavStream)
+
+	// The reader hides the Seek method of bytes.Reader.
+	s, _, err := flac.Decode(struct{ io.Reader }{bytes.NewReader(data)})
+	assert.NoError(t, err)
+	assert.Equal(t, len(expected), s.Len())
+
+	for _, p := range []int{100, 5000, 5001, 20000} {
+		assert.NoError(t, s.Seek(p))
+		assert.Equal(t, p, s.Position())
+		testtools.AssertSamplesEqual(t, expected[p:p+10], testtools.CollectNum(10, s))
+	}
+	// Seeking within the current frame works in both directions.
+	assert.NoError(t, s.Seek(20005))
+	assert.NoError(t, s.Seek(20001))
+	testtools.AssertSamplesEqual(t, expected[20001:20011], testtools.CollectNum(10, s))
+
+	assert.Error(t, s.Seek(100))
+	assert.NoError(t, s.Seek(len(expected)))
+	assert.Equal(t, len(expected), s.Position())
+	assert.Empty(t, testtools.Collect(s))
+}
+
+func TestDecoder_SeekError(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	noise, data := testtools.RandomDataStreamer(20 * 4096)
+	var w writerseeker.WriterSeeker
+	assert.NoError(t, flac.Encode(&w, noise, format))
+	expected := testtools.Collect(beep.FromReader(beep.NewReader(testtools.NewDataStreamer(data), format), format))
+	encoded, err := io.ReadAll(w.Reader())
+	assert.NoError(t, err)
+	// The audio ends in the middle of the stream.
+	truncated := encoded[:len(encoded)/2]
+
+	s, _, err := flac.Decode(bytes.NewReader(truncated))
+	assert.NoError(t, err)
+	testtools.CollectNum(5000, s)
+	assert.Error(t, s.Seek(19*4096))
+	assert.Equal(t, 5000, s.Position(), "a failed seek keeps the position")
+	assert.NoError(t, s.Err())
+	testtools.AssertSamplesEqual(t, expected[5000:6000], testtools.CollectNum(1000, s))
+	assert.NoError(t, s.Seek(100))
+	testtools.AssertSamplesEqual(t, expected[100:200], testtools.CollectNum(100, s))
+
+	// Without io.Seeker, the position is left at the last decoded frame.
+	s, _, err = flac.Decode(struct{ io.Reader }{bytes.NewReader(truncated)})
+	assert.NoError(t, err)
+	assert.Error(t, s.Seek(19*4096))
+	assert.NoError(t, s.Err())
+	p := s.Position()
+	assert.Less(t, p, 19*4096)
+	assert.Zero(t, p%4096)
+	testtools.AssertSamplesEqual(t, expected[p:p+100], testtools.CollectNum(100, s))
+}
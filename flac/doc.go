@@ -1,2 +1,2 @@
-// Package flac implements audio data decoding in FLAC format.
+// Package flac implements audio data decoding and encoding in FLAC format.
 package flac
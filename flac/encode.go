@@ -0,0 +1,365 @@
+package flac
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+	"github.com/pkg/errors"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// EncodeOption configures how Encode writes the audio.
+type EncodeOption func(opts *encodeOptions)
+
+type encodeOptions struct {
+	level      int
+	dither     beep.Dither
+	shaping    beep.NoiseShaping
+	seekPoints int
+	metadata   *Metadata
+}
+
+// CompressionLevel sets the compression level from 0, which encodes fastest, to 8, which
+// produces the smallest files. The levels follow those of the reference encoder, the default
+// is 5. All levels are lossless.
+func CompressionLevel(level int) EncodeOption {
+	return func(opts *encodeOptions) {
+		opts.level = level
+	}
+}
+
+// Dither sets the dither and noise shaping used when the samples are quantized to integers.
+// By default, samples are quantized without dither.
+func Dither(dither beep.Dither, shaping beep.NoiseShaping) EncodeOption {
+	return func(opts *encodeOptions) {
+		opts.dither = dither
+		opts.shaping = shaping
+	}
+}
+
+// SeekTable makes Encode write a SEEKTABLE metadata block with up to the given number of seek
+// points, spread evenly over the audio, so that decoders can seek without searching for frames.
+// By default, no seek table is written.
+func SeekTable(points int) EncodeOption {
+	return func(opts *encodeOptions) {
+		opts.seekPoints = points
+	}
+}
+
+// WithMetadata makes Encode write the tags as a VORBIS_COMMENT metadata block, followed by a
+// PICTURE block for each picture and a CUESHEET block if there is a cue sheet.
+func WithMetadata(m *Metadata) EncodeOption {
+	return func(opts *encodeOptions) {
+		opts.metadata = m
+	}
+}
+
+// Encode writes all audio streamed from s to w in FLAC format.
+//
+// Format precision must be 1, 2 or 3 bytes (8, 16 or 24 bits) and there can be 1 to 8
+// channels. The STREAMINFO metadata block, which holds the length and the MD5 signature of the
+// audio, is finalized by seeking back to the start of the stream.
+func Encode(w io.WriteSeeker, s beep.Streamer, format beep.Format, opts ...EncodeOption) (err error) {
+	defer func() {
+		if err != nil {
+			err = errors.Wrap(err, "flac")
+		}
+	}()
+
+	o := encodeOptions{level: 5}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if format.NumChannels <= 0 || format.NumChannels > 8 {
+		return errors.New("invalid number of channels, 1 to 8 are supported")
+	}
+	if format.Precision < 1 || format.Precision > 3 {
+		return errors.New("unsupported precision, 1, 2 or 3 is supported")
+	}
+	if format.SampleRate <= 0 || format.SampleRate > 655350 {
+		return errors.New("unsupported sample rate")
+	}
+	if o.level < 0 || o.level >= len(compressionLevels) {
+		return errors.Errorf("invalid compression level %d, 0 to %d are supported", o.level, len(compressionLevels)-1)
+	}
+	if o.seekPoints < 0 {
+		return errors.New("negative number of seek points")
+	}
+	if err := beep.CheckDither(o.dither, o.shaping); err != nil {
+		return err
+	}
+	level := compressionLevels[o.level]
+
+	start, err := w.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	cw := &countingWriter{w: w, buf: bufio.NewWriter(w), start: start}
+
+	info := &meta.StreamInfo{
+		BlockSizeMin:  uint16(level.blockSize),
+		BlockSizeMax:  uint16(level.blockSize),
+		SampleRate:    uint32(format.SampleRate),
+		NChannels:     uint8(format.NumChannels),
+		BitsPerSample: uint8(format.Precision * 8),
+	}
+	var (
+		blocks []*meta.Block
+		table  *meta.SeekTable
+	)
+	if o.seekPoints > 0 {
+		// The placeholder points are filled in when the offsets of the frames are known.
+		table = &meta.SeekTable{Points: make([]meta.SeekPoint, o.seekPoints)}
+		for i := range table.Points {
+			table.Points[i].SampleNum = meta.PlaceholderPoint
+		}
+		blocks = append(blocks, &meta.Block{
+			Header: meta.Header{Type: meta.TypeSeekTable, Length: int64(18 * o.seekPoints)},
+			Body:   table,
+		})
+	}
+	if o.metadata != nil {
+		metadataBlocks, err := o.metadata.blocks()
+		if err != nil {
+			return err
+		}
+		blocks = append(blocks, metadataBlocks...)
+	}
+
+	enc, err := flac.NewEncoder(cw, info, blocks...)
+	if err != nil {
+		return err
+	}
+	e := &encoder{
+		enc:     enc,
+		format:  format,
+		q:       beep.NewQuantizer(format, o.dither, o.shaping),
+		sub:     subframeEncoder{level: level},
+		samples: make([][2]float64, level.blockSize),
+		buf:     make([]byte, format.Width()),
+		chans:   make([][]int32, format.NumChannels),
+	}
+	for c := range e.chans {
+		e.chans[c] = make([]int32, level.blockSize)
+	}
+
+	firstFrame := cw.pos
+	var frames []meta.SeekPoint
+	for {
+		n := 0
+		for n < level.blockSize {
+			sn, ok := s.Stream(e.samples[n:])
+			if !ok {
+				break
+			}
+			n += sn
+		}
+		if err := s.Err(); err != nil {
+			return err
+		}
+		if n == 0 {
+			break
+		}
+
+		offset := cw.pos
+		if err := e.writeFrame(n); err != nil {
+			return err
+		}
+		size := uint32(cw.pos - offset)
+		if info.FrameSizeMin == 0 || size < info.FrameSizeMin {
+			info.FrameSizeMin = size
+		}
+		info.FrameSizeMax = max(info.FrameSizeMax, size)
+		var sampleNum uint64
+		if len(frames) > 0 {
+			last := frames[len(frames)-1]
+			sampleNum = last.SampleNum + uint64(last.NSamples)
+		}
+		frames = append(frames, meta.SeekPoint{
+			SampleNum: sampleNum,
+			Offset:    uint64(offset - firstFrame),
+			NSamples:  uint16(n),
+		})
+		if n < level.blockSize {
+			break
+		}
+	}
+	end := cw.pos
+
+	// Closing the encoder updates the length and the MD5 signature of the stream info. The
+	// metadata is then written again with the frame sizes and the seek points.
+	minFrame, maxFrame := info.FrameSizeMin, info.FrameSizeMax
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	info.BlockSizeMin = uint16(level.blockSize)
+	info.BlockSizeMax = uint16(level.blockSize)
+	info.FrameSizeMin, info.FrameSizeMax = minFrame, maxFrame
+	if table != nil {
+		fillSeekTable(table, frames)
+	}
+	if _, err := cw.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if _, err := flac.NewEncoder(cw, info, blocks...); err != nil {
+		return err
+	}
+	if _, err := cw.Seek(end, io.SeekStart); err != nil {
+		return err
+	}
+	return cw.buf.Flush()
+}
+
+// fillSeekTable sets the points of the table to the frames containing evenly spaced samples.
+// The points which aren't needed, because the audio has fewer frames, remain placeholders.
+func fillSeekTable(table *meta.SeekTable, frames []meta.SeekPoint) {
+	if len(frames) == 0 {
+		return
+	}
+	last := frames[len(frames)-1]
+	total := last.SampleNum + uint64(last.NSamples)
+	points := table.Points[:0]
+	f := 0
+	for i := range table.Points {
+		target := total * uint64(i) / uint64(len(table.Points))
+		for f+1 < len(frames) && frames[f+1].SampleNum <= target {
+			f++
+		}
+		if len(points) > 0 && points[len(points)-1].SampleNum == frames[f].SampleNum {
+			continue
+		}
+		points = append(points, frames[f])
+	}
+	for i := len(points); i < len(table.Points); i++ {
+		table.Points[i] = meta.SeekPoint{SampleNum: meta.PlaceholderPoint}
+	}
+}
+
+type encoder struct {
+	enc     *flac.Encoder
+	format  beep.Format
+	q       *beep.Quantizer
+	sub     subframeEncoder
+	samples [][2]float64
+	buf     []byte
+	chans   [][]int32
+}
+
+// writeFrame encodes the first n samples as a frame.
+func (e *encoder) writeFrame(n int) error {
+	precision := e.format.Precision
+	for i, sample := range e.samples[:n] {
+		e.q.EncodeSigned(e.buf, sample)
+		for c := range e.chans {
+			p := e.buf[c*precision : (c+1)*precision]
+			var x int32
+			for j := len(p) - 1; j >= 0; j-- {
+				x = x<<8 | int32(p[j])
+			}
+			// sign extension
+			shift := 32 - 8*precision
+			e.chans[c][i] = x << shift >> shift
+		}
+	}
+
+	bps := precision * 8
+	subframes := make([]*frame.Subframe, len(e.chans))
+	for c, samples := range e.chans {
+		subframes[c] = &frame.Subframe{Samples: samples[:n], NSamples: n}
+	}
+	channels := frame.Channels(len(e.chans) - 1)
+	if len(e.chans) == 2 && e.sub.level.stereo {
+		channels = e.encodeStereo(subframes, bps)
+	} else {
+		for _, subframe := range subframes {
+			subframe.SubHeader, _ = e.sub.encode(subframe.Samples, bps)
+		}
+	}
+
+	return e.enc.WriteFrame(&frame.Frame{
+		Header: frame.Header{
+			HasFixedBlockSize: true,
+			BlockSize:         uint16(n),
+			SampleRate:        uint32(e.format.SampleRate),
+			Channels:          channels,
+			BitsPerSample:     uint8(bps),
+		},
+		Subframes: subframes,
+	})
+}
+
+// encodeStereo sets the subframe headers of the left and right channel to the inter-channel
+// decorrelation which needs the fewest bits, and returns that channel assignment. The side
+// channel has an extra bit per sample.
+func (e *encoder) encodeStereo(subframes []*frame.Subframe, bps int) frame.Channels {
+	left, right := subframes[0].Samples, subframes[1].Samples
+	mid := make([]int32, len(left))
+	side := make([]int32, len(left))
+	for i := range left {
+		mid[i] = (left[i] + right[i]) >> 1
+		side[i] = left[i] - right[i]
+	}
+	leftHdr, leftBits := e.sub.encode(left, bps)
+	rightHdr, rightBits := e.sub.encode(right, bps)
+	midHdr, midBits := e.sub.encode(mid, bps)
+	sideHdr, sideBits := e.sub.encode(side, bps+1)
+
+	channels, bits := frame.ChannelsLR, leftBits+rightBits
+	subframes[0].SubHeader, subframes[1].SubHeader = leftHdr, rightHdr
+	if leftBits+sideBits < bits {
+		channels, bits = frame.ChannelsLeftSide, leftBits+sideBits
+		subframes[0].SubHeader, subframes[1].SubHeader = leftHdr, sideHdr
+	}
+	if sideBits+rightBits < bits {
+		channels, bits = frame.ChannelsSideRight, sideBits+rightBits
+		subframes[0].SubHeader, subframes[1].SubHeader = sideHdr, rightHdr
+	}
+	if midBits+sideBits < bits {
+		channels = frame.ChannelsMidSide
+		subframes[0].SubHeader, subframes[1].SubHeader = midHdr, sideHdr
+	}
+	return channels
+}
+
+// countingWriter buffers the writes to w and counts the bytes written. Offsets are relative to
+// the position of w where the stream starts. It doesn't implement io.Closer, so that w isn't
+// closed by the encoder.
+type countingWriter struct {
+	w     io.WriteSeeker
+	buf   *bufio.Writer
+	start int64
+	pos   int64
+}
+
+func (w *countingWriter) Write(p []byte) (n int, err error) {
+	n, err = w.buf.Write(p)
+	w.pos += int64(n)
+	return n, err
+}
+
+func (w *countingWriter) WriteByte(c byte) error {
+	if err := w.buf.WriteByte(c); err != nil {
+		return err
+	}
+	w.pos++
+	return nil
+}
+
+func (w *countingWriter) Seek(offset int64, whence int) (int64, error) {
+	if err := w.buf.Flush(); err != nil {
+		return 0, err
+	}
+	if whence == io.SeekStart {
+		offset += w.start
+	}
+	pos, err := w.w.Seek(offset, whence)
+	if err != nil {
+		return 0, err
+	}
+	w.pos = pos - w.start
+	return w.pos, nil
+}
@@ -0,0 +1,190 @@
+package flac_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"testing"
+
+	mewkiz_flac "github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/meta"
+	"github.com/orcaman/writerseeker"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/flac"
+	"github.com/gopxl/beep/v2/generators"
+	"github.com/gopxl/beep/v2/internal/testtools"
+	"github.com/gopxl/beep/v2/wav"
+)
+
+func TestEncode_Lossless(t *testing.T) {
+	wavFile, err := os.Open(testtools.TestFilePath("valid_44100hz_22050_samples.wav"))
+	assert.NoError(t, err)
+	defer wavFile.Close()
+	wavInfo, err := wavFile.Stat()
+	assert.NoError(t, err)
+
+	wavStream, format, err := wav.Decode(wavFile)
+	assert.NoError(t, err)
+	expected := testtools.Collect(wavStream)
+
+	for level := 0; level <= 8; level++ {
+		t.Run(fmt.Sprintf("level=%d", level), func(t *testing.T) {
+			var w writerseeker.WriterSeeker
+			err := flac.Encode(&w, testtools.NewDataStreamer(expected), format, flac.CompressionLevel(level))
+			assert.NoError(t, err)
+			encoded, err := io.ReadAll(w.Reader())
+			assert.NoError(t, err)
+			assert.Less(t, len(encoded), int(wavInfo.Size()))
+
+			s, f, err := flac.Decode(bytes.NewReader(encoded))
+			assert.NoError(t, err)
+			assert.Equal(t, format, f)
+			assert.Equal(t, len(expected), s.Len())
+			testtools.AssertSamplesEqual(t, expected, testtools.Collect(s))
+		})
+	}
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	for _, precision := range []int{1, 2, 3} {
+		for _, channels := range []int{1, 2, 3} {
+			t.Run(fmt.Sprintf("precision=%d/channels=%d", precision, channels), func(t *testing.T) {
+				format := beep.Format{SampleRate: 48000, NumChannels: channels, Precision: precision}
+				// Noise and a sine, which are encoded verbatim and with prediction.
+				noise, _ := testtools.RandomDataStreamer(5000)
+				sine, err := generators.SineTone(format.SampleRate, 440)
+				assert.NoError(t, err)
+				data := testtools.Collect(beep.Seq(noise, beep.Take(5000, sine)))
+
+				// The encoded samples are the quantized ones.
+				quantized := beep.FromReader(beep.NewReader(testtools.NewDataStreamer(data), format), format)
+				expected := testtools.Collect(quantized)
+				if channels == 3 {
+					// The silent center channel is mixed into both sides.
+					for i := range expected {
+						expected[i][0] /= 1 + math.Sqrt2/2
+						expected[i][1] /= 1 + math.Sqrt2/2
+					}
+				}
+				var w writerseeker.WriterSeeker
+				assert.NoError(t, flac.Encode(&w, testtools.NewDataStreamer(data), format))
+
+				s, f, err := flac.Decode(w.BytesReader())
+				assert.NoError(t, err)
+				assert.Equal(t, format, f)
+				testtools.AssertSamplesEqual(t, expected, testtools.Collect(s))
+			})
+		}
+	}
+}
+
+func TestEncode_StreamInfo(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	s, data := testtools.RandomDataStreamer(10000)
+	var w writerseeker.WriterSeeker
+	assert.NoError(t, flac.Encode(&w, s, format))
+
+	stream, err := mewkiz_flac.New(w.BytesReader())
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(len(data)), stream.Info.NSamples)
+	assert.Equal(t, uint16(4096), stream.Info.BlockSizeMin)
+	assert.Equal(t, uint16(4096), stream.Info.BlockSizeMax)
+	assert.NotZero(t, stream.Info.FrameSizeMin)
+	assert.GreaterOrEqual(t, stream.Info.FrameSizeMax, stream.Info.FrameSizeMin)
+
+	// The signature is the MD5 of the interleaved little-endian samples.
+	pcm, err := io.ReadAll(beep.NewReader(testtools.NewDataStreamer(data), format))
+	assert.NoError(t, err)
+	assert.Equal(t, md5.Sum(pcm), stream.Info.MD5sum)
+}
+
+func TestEncode_Metadata(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	s, _ := testtools.RandomDataStreamer(10000)
+	var w writerseeker.WriterSeeker
+	err := flac.Encode(&w, s, format, flac.CompressionLevel(0), flac.SeekTable(4), flac.WithMetadata(&flac.Metadata{
+		Comments: []flac.Comment{
+			{Field: "TITLE", Value: "Stem"},
+			{Field: "ARTIST", Value: "A"},
+			{Field: "ARTIST", Value: "B"},
+		},
+	}))
+	assert.NoError(t, err)
+
+	stream, err := mewkiz_flac.Parse(w.BytesReader())
+	assert.NoError(t, err)
+	assert.Len(t, stream.Blocks, 2)
+
+	table := stream.Blocks[0].Body.(*meta.SeekTable)
+	assert.Equal(t, []meta.SeekPoint{
+		{SampleNum: 0, Offset: 0, NSamples: 1152},
+		{SampleNum: 2304, Offset: table.Points[1].Offset, NSamples: 1152},
+		{SampleNum: 4608, Offset: table.Points[2].Offset, NSamples: 1152},
+		{SampleNum: 6912, Offset: table.Points[3].Offset, NSamples: 1152},
+	}, table.Points)
+	assert.Less(t, table.Points[1].Offset, table.Points[2].Offset)
+
+	comment := stream.Blocks[1].Body.(*meta.VorbisComment)
+	assert.Equal(t, "gopxl/beep", comment.Vendor)
+	assert.Equal(t, [][2]string{{"TITLE", "Stem"}, {"ARTIST", "A"}, {"ARTIST", "B"}}, comment.Tags)
+
+	// The offsets are relative to the first frame, which follows the metadata blocks. Frames
+	// start with the sync code of fixed block size frames.
+	encoded, err := io.ReadAll(w.Reader())
+	assert.NoError(t, err)
+	firstFrame := 4 + 4 + 34
+	for _, block := range stream.Blocks {
+		firstFrame += 4 + int(block.Length)
+	}
+	for _, point := range table.Points {
+		assert.Equal(t, []byte{0xff, 0xf8}, encoded[firstFrame+int(point.Offset):][:2])
+	}
+}
+
+func TestEncode_SeekTablePlaceholders(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 1, Precision: 2}
+	var w writerseeker.WriterSeeker
+	assert.NoError(t, flac.Encode(&w, generators.Silence(10000), format, flac.SeekTable(3)))
+
+	stream, err := mewkiz_flac.Parse(w.BytesReader())
+	assert.NoError(t, err)
+	table := stream.Blocks[0].Body.(*meta.SeekTable)
+	// The first two points are in the first frame.
+	assert.Equal(t, []meta.SeekPoint{
+		{SampleNum: 0, Offset: 0, NSamples: 4096},
+		{SampleNum: 4096, Offset: table.Points[1].Offset, NSamples: 4096},
+		{SampleNum: meta.PlaceholderPoint},
+	}, table.Points)
+}
+
+func TestEncode_Invalid(t *testing.T) {
+	tests := []struct {
+		format beep.Format
+		opts   []flac.EncodeOption
+	}{
+		{beep.Format{SampleRate: 44100, NumChannels: 0, Precision: 2}, nil},
+		{beep.Format{SampleRate: 44100, NumChannels: 9, Precision: 2}, nil},
+		{beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 4}, nil},
+		{beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}, []flac.EncodeOption{flac.CompressionLevel(9)}},
+		{beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}, []flac.EncodeOption{flac.Dither(beep.DitherTPDF, beep.NoiseShaping(-1))}},
+		{beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}, []flac.EncodeOption{flac.WithMetadata(&flac.Metadata{
+			Comments: []flac.Comment{{Field: "A=B", Value: "C"}},
+		})}},
+	}
+	for _, test := range tests {
+		var w writerseeker.WriterSeeker
+		assert.Error(t, flac.Encode(&w, generators.Silence(10), test.format, test.opts...))
+	}
+}
+
+func TestEncode_StreamerError(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	var w writerseeker.WriterSeeker
+	err := flac.Encode(&w, testtools.NewErrorStreamer(io.ErrUnexpectedEOF), format)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+}
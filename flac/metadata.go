@@ -0,0 +1,297 @@
+package flac
+
+import (
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/meta"
+	"github.com/pkg/errors"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// Metadata holds the tags, pictures and cue sheet of a FLAC stream.
+type Metadata struct {
+	// Vendor identifies the software which wrote the stream.
+	Vendor string
+	// Comments are the tags, like the TITLE and ARTIST of the audio. A field may occur more than
+	// once.
+	Comments []Comment
+	// Pictures are the embedded images, like the cover art.
+	Pictures []Picture
+	// CueSheet is the track layout of the audio, or nil if there is none.
+	CueSheet *CueSheet
+}
+
+// MetadataStreamer is implemented by the StreamSeekCloser returned by Decode. Use a type
+// assertion to get the metadata of the stream:
+//
+//	if ms, ok := s.(flac.MetadataStreamer); ok {
+//		title := ms.Metadata().Comment("TITLE")
+//	}
+type MetadataStreamer interface {
+	beep.StreamSeekCloser
+	// Metadata returns the tags, pictures and cue sheet. The fields are empty if the stream has
+	// none.
+	Metadata() *Metadata
+}
+
+// Comment is a Vorbis comment. Field names are case-insensitive and consist of the printable
+// ASCII characters except '='.
+type Comment struct {
+	Field string
+	Value string
+}
+
+// PictureType is the kind of a Picture, see the APIC frame of ID3v2.
+type PictureType uint32
+
+// Some common picture types.
+const (
+	PictureOther      PictureType = 0
+	PictureFileIcon   PictureType = 1 // 32x32 pixels PNG
+	PictureFrontCover PictureType = 3
+	PictureBackCover  PictureType = 4
+	PictureArtist     PictureType = 8
+)
+
+// Picture is an embedded image.
+type Picture struct {
+	Type PictureType
+	// MIME is the MIME type of the data, like "image/jpeg". The MIME type "-->" means that the
+	// data is the URL of the image.
+	MIME        string
+	Description string
+	// Width and Height are in pixels, Depth is the color depth in bits per pixel and NumColors
+	// is the number of colors of indexed images, 0 otherwise.
+	Width, Height, Depth, NumColors int
+	Data                            []byte
+}
+
+// CueSheet describes the tracks of the audio, like those of a CD.
+type CueSheet struct {
+	// MCN is the media catalog number.
+	MCN string
+	// LeadInSamples is the number of lead-in samples of a CD, 0 otherwise.
+	LeadInSamples int
+	IsCompactDisc bool
+	// Tracks are the tracks in order. The last one is the lead-out track, which is numbered 170
+	// for CDs and 255 otherwise.
+	Tracks []CueTrack
+}
+
+// CueTrack is a track of a CueSheet.
+type CueTrack struct {
+	// Position is the first sample of the track.
+	Position int
+	Number   int
+	// ISRC is the International Standard Recording Code, or "".
+	ISRC           string
+	IsAudio        bool
+	HasPreEmphasis bool
+	// Indices are the index points of the track. The lead-out track has none.
+	Indices []CueIndex
+}
+
+// CueIndex is an index point of a CueTrack.
+type CueIndex struct {
+	// Offset is the position of the index point relative to the position of the track.
+	Offset int
+	Number int
+}
+
+// Comment returns the value of the first comment with the given field name, ignoring case, or
+// "" if there is none.
+func (m *Metadata) Comment(field string) string {
+	for _, c := range m.Comments {
+		if strings.EqualFold(c.Field, field) {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+// ReplayGain is the loudness normalization of a track or an album.
+type ReplayGain struct {
+	// Gain is the gain in dB which brings the audio to the reference loudness.
+	Gain float64
+	// Peak is the largest absolute sample value, 1 being full scale, or 0 if unknown.
+	Peak float64
+}
+
+// Amplitude returns the factor by which the samples are multiplied to apply the gain. It's
+// reduced so that the peak isn't clipped, if the peak is known.
+func (g ReplayGain) Amplitude() float64 {
+	a := math.Pow(10, g.Gain/20)
+	if g.Peak > 0 {
+		a = math.Min(a, 1/g.Peak)
+	}
+	return a
+}
+
+// TrackGain returns the REPLAYGAIN_TRACK_GAIN and REPLAYGAIN_TRACK_PEAK tags. It isn't ok if
+// there is no valid track gain.
+func (m *Metadata) TrackGain() (g ReplayGain, ok bool) {
+	return m.replayGain("REPLAYGAIN_TRACK_GAIN", "REPLAYGAIN_TRACK_PEAK")
+}
+
+// AlbumGain returns the REPLAYGAIN_ALBUM_GAIN and REPLAYGAIN_ALBUM_PEAK tags. It isn't ok if
+// there is no valid album gain.
+func (m *Metadata) AlbumGain() (g ReplayGain, ok bool) {
+	return m.replayGain("REPLAYGAIN_ALBUM_GAIN", "REPLAYGAIN_ALBUM_PEAK")
+}
+
+func (m *Metadata) replayGain(gainField, peakField string) (g ReplayGain, ok bool) {
+	// Gains are written like "-6.54 dB".
+	gain := strings.TrimSpace(m.Comment(gainField))
+	gain = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(gain, "dB"), "db"))
+	var err error
+	g.Gain, err = strconv.ParseFloat(gain, 64)
+	if err != nil {
+		return ReplayGain{}, false
+	}
+	if peak, err := strconv.ParseFloat(strings.TrimSpace(m.Comment(peakField)), 64); err == nil && peak > 0 {
+		g.Peak = peak
+	}
+	return g, true
+}
+
+// ReadMetadata reads the metadata blocks of a FLAC stream from r. The reading stops at the first
+// audio frame, but r may be read further, because it's buffered.
+func ReadMetadata(r io.Reader) (*Metadata, error) {
+	stream, err := flac.Parse(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "flac")
+	}
+	return metadataFromBlocks(stream.Blocks), nil
+}
+
+// metadataFromBlocks returns the metadata held by the parsed metadata blocks.
+func metadataFromBlocks(blocks []*meta.Block) *Metadata {
+	m := new(Metadata)
+	for _, block := range blocks {
+		switch body := block.Body.(type) {
+		case *meta.VorbisComment:
+			m.Vendor = body.Vendor
+			for _, tag := range body.Tags {
+				m.Comments = append(m.Comments, Comment{Field: tag[0], Value: tag[1]})
+			}
+		case *meta.Picture:
+			m.Pictures = append(m.Pictures, Picture{
+				Type:        PictureType(body.Type),
+				MIME:        body.MIME,
+				Description: body.Desc,
+				Width:       int(body.Width),
+				Height:      int(body.Height),
+				Depth:       int(body.Depth),
+				NumColors:   int(body.NPalColors),
+				Data:        body.Data,
+			})
+		case *meta.CueSheet:
+			cs := &CueSheet{
+				MCN:           body.MCN,
+				LeadInSamples: int(body.NLeadInSamples),
+				IsCompactDisc: body.IsCompactDisc,
+			}
+			for _, track := range body.Tracks {
+				t := CueTrack{
+					Position:       int(track.Offset),
+					Number:         int(track.Num),
+					ISRC:           track.ISRC,
+					IsAudio:        track.IsAudio,
+					HasPreEmphasis: track.HasPreEmphasis,
+				}
+				for _, index := range track.Indicies {
+					t.Indices = append(t.Indices, CueIndex{Offset: int(index.Offset), Number: int(index.Num)})
+				}
+				cs.Tracks = append(cs.Tracks, t)
+			}
+			m.CueSheet = cs
+		}
+	}
+	return m
+}
+
+// defaultVendor is the vendor string written if the metadata doesn't set one.
+const defaultVendor = "gopxl/beep"
+
+// blocks returns the metadata blocks holding the comments, the pictures and the cue sheet.
+func (m *Metadata) blocks() ([]*meta.Block, error) {
+	comment := &meta.VorbisComment{Vendor: m.Vendor}
+	if comment.Vendor == "" {
+		comment.Vendor = defaultVendor
+	}
+	length := 4 + len(comment.Vendor) + 4
+	for _, c := range m.Comments {
+		if c.Field == "" {
+			return nil, errors.New("empty comment field name")
+		}
+		for _, r := range c.Field {
+			if r < 0x20 || r > 0x7d || r == '=' {
+				return nil, errors.Errorf("invalid comment field name %q", c.Field)
+			}
+		}
+		comment.Tags = append(comment.Tags, [2]string{c.Field, c.Value})
+		length += 4 + len(c.Field) + 1 + len(c.Value)
+	}
+	blocks := []*meta.Block{{
+		Header: meta.Header{Type: meta.TypeVorbisComment, Length: int64(length)},
+		Body:   comment,
+	}}
+
+	for _, p := range m.Pictures {
+		blocks = append(blocks, &meta.Block{
+			Header: meta.Header{
+				Type:   meta.TypePicture,
+				Length: int64(32 + len(p.MIME) + len(p.Description) + len(p.Data)),
+			},
+			Body: &meta.Picture{
+				Type:       uint32(p.Type),
+				MIME:       p.MIME,
+				Desc:       p.Description,
+				Width:      uint32(p.Width),
+				Height:     uint32(p.Height),
+				Depth:      uint32(p.Depth),
+				NPalColors: uint32(p.NumColors),
+				Data:       p.Data,
+			},
+		})
+	}
+
+	if cs := m.CueSheet; cs != nil {
+		if len(cs.Tracks) == 0 {
+			return nil, errors.New("cue sheet without lead-out track")
+		}
+		body := &meta.CueSheet{
+			MCN:            cs.MCN,
+			NLeadInSamples: uint64(cs.LeadInSamples),
+			IsCompactDisc:  cs.IsCompactDisc,
+		}
+		length := 396
+		for _, t := range cs.Tracks {
+			track := meta.CueSheetTrack{
+				Offset:         uint64(t.Position),
+				Num:            uint8(t.Number),
+				ISRC:           t.ISRC,
+				IsAudio:        t.IsAudio,
+				HasPreEmphasis: t.HasPreEmphasis,
+			}
+			for _, index := range t.Indices {
+				track.Indicies = append(track.Indicies, meta.CueSheetTrackIndex{
+					Offset: uint64(index.Offset),
+					Num:    uint8(index.Number),
+				})
+			}
+			body.Tracks = append(body.Tracks, track)
+			length += 36 + 12*len(t.Indices)
+		}
+		blocks = append(blocks, &meta.Block{
+			Header: meta.Header{Type: meta.TypeCueSheet, Length: int64(length)},
+			Body:   body,
+		})
+	}
+	return blocks, nil
+}
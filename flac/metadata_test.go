@@ -0,0 +1,92 @@
+package flac_test
+
+import (
+	"testing"
+
+	"github.com/orcaman/writerseeker"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/flac"
+	"github.com/gopxl/beep/v2/generators"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+func TestReadMetadata(t *testing.T) {
+	m := &flac.Metadata{
+		Vendor: "test",
+		Comments: []flac.Comment{
+			{Field: "TITLE", Value: "Stem"},
+			{Field: "REPLAYGAIN_TRACK_GAIN", Value: "-6.02 dB"},
+			{Field: "REPLAYGAIN_TRACK_PEAK", Value: "0.25"},
+		},
+		Pictures: []flac.Picture{{
+			Type:        flac.PictureFrontCover,
+			MIME:        "image/png",
+			Description: "cover",
+			Width:       1,
+			Height:      1,
+			Depth:       24,
+			Data:        []byte{1, 2, 3},
+		}},
+		CueSheet: &flac.CueSheet{
+			Tracks: []flac.CueTrack{
+				{Position: 0, Number: 1, ISRC: "ABCDE1234567", IsAudio: true, Indices: []flac.CueIndex{{Offset: 0, Number: 1}}},
+				{Position: 500, Number: 2, IsAudio: true, Indices: []flac.CueIndex{{Offset: 0, Number: 0}, {Offset: 100, Number: 1}}},
+				{Position: 1000, Number: 255},
+			},
+		},
+	}
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	var w writerseeker.WriterSeeker
+	assert.NoError(t, flac.Encode(&w, generators.Silence(1000), format, flac.WithMetadata(m)))
+
+	actual, err := flac.ReadMetadata(w.BytesReader())
+	assert.NoError(t, err)
+	assert.Equal(t, m, actual)
+	assert.Equal(t, "Stem", actual.Comment("title"))
+	assert.Equal(t, "", actual.Comment("ARTIST"))
+
+	d, _, err := flac.Decode(w.BytesReader())
+	assert.NoError(t, err)
+	if assert.Implements(t, (*flac.MetadataStreamer)(nil), d) {
+		assert.Equal(t, m, d.(flac.MetadataStreamer).Metadata())
+	}
+	assert.Len(t, testtools.Collect(d), 1000)
+}
+
+func TestReadMetadata_Empty(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	var w writerseeker.WriterSeeker
+	assert.NoError(t, flac.Encode(&w, generators.Silence(1000), format))
+
+	m, err := flac.ReadMetadata(w.BytesReader())
+	assert.NoError(t, err)
+	assert.Equal(t, &flac.Metadata{}, m)
+
+	d, _, err := flac.Decode(w.BytesReader())
+	assert.NoError(t, err)
+	assert.Equal(t, &flac.Metadata{}, d.(flac.MetadataStreamer).Metadata())
+}
+
+func TestMetadata_ReplayGain(t *testing.T) {
+	m := &flac.Metadata{Comments: []flac.Comment{
+		{Field: "replaygain_track_gain", Value: "+3.5 dB"},
+		{Field: "REPLAYGAIN_TRACK_PEAK", Value: "0.9"},
+		{Field: "REPLAYGAIN_ALBUM_GAIN", Value: "-6"},
+	}}
+
+	g, ok := m.TrackGain()
+	assert.True(t, ok)
+	assert.Equal(t, flac.ReplayGain{Gain: 3.5, Peak: 0.9}, g)
+	// The peak limits the amplitude.
+	assert.InDelta(t, 1/0.9, g.Amplitude(), 1e-9)
+
+	g, ok = m.AlbumGain()
+	assert.True(t, ok)
+	assert.Equal(t, flac.ReplayGain{Gain: -6}, g)
+	assert.InDelta(t, 0.501, g.Amplitude(), 1e-3)
+
+	_, ok = (&flac.Metadata{}).TrackGain()
+	assert.False(t, ok)
+}
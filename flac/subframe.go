@@ -0,0 +1,374 @@
+package flac
+
+import (
+	"math"
+
+	"github.com/mewkiz/flac/frame"
+)
+
+// compressionLevel holds the encoder parameters of a compression level. The levels follow those
+// of the reference encoder.
+type compressionLevel struct {
+	blockSize    int
+	maxLPCOrder  int  // 0 to use fixed predictors only
+	maxPartOrder int  // maximum Rice partition order
+	stereo       bool // try inter-channel decorrelation of stereo audio
+	exhaustive   bool // try all LPC orders instead of estimating the best one
+}
+
+var compressionLevels = [...]compressionLevel{
+	0: {blockSize: 1152, maxPartOrder: 3},
+	1: {blockSize: 1152, maxPartOrder: 3, stereo: true},
+	2: {blockSize: 1152, maxPartOrder: 3, stereo: true},
+	3: {blockSize: 4096, maxLPCOrder: 6, maxPartOrder: 4},
+	4: {blockSize: 4096, maxLPCOrder: 8, maxPartOrder: 4, stereo: true},
+	5: {blockSize: 4096, maxLPCOrder: 8, maxPartOrder: 5, stereo: true},
+	6: {blockSize: 4096, maxLPCOrder: 8, maxPartOrder: 6, stereo: true},
+	7: {blockSize: 4096, maxLPCOrder: 12, maxPartOrder: 6, stereo: true},
+	8: {blockSize: 4096, maxLPCOrder: 12, maxPartOrder: 6, stereo: true, exhaustive: true},
+}
+
+const (
+	maxFixedOrder = 4
+	maxRice1Param = 14 // 15 is the escape code
+	maxRice2Param = 30 // 31 is the escape code
+	maxCoeffShift = 15
+	maxResidual   = 1 << 30 // residuals are rejected beyond this magnitude
+)
+
+// subframeEncoder chooses how the samples of subframes are encoded. It keeps buffers between
+// subframes.
+type subframeEncoder struct {
+	level     compressionLevel
+	residuals []int32
+	sums      []uint64
+	window    []float64
+	windowed  []float64
+}
+
+// encode returns the subframe header which stores samples of bps bits in the fewest bits,
+// along with that number of bits. The size of the common subframe header isn't included.
+func (e *subframeEncoder) encode(samples []int32, bps int) (hdr frame.SubHeader, bits int64) {
+	n := len(samples)
+	constant := true
+	for _, x := range samples[1:] {
+		if x != samples[0] {
+			constant = false
+			break
+		}
+	}
+	if constant {
+		return frame.SubHeader{Pred: frame.PredConstant}, int64(bps)
+	}
+
+	hdr = frame.SubHeader{Pred: frame.PredVerbatim}
+	bits = int64(n) * int64(bps)
+
+	for order := 0; order <= maxFixedOrder && order < n; order++ {
+		residuals, ok := e.predict(samples, frame.FixedCoeffs[order], 0)
+		if !ok {
+			continue
+		}
+		method, rice, riceBits := e.rice(residuals, n, order)
+		// warm-up samples, residual coding method and partition order
+		if b := int64(order*bps) + 6 + riceBits; b < bits {
+			hdr = frame.SubHeader{
+				Pred:                 frame.PredFixed,
+				Order:                order,
+				ResidualCodingMethod: method,
+				RiceSubframe:         rice,
+			}
+			bits = b
+		}
+	}
+
+	maxOrder := e.level.maxLPCOrder
+	if maxOrder == 0 || n <= maxOrder {
+		return hdr, bits
+	}
+	lp, errs := e.lpc(samples, maxOrder)
+	if lp == nil {
+		return hdr, bits
+	}
+	precision := coeffPrecision(n)
+	for _, order := range e.lpcOrders(errs, n, bps, precision) {
+		coeffs, shift, ok := quantizeCoeffs(lp[order-1], precision)
+		if !ok {
+			continue
+		}
+		residuals, ok := e.predict(samples, coeffs, shift)
+		if !ok {
+			continue
+		}
+		method, rice, riceBits := e.rice(residuals, n, order)
+		// warm-up samples, coefficient precision and shift, coefficients, residual coding method
+		// and partition order
+		if b := int64(order*bps) + 9 + int64(order*precision) + 6 + riceBits; b < bits {
+			hdr = frame.SubHeader{
+				Pred:                 frame.PredFIR,
+				Order:                order,
+				ResidualCodingMethod: method,
+				CoeffPrec:            uint(precision),
+				CoeffShift:           shift,
+				Coeffs:               coeffs,
+				RiceSubframe:         rice,
+			}
+			bits = b
+		}
+	}
+	return hdr, bits
+}
+
+// predict returns the residuals of the linear prediction of samples with the given coefficients
+// and shift, the same way the decoder computes them. It isn't ok if a residual is too large to
+// be Rice coded.
+func (e *subframeEncoder) predict(samples, coeffs []int32, shift int32) (residuals []int32, ok bool) {
+	order := len(coeffs)
+	if cap(e.residuals) < len(samples) {
+		e.residuals = make([]int32, len(samples))
+	}
+	residuals = e.residuals[:len(samples)-order]
+	for i := order; i < len(samples); i++ {
+		var prediction int64
+		for j, c := range coeffs {
+			prediction += int64(c) * int64(samples[i-j-1])
+		}
+		r := int64(samples[i]) - prediction>>uint(shift)
+		if r < -maxResidual || r >= maxResidual {
+			return nil, false
+		}
+		residuals[i-order] = int32(r)
+	}
+	return residuals, true
+}
+
+// rice returns the Rice partitioning and parameters of the residuals of a subframe of n samples
+// predicted with the given order which need the fewest bits, along with that number of bits.
+func (e *subframeEncoder) rice(residuals []int32, n, order int) (frame.ResidualCodingMethod, *frame.RiceSubframe, int64) {
+	// Each partition has n / 2^partOrder samples, minus the warm-up samples for the first one.
+	maxPartOrder := e.level.maxPartOrder
+	for maxPartOrder > 0 && (n%(1<<maxPartOrder) != 0 || n>>maxPartOrder <= order) {
+		maxPartOrder--
+	}
+
+	// The sums of the zigzag encoded residuals of the partitions of the highest order are merged
+	// pairwise for the lower orders.
+	if cap(e.sums) < 1<<maxPartOrder {
+		e.sums = make([]uint64, 1<<maxPartOrder)
+	}
+	sums := e.sums[:1<<maxPartOrder]
+	for i := range sums {
+		sums[i] = 0
+	}
+	size := n >> maxPartOrder
+	for i, r := range residuals {
+		sums[(i+order)/size] += uint64(uint32(r<<1) ^ uint32(r>>31))
+	}
+
+	var (
+		best       *frame.RiceSubframe
+		bestMethod frame.ResidualCodingMethod
+		bestBits   int64 = math.MaxInt64
+	)
+	for partOrder := maxPartOrder; partOrder >= 0; partOrder-- {
+		rice := &frame.RiceSubframe{
+			PartOrder:  partOrder,
+			Partitions: make([]frame.RicePartition, 1<<partOrder),
+		}
+		method := frame.ResidualCodingMethodRice1
+		paramBits := int64(4)
+		var bits int64
+		size := n >> partOrder
+		for i := range rice.Partitions {
+			m := size
+			if i == 0 {
+				m -= order
+			}
+			param, b := riceParam(sums[i], m)
+			rice.Partitions[i].Param = param
+			if param > maxRice1Param {
+				method = frame.ResidualCodingMethodRice2
+				paramBits = 5
+			}
+			bits += b
+		}
+		bits += paramBits * int64(len(rice.Partitions))
+		if bits < bestBits {
+			best, bestMethod, bestBits = rice, method, bits
+		}
+		for i := 0; i < len(rice.Partitions)/2; i++ {
+			sums[i] = sums[2*i] + sums[2*i+1]
+		}
+	}
+	return bestMethod, best, bestBits
+}
+
+// riceParam returns the Rice parameter which stores m residuals, whose zigzag encoded values add
+// up to sum, in the fewest bits, and an estimate of that number of bits.
+func riceParam(sum uint64, m int) (param uint, bits int64) {
+	bits = math.MaxInt64
+	for k := uint(0); k <= maxRice2Param; k++ {
+		// Each residual takes k bits, a stop bit and the unary quotient.
+		q := sum >> k
+		if q > math.MaxInt64/2 {
+			continue
+		}
+		if b := int64(m)*int64(k+1) + int64(q); b < bits {
+			param, bits = k, b
+		}
+	}
+	return param, bits
+}
+
+// lpc returns the linear prediction coefficients of the orders 1 to maxOrder of samples and
+// the prediction errors of those orders. It returns nil if the samples can't be predicted.
+func (e *subframeEncoder) lpc(samples []int32, maxOrder int) (lp [][]float64, errs []float64) {
+	n := len(samples)
+	if len(e.window) != n {
+		e.window = tukeyWindow(n, 0.5)
+		e.windowed = make([]float64, n)
+	}
+	for i, x := range samples {
+		e.windowed[i] = float64(x) * e.window[i]
+	}
+
+	autoc := make([]float64, maxOrder+1)
+	for lag := range autoc {
+		var sum float64
+		for i := lag; i < n; i++ {
+			sum += e.windowed[i] * e.windowed[i-lag]
+		}
+		autoc[lag] = sum
+	}
+	if autoc[0] == 0 {
+		return nil, nil
+	}
+
+	// Levinson-Durbin recursion
+	a := make([]float64, maxOrder)
+	err := autoc[0]
+	for i := 0; i < maxOrder; i++ {
+		r := -autoc[i+1]
+		for j := 0; j < i; j++ {
+			r -= a[j] * autoc[i-j]
+		}
+		r /= err
+		a[i] = r
+		for j := 0; j < i/2; j++ {
+			tmp := a[j]
+			a[j] += r * a[i-1-j]
+			a[i-1-j] += r * tmp
+		}
+		if i%2 == 1 {
+			a[i/2] += a[i/2] * r
+		}
+		err *= 1 - r*r
+
+		coeffs := make([]float64, i+1)
+		for j := range coeffs {
+			coeffs[j] = -a[j]
+		}
+		lp = append(lp, coeffs)
+		errs = append(errs, err)
+		if err <= 0 {
+			break
+		}
+	}
+	return lp, errs
+}
+
+// lpcOrders returns the LPC orders worth trying, given the prediction errors of the orders.
+// Unless the search is exhaustive, that is the order with the smallest estimated size.
+func (e *subframeEncoder) lpcOrders(errs []float64, n, bps, precision int) []int {
+	if e.level.exhaustive {
+		orders := make([]int, len(errs))
+		for i := range orders {
+			orders[i] = i + 1
+		}
+		return orders
+	}
+	best, bestBits := 0, math.Inf(1)
+	for i, err := range errs {
+		order := i + 1
+		// The expected bits per residual of a Laplacian distribution with the given variance.
+		var perResidual float64
+		if err > 0 {
+			perResidual = math.Max(0, 0.5*math.Log2(0.5*err/float64(n)))
+		}
+		bits := perResidual*float64(n-order) + float64(order*(bps+precision))
+		if bits < bestBits {
+			best, bestBits = order, bits
+		}
+	}
+	return []int{best}
+}
+
+// coeffPrecision returns the precision in bits of the quantized LPC coefficients for a
+// subframe of n samples.
+func coeffPrecision(n int) int {
+	switch {
+	case n <= 192:
+		return 7
+	case n <= 384:
+		return 8
+	case n <= 576:
+		return 9
+	case n <= 1152:
+		return 10
+	case n <= 2304:
+		return 11
+	case n <= 4608:
+		return 12
+	default:
+		return 13
+	}
+}
+
+// quantizeCoeffs quantizes the LPC coefficients to integers of the given precision, which are
+// scaled by 2^shift. It isn't ok if the coefficients can't be quantized with a valid shift.
+func quantizeCoeffs(lp []float64, precision int) (coeffs []int32, shift int32, ok bool) {
+	qmax := int32(1)<<(precision-1) - 1
+	qmin := -qmax - 1
+
+	var cmax float64
+	for _, c := range lp {
+		cmax = math.Max(cmax, math.Abs(c))
+	}
+	if cmax <= 0 || math.IsInf(cmax, 0) || math.IsNaN(cmax) {
+		return nil, 0, false
+	}
+	_, exp := math.Frexp(cmax)
+	shift = int32(precision - exp - 1)
+	if shift > maxCoeffShift {
+		shift = maxCoeffShift
+	}
+	if shift < 0 {
+		return nil, 0, false
+	}
+
+	// The rounding error is carried over to the next coefficient.
+	coeffs = make([]int32, len(lp))
+	var e float64
+	for i, c := range lp {
+		e += math.Ldexp(c, int(shift))
+		q := int32(math.Round(e))
+		q = max(qmin, min(qmax, q))
+		e -= float64(q)
+		coeffs[i] = q
+	}
+	return coeffs, shift, true
+}
+
+// tukeyWindow returns a Tukey window of n samples whose tapered part is the fraction p of it.
+func tukeyWindow(n int, p float64) []float64 {
+	w := make([]float64, n)
+	for i := range w {
+		w[i] = 1
+	}
+	np := int(p / 2 * float64(n))
+	for i := 0; i < np; i++ {
+		w[i] = 0.5 - 0.5*math.Cos(math.Pi*float64(i)/float64(np))
+		w[n-np+i] = 0.5 - 0.5*math.Cos(math.Pi*float64(i+np)/float64(np))
+	}
+	return w
+}
@@ -76,3 +76,21 @@ func AssertSamplesEqual(t *testing.T, expected, actual [][2]float64) {
 		t.Errorf("the sample data isn't equal to the expected data")
 	}
 }
+
+// AssertStreamerDoesNotAllocate tests whether repeated calls to the Stream method of s allocate
+// memory. The first call is excluded, so that s can set up its buffers. The streamer must be
+// able to stream at least 51 buffers of 64 samples.
+func AssertStreamerDoesNotAllocate(t *testing.T, s beep.Streamer) {
+	t.Helper()
+
+	buf := make([][2]float64, 64)
+	s.Stream(buf)
+	// AllocsPerRun rounds the average down, so all calls are made in a single run to catch
+	// streamers which allocate only occasionally, like decoders at frame boundaries.
+	allocs := testing.AllocsPerRun(1, func() {
+		for i := 0; i < 50; i++ {
+			s.Stream(buf)
+		}
+	})
+	assert.Zero(t, allocs, "the streamer allocated memory while streaming")
+}
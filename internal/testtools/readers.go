@@ -0,0 +1,43 @@
+package testtools
+
+import "io"
+
+// NewFailOnceReader wraps reader r but returns err once after n bytes have been read. The reads
+// continue normally afterwards.
+func NewFailOnceReader(r io.Reader, n int64, err error) io.Reader {
+	return &failOnceReader{r: r, left: n, err: err}
+}
+
+type failOnceReader struct {
+	r    io.Reader
+	left int64
+	err  error
+}
+
+func (f *failOnceReader) Read(p []byte) (n int, err error) {
+	if f.err != nil && f.left == 0 {
+		err, f.err = f.err, nil
+		return 0, err
+	}
+	if f.err != nil {
+		p = p[:min(int64(len(p)), f.left)]
+	}
+	n, err = f.r.Read(p)
+	f.left -= int64(n)
+	return n, err
+}
+
+// NewChunkedReader wraps reader r but returns at most size bytes per Read, like a pipe or a
+// network connection.
+func NewChunkedReader(r io.Reader, size int) io.Reader {
+	return &chunkedReader{r: r, size: size}
+}
+
+type chunkedReader struct {
+	r    io.Reader
+	size int
+}
+
+func (c *chunkedReader) Read(p []byte) (n int, err error) {
+	return c.r.Read(p[:min(len(p), c.size)])
+}
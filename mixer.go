@@ -6,6 +6,7 @@ package beep
 type Mixer struct {
 	streamers     []Streamer
 	stopWhenEmpty bool
+	tmp           [][2]float64
 }
 
 // KeepAlive configures the Mixer to either keep playing silence when all its Streamers have
@@ -40,7 +41,11 @@ func (m *Mixer) Stream(samples [][2]float64) (n int, ok bool) {
 		return 0, false
 	}
 
-	var tmp [512][2]float64
+	// The buffer is kept between calls to avoid allocating on every call.
+	if m.tmp == nil {
+		m.tmp = make([][2]float64, 512)
+	}
+	tmp := m.tmp
 
 	for len(samples) > 0 {
 		toStream := min(len(tmp), len(samples))
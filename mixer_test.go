@@ -137,3 +137,13 @@ func BenchmarkMixer_Silence(b *testing.B) {
 	b.StartTimer()
 	testtools.CollectNum(b.N, &m)
 }
+
+func TestMixer_DoesNotAllocate(t *testing.T) {
+	s1, _ := testtools.RandomDataStreamer(10000)
+	s2, _ := testtools.RandomDataStreamer(10000)
+
+	m := beep.Mixer{}
+	m.Add(s1, s2)
+
+	testtools.AssertStreamerDoesNotAllocate(t, &m)
+}
@@ -1,4 +1,5 @@
-// Package mp3 implements audio data decoding in MP3 format.
+// Package mp3 implements audio data decoding in MP3 format. ID3v1 and ID3v2.2 to ID3v2.4 tags
+// are read as well.
 package mp3
 
 import (
@@ -20,6 +21,12 @@ const (
 // Decode takes a ReadCloser containing audio data in MP3 format and returns a StreamSeekCloser,
 // which streams that audio. The Seek method will panic if rc is not io.Seeker.
 //
+// The returned StreamSeekCloser implements MetadataStreamer, which provides the ID3 tags. The
+// ID3v1 tag at the end of the file is only read if rc is an io.Seeker.
+//
+// Unlike the WAV decoder, Stream allocates memory, because the go-mp3 library does while decoding
+// frames. Wrap the streamer in beep.Prefetch to keep decoding off the audio thread.
+//
 // Do not close the supplied ReadSeekCloser, instead, use the Close method of the returned
 // StreamSeekCloser when you want to release the resources.
 func Decode(rc io.ReadCloser) (s beep.StreamSeekCloser, format beep.Format, err error) {
@@ -28,7 +35,11 @@ func Decode(rc io.ReadCloser) (s beep.StreamSeekCloser, format beep.Format, err
 			err = errors.Wrap(err, "mp3")
 		}
 	}()
-	d, err := gomp3.NewDecoder(rc)
+	m, r, err := readMetadata(rc)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+	d, err := gomp3.NewDecoder(r)
 	if err != nil {
 		return nil, beep.Format{}, err
 	}
@@ -37,39 +48,38 @@ func Decode(rc io.ReadCloser) (s beep.StreamSeekCloser, format beep.Format, err
 		NumChannels: gomp3NumChannels,
 		Precision:   gomp3Precision,
 	}
-	return &decoder{rc, d, format, 0, nil}, format, nil
+	return &decoder{closer: rc, d: d, f: format, metadata: m}, format, nil
 }
 
 type decoder struct {
-	closer io.Closer
-	d      *gomp3.Decoder
-	f      beep.Format
-	pos    int
-	err    error
+	closer   io.Closer
+	d        *gomp3.Decoder
+	f        beep.Format
+	metadata *Metadata
+	pos      int
+	err      error
+	buf      []byte
 }
 
 func (d *decoder) Stream(samples [][2]float64) (n int, ok bool) {
 	if d.err != nil {
 		return 0, false
 	}
-	var tmp [gomp3BytesPerFrame]byte
-	for i := range samples {
-		dn, err := d.d.Read(tmp[:])
-		if dn == len(tmp) {
-			samples[i], _ = d.f.DecodeSigned(tmp[:])
-			d.pos += dn
-			n++
-			ok = true
-		}
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			d.err = errors.Wrap(err, "mp3")
-			break
-		}
+	numBytes := len(samples) * gomp3BytesPerFrame
+	if len(d.buf) < numBytes {
+		d.buf = make([]byte, numBytes)
+	}
+	p := d.buf[:numBytes]
+	dn, err := io.ReadFull(d.d, p)
+	for i := 0; i+gomp3BytesPerFrame <= dn; i += gomp3BytesPerFrame {
+		samples[n], _ = d.f.DecodeSigned(p[i:])
+		n++
 	}
-	return n, ok
+	d.pos += n * gomp3BytesPerFrame
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		d.err = errors.Wrap(err, "mp3")
+	}
+	return n, n > 0
 }
 
 func (d *decoder) Err() error {
@@ -96,6 +106,10 @@ func (d *decoder) Seek(p int) error {
 	return nil
 }
 
+func (d *decoder) Metadata() *Metadata {
+	return d.metadata
+}
+
 func (d *decoder) Close() error {
 	err := d.closer.Close()
 	if err != nil {
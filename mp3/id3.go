@@ -0,0 +1,443 @@
+package mp3
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// readID3v2 reads the ID3v2 tag at the start of r. It returns the bytes it read, which are the
+// tag, or the start of the audio if there is no tag. Malformed frames of the tag are skipped.
+func readID3v2(r io.Reader) (m *Metadata, read []byte, err error) {
+	m = new(Metadata)
+	header := make([]byte, 10)
+	n, err := io.ReadFull(r, header)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return m, header[:n], nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	version, flags := header[3], header[5]
+	if string(header[:3]) != "ID3" || version < 2 || version > 4 || !isSyncsafe(header[6:10]) {
+		return m, header, nil
+	}
+	size := syncsafe(header[6:10])
+	if version == 4 && flags&0x10 != 0 {
+		// footer
+		size += 10
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, nil, err
+	}
+	m.parseID3v2(version, flags, body[:syncsafe(header[6:10])])
+	return m, append(header, body...), nil
+}
+
+func (m *Metadata) parseID3v2(version, flags byte, data []byte) {
+	if version < 4 && flags&0x80 != 0 {
+		data = unsynchronise(data)
+	}
+	if flags&0x40 != 0 {
+		switch {
+		case version == 2:
+			// The flag means that the tag is compressed, with no defined compression.
+			return
+		case len(data) < 4:
+			return
+		case version == 3:
+			// The size excludes itself.
+			data = data[min(4+int(binary.BigEndian.Uint32(data)), len(data)):]
+		default:
+			data = data[min(syncsafe(data[:4]), len(data)):]
+		}
+	}
+	parseFrames(version, data, func(id string, body []byte) {
+		m.parseFrame(version, id, body)
+	})
+}
+
+// parseFrames calls f with the ID and the content of each frame in data. The content is
+// decompressed and encrypted frames are skipped.
+func parseFrames(version byte, data []byte, f func(id string, body []byte)) {
+	headerSize := 10
+	if version == 2 {
+		headerSize = 6
+	}
+	for len(data) >= headerSize && data[0] != 0 {
+		var (
+			id    string
+			size  int
+			flags uint16
+		)
+		switch version {
+		case 2:
+			id = string(data[:3])
+			size = int(data[3])<<16 | int(data[4])<<8 | int(data[5])
+		case 3:
+			id = string(data[:4])
+			size = int(binary.BigEndian.Uint32(data[4:8]))
+			flags = binary.BigEndian.Uint16(data[8:10])
+		default:
+			id = string(data[:4])
+			size = syncsafe(data[4:8])
+			flags = binary.BigEndian.Uint16(data[8:10])
+		}
+		data = data[headerSize:]
+		if size < 0 || size > len(data) || !isFrameID(id) {
+			return
+		}
+		body := data[:size]
+		data = data[size:]
+
+		var compressed, encrypted bool
+		switch version {
+		case 3:
+			compressed, encrypted = flags&0x0080 != 0, flags&0x0040 != 0
+			// The frame starts with the decompressed size, the encryption method and the
+			// group identifier if the flags are set.
+			extra := 0
+			if compressed {
+				extra += 4
+			}
+			if encrypted {
+				extra++
+			}
+			if flags&0x0020 != 0 {
+				extra++
+			}
+			if extra > len(body) {
+				continue
+			}
+			body = body[extra:]
+		case 4:
+			compressed, encrypted = flags&0x0008 != 0, flags&0x0004 != 0
+			extra := 0
+			if flags&0x0040 != 0 {
+				extra++
+			}
+			if encrypted {
+				extra++
+			}
+			if flags&0x0001 != 0 {
+				// data length indicator
+				extra += 4
+			}
+			if extra > len(body) {
+				continue
+			}
+			body = body[extra:]
+			if flags&0x0002 != 0 {
+				body = unsynchronise(body)
+			}
+		}
+		if encrypted {
+			continue
+		}
+		if compressed {
+			zr, err := zlib.NewReader(bytes.NewReader(body))
+			if err != nil {
+				continue
+			}
+			body, err = io.ReadAll(zr)
+			if err != nil {
+				continue
+			}
+		}
+		f(id, body)
+	}
+}
+
+// id3v22IDs maps the common ID3v2.2 frame IDs to the ID3v2.3 ones.
+var id3v22IDs = map[string]string{
+	"TAL": "TALB",
+	"TBP": "TBPM",
+	"TCM": "TCOM",
+	"TCO": "TCON",
+	"TCR": "TCOP",
+	"TEN": "TENC",
+	"TP1": "TPE1",
+	"TP2": "TPE2",
+	"TP3": "TPE3",
+	"TPA": "TPOS",
+	"TPB": "TPUB",
+	"TRK": "TRCK",
+	"TSS": "TSSE",
+	"TT1": "TIT1",
+	"TT2": "TIT2",
+	"TT3": "TIT3",
+	"TXT": "TEXT",
+	"TXX": "TXXX",
+	"TYE": "TYER",
+}
+
+func (m *Metadata) parseFrame(version byte, id string, body []byte) {
+	if version == 2 {
+		if v3, ok := id3v22IDs[id]; ok {
+			id = v3
+		}
+	}
+	switch {
+	case id == "TXXX":
+		if len(body) < 1 {
+			return
+		}
+		description, value := splitText(body[0], body[1:])
+		m.setText("TXXX:"+decodeText(body[0], description), textValue(body[0], value))
+	case id[0] == 'T':
+		if len(body) < 1 {
+			return
+		}
+		m.setText(id, textValue(body[0], body[1:]))
+	case id == "APIC":
+		if len(body) < 1 {
+			return
+		}
+		mime, rest := splitText(0, body[1:])
+		if len(rest) < 1 {
+			return
+		}
+		description, data := splitText(body[0], rest[1:])
+		m.Pictures = append(m.Pictures, Picture{
+			Type:        PictureType(rest[0]),
+			MIME:        decodeText(0, mime),
+			Description: decodeText(body[0], description),
+			Data:        data,
+		})
+	case id == "PIC":
+		if len(body) < 5 {
+			return
+		}
+		description, data := splitText(body[0], body[5:])
+		m.Pictures = append(m.Pictures, Picture{
+			Type:        PictureType(body[4]),
+			MIME:        imageMIME(string(body[1:4])),
+			Description: decodeText(body[0], description),
+			Data:        data,
+		})
+	case id == "CHAP":
+		elementID, rest := splitText(0, body)
+		if len(rest) < 16 {
+			return
+		}
+		m.Chapters = append(m.Chapters, Chapter{
+			ID:    decodeText(0, elementID),
+			Start: time.Duration(binary.BigEndian.Uint32(rest[0:4])) * time.Millisecond,
+			End:   time.Duration(binary.BigEndian.Uint32(rest[4:8])) * time.Millisecond,
+			// The byte offsets which follow the times are ignored, they are often unset.
+			Title: subframeTitle(version, rest[16:]),
+		})
+	case id == "CTOC":
+		elementID, rest := splitText(0, body)
+		if len(rest) < 2 {
+			return
+		}
+		toc := TableOfContents{
+			ID:       decodeText(0, elementID),
+			TopLevel: rest[0]&0x02 != 0,
+			Ordered:  rest[0]&0x01 != 0,
+		}
+		count := int(rest[1])
+		rest = rest[2:]
+		for i := 0; i < count && len(rest) > 0; i++ {
+			var child []byte
+			child, rest = splitText(0, rest)
+			toc.Children = append(toc.Children, decodeText(0, child))
+		}
+		toc.Title = subframeTitle(version, rest)
+		m.TablesOfContents = append(m.TablesOfContents, toc)
+	case id == "RVA2":
+		identification, rest := splitText(0, body)
+		for len(rest) >= 4 {
+			channel := rest[0]
+			adjustment := int16(binary.BigEndian.Uint16(rest[1:3]))
+			peakBytes := (int(rest[3]) + 7) / 8
+			if channel == 1 {
+				// master volume, in 1/512 dB
+				if m.volumes == nil {
+					m.volumes = make(map[string]float64)
+				}
+				m.volumes[strings.ToLower(decodeText(0, identification))] = float64(adjustment) / 512
+			}
+			rest = rest[min(4+peakBytes, len(rest)):]
+		}
+	}
+}
+
+// setText stores the value of a text frame and sets the fields it belongs to.
+func (m *Metadata) setText(id, value string) {
+	if m.Text == nil {
+		m.Text = make(map[string]string)
+	}
+	m.Text[id] = value
+	switch id {
+	case "TIT2":
+		m.Title = value
+	case "TPE1":
+		m.Artist = value
+	case "TALB":
+		m.Album = value
+	case "TRCK":
+		// The track may be followed by the number of tracks, like "3/12".
+		track, total, _ := strings.Cut(value, "/")
+		m.Track, _ = strconv.Atoi(strings.TrimSpace(track))
+		m.TrackTotal, _ = strconv.Atoi(strings.TrimSpace(total))
+	}
+}
+
+// subframeTitle returns the title of the TIT2 frame embedded in a CHAP or CTOC frame.
+func subframeTitle(version byte, data []byte) (title string) {
+	parseFrames(version, data, func(id string, body []byte) {
+		if (id == "TIT2" || id == "TT2") && len(body) > 0 {
+			title = textValue(body[0], body[1:])
+		}
+	})
+	return title
+}
+
+// imageMIME returns the MIME type of an ID3v2.2 image format, like "JPG".
+func imageMIME(format string) string {
+	switch strings.ToUpper(format) {
+	case "JPG":
+		return "image/jpeg"
+	case "-->":
+		return format
+	default:
+		return "image/" + strings.ToLower(format)
+	}
+}
+
+// readID3v1 reads the ID3v1 tag at the end of r and sets the fields which the ID3v2 tag didn't.
+// It leaves r at an arbitrary position.
+func (m *Metadata) readID3v1(r io.Reader, seeker io.Seeker) error {
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil || end < 128 {
+		return err
+	}
+	if _, err := seeker.Seek(end-128, io.SeekStart); err != nil {
+		return err
+	}
+	tag := make([]byte, 128)
+	if _, err := io.ReadFull(r, tag); err != nil {
+		return err
+	}
+	if string(tag[:3]) != "TAG" {
+		return nil
+	}
+	field := func(b []byte) string {
+		if i := bytes.IndexByte(b, 0); i >= 0 {
+			b = b[:i]
+		}
+		return strings.TrimRight(decodeText(0, b), " ")
+	}
+	if m.Title == "" {
+		m.Title = field(tag[3:33])
+	}
+	if m.Artist == "" {
+		m.Artist = field(tag[33:63])
+	}
+	if m.Album == "" {
+		m.Album = field(tag[63:93])
+	}
+	// ID3v1.1 stores the track in the last byte of the comment.
+	if m.Track == 0 && tag[125] == 0 {
+		m.Track = int(tag[126])
+	}
+	return nil
+}
+
+// textValue decodes the values of a text frame, separating multiple values by "/".
+func textValue(encoding byte, b []byte) string {
+	var values []string
+	for len(b) > 0 {
+		var value []byte
+		value, b = splitText(encoding, b)
+		values = append(values, decodeText(encoding, value))
+	}
+	return strings.Join(values, "/")
+}
+
+// splitText splits b at the first null terminator of the text encoding.
+func splitText(encoding byte, b []byte) (text, rest []byte) {
+	if encoding == 1 || encoding == 2 {
+		// UTF-16 has a 2-byte terminator.
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return b[:i], b[i+2:]
+			}
+		}
+		return b, nil
+	}
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		return b[:i], b[i+1:]
+	}
+	return b, nil
+}
+
+// decodeText decodes ISO-8859-1 (0), UTF-16 with byte order mark (1), UTF-16BE (2) or
+// UTF-8 (3) text.
+func decodeText(encoding byte, b []byte) string {
+	switch encoding {
+	case 0:
+		runes := make([]rune, len(b))
+		for i, c := range b {
+			runes[i] = rune(c)
+		}
+		return string(runes)
+	case 1, 2:
+		order := binary.ByteOrder(binary.BigEndian)
+		if encoding == 1 && len(b) >= 2 {
+			switch {
+			case b[0] == 0xff && b[1] == 0xfe:
+				order, b = binary.LittleEndian, b[2:]
+			case b[0] == 0xfe && b[1] == 0xff:
+				b = b[2:]
+			}
+		}
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = order.Uint16(b[2*i:])
+		}
+		return string(utf16.Decode(units))
+	default:
+		return string(b)
+	}
+}
+
+// unsynchronise removes the zero bytes which the unsynchronisation scheme inserts after 0xff
+// bytes.
+func unsynchronise(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xff && i+1 < len(b) && b[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
+
+// syncsafe decodes a 4-byte syncsafe integer, which has 7 bits per byte.
+func syncsafe(b []byte) int {
+	return int(b[0])<<21 | int(b[1])<<14 | int(b[2])<<7 | int(b[3])
+}
+
+func isSyncsafe(b []byte) bool {
+	return (b[0]|b[1]|b[2]|b[3])&0x80 == 0
+}
+
+// isFrameID reports whether id consists of upper-case letters and digits.
+func isFrameID(id string) bool {
+	for _, c := range []byte(id) {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,188 @@
+package mp3
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// MetadataStreamer is implemented by the StreamSeekCloser returned by Decode. Use a type
+// assertion to get the ID3 tags of the file:
+//
+//	if ms, ok := s.(mp3.MetadataStreamer); ok {
+//		title := ms.Metadata().Title
+//	}
+type MetadataStreamer interface {
+	beep.StreamSeekCloser
+	// Metadata returns the ID3 tags. The fields are empty if the file has no tags.
+	Metadata() *Metadata
+}
+
+// Metadata holds the ID3v2 and ID3v1 tags of an MP3 file. The ID3v2 tag takes precedence over
+// the ID3v1 tag.
+type Metadata struct {
+	Title  string
+	Artist string
+	Album  string
+	// Track is the track number and TrackTotal the number of tracks of the album, 0 if unknown.
+	Track, TrackTotal int
+	// Text holds the values of all text frames of the ID3v2 tag by frame ID, like "TIT2" for the
+	// title. Values of TXXX frames are stored under "TXXX:" followed by their description. The
+	// common ID3v2.2 frame IDs are converted to their ID3v2.3 counterparts. Multiple values of a
+	// frame are separated by "/".
+	Text     map[string]string
+	Pictures []Picture
+	Chapters []Chapter
+	// TablesOfContents are the CTOC frames, which arrange the chapters.
+	TablesOfContents []TableOfContents
+
+	volumes map[string]float64 // master volume adjustments of RVA2 frames by identification
+}
+
+// PictureType is the kind of a Picture.
+type PictureType byte
+
+// Some common picture types.
+const (
+	PictureOther      PictureType = 0
+	PictureFileIcon   PictureType = 1 // 32x32 pixels PNG
+	PictureFrontCover PictureType = 3
+	PictureBackCover  PictureType = 4
+	PictureArtist     PictureType = 8
+)
+
+// Picture is an embedded image, an APIC or PIC frame.
+type Picture struct {
+	Type PictureType
+	// MIME is the MIME type of the data, like "image/jpeg". The MIME type "-->" means that the
+	// data is the URL of the image.
+	MIME        string
+	Description string
+	Data        []byte
+}
+
+// Chapter is a CHAP frame.
+type Chapter struct {
+	// ID identifies the chapter in the tables of contents.
+	ID         string
+	Start, End time.Duration
+	Title      string
+}
+
+// TableOfContents is a CTOC frame.
+type TableOfContents struct {
+	ID string
+	// TopLevel is true for the root of the tables of contents.
+	TopLevel bool
+	// Ordered is true if the children are in playback order.
+	Ordered bool
+	// Children are the IDs of the chapters and tables of contents the table contains.
+	Children []string
+	Title    string
+}
+
+// ReplayGain is the loudness normalization of a track or an album.
+type ReplayGain struct {
+	// Gain is the gain in dB which brings the audio to the reference loudness.
+	Gain float64
+	// Peak is the largest absolute sample value, 1 being full scale, or 0 if unknown.
+	Peak float64
+}
+
+// Amplitude returns the factor by which the samples are multiplied to apply the gain. It's
+// reduced so that the peak isn't clipped, if the peak is known.
+func (g ReplayGain) Amplitude() float64 {
+	a := math.Pow(10, g.Gain/20)
+	if g.Peak > 0 {
+		a = math.Min(a, 1/g.Peak)
+	}
+	return a
+}
+
+// TrackGain returns the track gain of the REPLAYGAIN_TRACK_GAIN and REPLAYGAIN_TRACK_PEAK TXXX
+// frames, or else of an RVA2 frame identified as "track". It isn't ok if there is neither.
+func (m *Metadata) TrackGain() (g ReplayGain, ok bool) {
+	return m.replayGain("track")
+}
+
+// AlbumGain returns the album gain of the REPLAYGAIN_ALBUM_GAIN and REPLAYGAIN_ALBUM_PEAK TXXX
+// frames, or else of an RVA2 frame identified as "album". It isn't ok if there is neither.
+func (m *Metadata) AlbumGain() (g ReplayGain, ok bool) {
+	return m.replayGain("album")
+}
+
+func (m *Metadata) replayGain(kind string) (g ReplayGain, ok bool) {
+	// Gains are written like "-6.54 dB".
+	gain := strings.TrimSpace(m.userText("REPLAYGAIN_" + kind + "_GAIN"))
+	gain = strings.TrimSpace(strings.TrimSuffix(strings.TrimSuffix(gain, "dB"), "db"))
+	var err error
+	if g.Gain, err = strconv.ParseFloat(gain, 64); err == nil {
+		peak, err := strconv.ParseFloat(strings.TrimSpace(m.userText("REPLAYGAIN_"+kind+"_PEAK")), 64)
+		if err == nil && peak > 0 {
+			g.Peak = peak
+		}
+		return g, true
+	}
+	if v, ok := m.volumes[kind]; ok {
+		return ReplayGain{Gain: v}, true
+	}
+	return ReplayGain{}, false
+}
+
+// userText returns the value of the TXXX frame with the given description, ignoring case.
+func (m *Metadata) userText(description string) string {
+	for id, value := range m.Text {
+		if strings.HasPrefix(id, "TXXX:") && strings.EqualFold(id[5:], description) {
+			return value
+		}
+	}
+	return ""
+}
+
+// ReadMetadata reads the ID3v2 tag at the start of r. If r is an io.Seeker, the ID3v1 tag at the
+// end of r is read as well and r is returned to its position.
+func ReadMetadata(r io.Reader) (*Metadata, error) {
+	m, _, err := readMetadata(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "mp3")
+	}
+	return m, nil
+}
+
+// readMetadata reads the ID3 tags of r like ReadMetadata. It returns a reader which reads all of
+// r from its original position.
+func readMetadata(r io.Reader) (m *Metadata, all io.Reader, err error) {
+	var (
+		seeker io.Seeker
+		start  int64
+	)
+	if s, ok := r.(io.Seeker); ok {
+		// Files like stdin may be pipes which can't seek.
+		if pos, err := s.Seek(0, io.SeekCurrent); err == nil {
+			seeker, start = s, pos
+		}
+	}
+
+	m, read, err := readID3v2(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if seeker == nil {
+		// The ID3v1 tag at the end can't be read before the audio.
+		return m, io.MultiReader(bytes.NewReader(read), r), nil
+	}
+	if err := m.readID3v1(r, seeker); err != nil {
+		return nil, nil, err
+	}
+	if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	return m, r, nil
+}
@@ -0,0 +1,247 @@
+package mp3_test
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2/internal/testtools"
+	"github.com/gopxl/beep/v2/mp3"
+)
+
+func syncsafe(n int) []byte {
+	return []byte{byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+}
+
+// frame returns an ID3v2.3 frame, or an ID3v2.4 frame if version is 4.
+func frame(version byte, id string, flags uint16, body ...[]byte) []byte {
+	b := bytes.Join(body, nil)
+	f := []byte(id)
+	if version == 4 {
+		f = append(f, syncsafe(len(b))...)
+	} else {
+		f = binary.BigEndian.AppendUint32(f, uint32(len(b)))
+	}
+	f = binary.BigEndian.AppendUint16(f, flags)
+	return append(f, b...)
+}
+
+// frame22 returns an ID3v2.2 frame.
+func frame22(id string, body ...[]byte) []byte {
+	b := bytes.Join(body, nil)
+	return append([]byte{id[0], id[1], id[2], byte(len(b) >> 16), byte(len(b) >> 8), byte(len(b))}, b...)
+}
+
+func tag(version, flags byte, frames ...[]byte) []byte {
+	b := bytes.Join(frames, nil)
+	// padding
+	b = append(b, make([]byte, 16)...)
+	return append(append([]byte{'I', 'D', '3', version, 0, flags}, syncsafe(len(b))...), b...)
+}
+
+// unsynchronise inserts a zero byte after each 0xff byte which is followed by a zero byte or
+// a byte that would form a false MPEG sync.
+func unsynchronise(b []byte) []byte {
+	var out []byte
+	for i, c := range b {
+		out = append(out, c)
+		if c == 0xff && (i+1 == len(b) || b[i+1] == 0 || b[i+1] >= 0xe0) {
+			out = append(out, 0)
+		}
+	}
+	return out
+}
+
+func id3v1(title, artist string, track byte) []byte {
+	b := make([]byte, 128)
+	copy(b, "TAG")
+	copy(b[3:33], title)
+	copy(b[33:63], artist)
+	copy(b[63:93], "ID3v1 Album")
+	b[126] = track
+	return b
+}
+
+func utf16LE(s string) []byte {
+	b := []byte{0xff, 0xfe}
+	for _, r := range s {
+		b = append(b, byte(r), 0)
+	}
+	return b
+}
+
+func TestReadMetadata_ID3v24(t *testing.T) {
+	b := tag(4, 0,
+		frame(4, "TIT2", 0, []byte{3}, []byte("Tïtle")),
+		frame(4, "TPE1", 0, []byte{1}, utf16LE("A"), []byte{0, 0}, utf16LE("B")),
+		frame(4, "TALB", 0, []byte{0, 'A', 'l', 'b', 0xfc, 'm'}),
+		frame(4, "TRCK", 0, []byte{0}, []byte("3/12")),
+		frame(4, "TXXX", 0, []byte{0}, []byte("replaygain_track_gain\x00-6.54 dB")),
+		frame(4, "TXXX", 0, []byte{0}, []byte("REPLAYGAIN_TRACK_PEAK\x000.9")),
+		frame(4, "APIC", 0, []byte{0}, []byte("image/png\x00"), []byte{3}, []byte("Cover\x00"), []byte{1, 2, 3}),
+		frame(4, "CTOC", 0, []byte("toc\x00"), []byte{0x03, 2}, []byte("ch1\x00ch2\x00"),
+			frame(4, "TIT2", 0, []byte{3}, []byte("Contents"))),
+		frame(4, "CHAP", 0, []byte("ch1\x00"), []byte{0, 0, 0, 0, 0, 0, 0x03, 0xe8}, bytes.Repeat([]byte{0xff}, 8),
+			frame(4, "TIT2", 0, []byte{3}, []byte("One"))),
+		frame(4, "CHAP", 0, []byte("ch2\x00"), []byte{0, 0, 0x03, 0xe8, 0, 0, 0x07, 0xd0}, bytes.Repeat([]byte{0xff}, 8)),
+		// unsynchronised and with a data length indicator
+		frame(4, "TCON", 0x0003, syncsafe(3), []byte{0, 0xff, 0x00, 'x'}),
+		// encrypted frames are skipped
+		frame(4, "TIT3", 0x0004, []byte{1, 0, 'x'}),
+	)
+	m, err := mp3.ReadMetadata(bytes.NewReader(b))
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Tïtle", m.Title)
+	assert.Equal(t, "A/B", m.Artist)
+	assert.Equal(t, "Albüm", m.Album)
+	assert.Equal(t, 3, m.Track)
+	assert.Equal(t, 12, m.TrackTotal)
+	assert.Equal(t, "ÿx", m.Text["TCON"])
+	assert.NotContains(t, m.Text, "TIT3")
+
+	g, ok := m.TrackGain()
+	assert.True(t, ok)
+	assert.Equal(t, mp3.ReplayGain{Gain: -6.54, Peak: 0.9}, g)
+	_, ok = m.AlbumGain()
+	assert.False(t, ok)
+
+	assert.Equal(t, []mp3.Picture{{
+		Type:        mp3.PictureFrontCover,
+		MIME:        "image/png",
+		Description: "Cover",
+		Data:        []byte{1, 2, 3},
+	}}, m.Pictures)
+	assert.Equal(t, []mp3.Chapter{
+		{ID: "ch1", Start: 0, End: time.Second, Title: "One"},
+		{ID: "ch2", Start: time.Second, End: 2 * time.Second},
+	}, m.Chapters)
+	assert.Equal(t, []mp3.TableOfContents{{
+		ID:       "toc",
+		TopLevel: true,
+		Ordered:  true,
+		Children: []string{"ch1", "ch2"},
+		Title:    "Contents",
+	}}, m.TablesOfContents)
+}
+
+func TestReadMetadata_ID3v23(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	_, _ = zw.Write([]byte("\x00Compressed"))
+	assert.NoError(t, zw.Close())
+
+	b := tag(3, 0x80, unsynchronise(bytes.Join([][]byte{
+		frame(3, "TIT2", 0, []byte{1}, utf16LE("Title"), []byte{0, 0}),
+		frame(3, "TALB", 0x0080, []byte{0, 0, 0, 11}, compressed.Bytes()),
+		frame(3, "TPE1", 0, []byte{0, 'A', 0xff, 0x00}),
+		frame(3, "RVA2", 0, []byte("album\x00"), []byte{2, 0x01, 0x00, 0}, []byte{1, 0xfc, 0x00, 8, 0xff}),
+	}, nil)))
+	m, err := mp3.ReadMetadata(bytes.NewReader(b))
+	assert.NoError(t, err)
+	assert.Equal(t, "Title", m.Title)
+	assert.Equal(t, "Compressed", m.Album)
+	assert.Equal(t, "Aÿ", m.Artist)
+
+	g, ok := m.AlbumGain()
+	assert.True(t, ok)
+	assert.Equal(t, mp3.ReplayGain{Gain: -2}, g)
+}
+
+func TestReadMetadata_ID3v22(t *testing.T) {
+	b := tag(2, 0,
+		frame22("TT2", []byte{0}, []byte("Title")),
+		frame22("TP1", []byte{2, 0, 'A'}),
+		frame22("TRK", []byte{0}, []byte("7")),
+		frame22("PIC", []byte{0}, []byte("JPG"), []byte{0}, []byte{0}, []byte{0xff, 0xd8}),
+	)
+	m, err := mp3.ReadMetadata(bytes.NewReader(b))
+	assert.NoError(t, err)
+	assert.Equal(t, "Title", m.Title)
+	assert.Equal(t, "A", m.Artist)
+	assert.Equal(t, "Title", m.Text["TIT2"])
+	assert.Equal(t, 7, m.Track)
+	assert.Equal(t, []mp3.Picture{{Type: mp3.PictureOther, MIME: "image/jpeg", Data: []byte{0xff, 0xd8}}}, m.Pictures)
+}
+
+func TestReadMetadata_ID3v1(t *testing.T) {
+	audio := []byte{0xff, 0xfb, 0x90, 0x00}
+	b := append(append(tag(4, 0, frame(4, "TIT2", 0, []byte{0}, []byte("ID3v2 Title"))), audio...), id3v1("ID3v1 Title", "Artist", 5)...)
+	r := bytes.NewReader(b)
+	m, err := mp3.ReadMetadata(r)
+	assert.NoError(t, err)
+	// The ID3v2 tag takes precedence.
+	assert.Equal(t, "ID3v2 Title", m.Title)
+	assert.Equal(t, "Artist", m.Artist)
+	assert.Equal(t, "ID3v1 Album", m.Album)
+	assert.Equal(t, 5, m.Track)
+	// The reader is returned to its position.
+	pos, err := r.Seek(0, io.SeekCurrent)
+	assert.NoError(t, err)
+	assert.Zero(t, pos)
+
+	// The ID3v1 tag can't be read without seeking.
+	m, err = mp3.ReadMetadata(io.MultiReader(bytes.NewReader(b)))
+	assert.NoError(t, err)
+	assert.Equal(t, "", m.Artist)
+}
+
+func TestReadMetadata_NoTags(t *testing.T) {
+	m, err := mp3.ReadMetadata(bytes.NewReader([]byte{0xff, 0xfb}))
+	assert.NoError(t, err)
+	assert.Equal(t, &mp3.Metadata{}, m)
+	_, ok := m.TrackGain()
+	assert.False(t, ok)
+}
+
+func TestReplayGain_Amplitude(t *testing.T) {
+	assert.InDelta(t, 0.5, mp3.ReplayGain{Gain: -6.0206}.Amplitude(), 1e-4)
+	// The gain is limited to avoid clipping.
+	assert.InDelta(t, 1.25, mp3.ReplayGain{Gain: 6, Peak: 0.8}.Amplitude(), 1e-9)
+}
+
+type readSeekNopCloser struct {
+	io.ReadSeeker
+}
+
+func (readSeekNopCloser) Close() error {
+	return nil
+}
+
+func TestDecode_Metadata(t *testing.T) {
+	file, err := os.ReadFile(testtools.TestFilePath("valid_44100hz_x_padded_samples.mp3"))
+	assert.NoError(t, err)
+
+	s, _, err := mp3.Decode(readSeekNopCloser{bytes.NewReader(file)})
+	assert.NoError(t, err)
+	expected := testtools.Collect(s)
+	ms, ok := s.(mp3.MetadataStreamer)
+	assert.True(t, ok)
+	assert.Equal(t, "Lavf58.76.100", ms.Metadata().Text["TSSE"])
+
+	// Replace the tag of the file by another one and append an ID3v1 tag.
+	audio := file[10+int(file[9]):]
+	tagged := append(append(tag(3, 0, frame(3, "TIT2", 0, []byte{0}, []byte("Title"))), audio...), id3v1("", "Artist", 1)...)
+
+	for name, rc := range map[string]io.ReadCloser{
+		"seeker":     readSeekNopCloser{bytes.NewReader(tagged)},
+		"non-seeker": io.NopCloser(io.MultiReader(bytes.NewReader(tagged))),
+	} {
+		t.Run(name, func(t *testing.T) {
+			s, _, err := mp3.Decode(rc)
+			assert.NoError(t, err)
+			m := s.(mp3.MetadataStreamer).Metadata()
+			assert.Equal(t, "Title", m.Title)
+			if name == "seeker" {
+				assert.Equal(t, "Artist", m.Artist)
+			}
+			testtools.AssertSamplesEqual(t, expected, testtools.Collect(s))
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package pcm
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// Decode takes a Reader containing raw PCM audio in the given format and encoding and returns a
+// StreamSeekCloser, which streams that audio until the end of r.
+//
+// If r can seek, the audio reaches from the current position of r to its end. Otherwise, like
+// for pipes, the length is unknown until the end of the audio is reached and Len returns the
+// number of frames streamed so far. The Seek method then only seeks forward by discarding the
+// audio in between and returns an error otherwise.
+//
+// Do not close the supplied Reader, instead, use the Close method of the returned
+// StreamSeekCloser when you want to release the resources.
+func Decode(r io.Reader, format beep.Format, enc Encoding) (beep.StreamSeekCloser, error) {
+	if err := validate(enc, format); err != nil {
+		return nil, err
+	}
+	d := &decoder{
+		r:      r,
+		s:      beep.FromReader(r, format, beep.ReaderEncoding(enc)),
+		format: format,
+		enc:    enc,
+		length: -1,
+	}
+	if seeker, ok := r.(io.Seeker); ok {
+		// Files like stdin may be pipes which can't seek.
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			end, err := seeker.Seek(0, io.SeekEnd)
+			if err != nil {
+				return nil, errors.Wrap(err, "pcm")
+			}
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, errors.Wrap(err, "pcm")
+			}
+			d.seeker = seeker
+			d.start = start
+			d.length = int((end - start) / int64(format.Width()))
+		}
+	}
+	return d, nil
+}
+
+type decoder struct {
+	r      io.Reader
+	s      beep.Streamer
+	seeker io.Seeker // nil if r can't seek
+	start  int64     // offset of the audio if seeker isn't nil
+	format beep.Format
+	enc    Encoding
+	length int // -1 if unknown
+	pos    int
+}
+
+func (d *decoder) Stream(samples [][2]float64) (n int, ok bool) {
+	if d.length >= 0 {
+		if d.pos >= d.length {
+			return 0, false
+		}
+		samples = samples[:min(len(samples), d.length-d.pos)]
+	}
+	n, ok = d.s.Stream(samples)
+	d.pos += n
+	return n, ok
+}
+
+func (d *decoder) Err() error {
+	return errors.Wrap(d.s.Err(), "pcm")
+}
+
+func (d *decoder) Len() int {
+	if d.length < 0 {
+		return d.pos
+	}
+	return d.length
+}
+
+func (d *decoder) Position() int {
+	return d.pos
+}
+
+func (d *decoder) Seek(p int) error {
+	if p < 0 || (d.length >= 0 && d.length < p) {
+		return fmt.Errorf("pcm: seek position %v out of range [%v, %v]", p, 0, d.Len())
+	}
+	if d.seeker == nil {
+		if p < d.pos {
+			return errors.New("pcm: seek error: can't seek backwards, because the resource isn't io.Seeker")
+		}
+		// Discard the audio up to the position.
+		samples := make([][2]float64, 512)
+		for d.pos < p {
+			if _, ok := d.Stream(samples[:min(len(samples), p-d.pos)]); !ok {
+				if err := d.Err(); err != nil {
+					return err
+				}
+				return fmt.Errorf("pcm: seek position %v beyond the end of the audio", p)
+			}
+		}
+		return nil
+	}
+	_, err := d.seeker.Seek(d.start+int64(p)*int64(d.format.Width()), io.SeekStart)
+	if err != nil {
+		return errors.Wrap(err, "pcm: seek error")
+	}
+	d.s = beep.FromReader(d.r, d.format, beep.ReaderEncoding(d.enc))
+	d.pos = p
+	return nil
+}
+
+func (d *decoder) Close() error {
+	if closer, ok := d.r.(io.Closer); ok {
+		err := closer.Close()
+		if err != nil {
+			return errors.Wrap(err, "pcm")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package pcm
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name      string
+		precision int
+		enc       Encoding
+		data      []byte
+		expected  []float64
+	}{
+		{"s8", 1, Encoding{}, []byte{0x40, 0xc0}, []float64{0.5, -0.5}},
+		{"u8", 1, Encoding{Unsigned: true}, []byte{0xc0, 0x40}, []float64{0.5, -0.5}},
+		{"s16le", 2, Encoding{}, []byte{0x00, 0x40, 0x00, 0x80}, []float64{0.5, -1}},
+		{"s16be", 2, Encoding{BigEndian: true}, []byte{0x40, 0x00, 0x80, 0x00}, []float64{0.5, -1}},
+		{"u16be", 2, Encoding{Unsigned: true, BigEndian: true}, []byte{0xc0, 0x00, 0x00, 0x00}, []float64{0.5, -1}},
+		{"s24be", 3, Encoding{BigEndian: true}, []byte{0x40, 0x00, 0x00, 0xc0, 0x00, 0x00}, []float64{0.5, -0.5}},
+		{"s32le", 4, Encoding{}, []byte{0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x00, 0xc0}, []float64{0.5, -0.5}},
+		{"f32le", 4, Encoding{Float: true}, []byte{0x00, 0x00, 0x00, 0x3f, 0x00, 0x00, 0xc0, 0xbf}, []float64{0.5, -1.5}},
+		{"f32be", 4, Encoding{Float: true, BigEndian: true}, []byte{0x3f, 0x00, 0x00, 0x00, 0xbf, 0xc0, 0x00, 0x00}, []float64{0.5, -1.5}},
+		{"f64be", 8, Encoding{Float: true, BigEndian: true}, []byte{0x3f, 0xe0, 0, 0, 0, 0, 0, 0, 0xbf, 0xf8, 0, 0, 0, 0, 0, 0}, []float64{0.5, -1.5}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			format := beep.Format{SampleRate: 8000, NumChannels: 1, Precision: test.precision}
+			s, err := Decode(bytes.NewReader(test.data), format, test.enc)
+			assert.NoError(t, err)
+			assert.Equal(t, len(test.expected), s.Len())
+
+			var expected [][2]float64
+			for _, x := range test.expected {
+				expected = append(expected, [2]float64{x, x})
+			}
+			testtools.AssertSamplesEqual(t, expected, testtools.Collect(s))
+			assert.NoError(t, s.Err())
+
+			assert.NoError(t, s.Seek(1))
+			testtools.AssertSamplesEqual(t, expected[1:], testtools.Collect(s))
+		})
+	}
+}
+
+func TestDecode_Channels(t *testing.T) {
+	// The third channel is ignored and the partial frame at the end is dropped.
+	data := []byte{0x40, 0xc0, 0x10, 0x20, 0xe0, 0x10, 0x7f}
+	format := beep.Format{SampleRate: 8000, NumChannels: 3, Precision: 1}
+	s, err := Decode(bytes.NewReader(data), format, Encoding{})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, s.Len())
+	testtools.AssertSamplesEqual(t, [][2]float64{{0.5, -0.5}, {0.25, -0.25}}, testtools.Collect(s))
+}
+
+func TestDecoder_DoesNotAllocate(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	s, err := Decode(bytes.NewReader(make([]byte, 10000*format.Width())), format, Encoding{})
+	assert.NoError(t, err)
+
+	testtools.AssertStreamerDoesNotAllocate(t, s)
+}
+
+func TestDecode_NonSeekable(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 3}
+	data := make([]byte, 1000*format.Width())
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	s, err := Decode(bytes.NewReader(data), format, Encoding{BigEndian: true})
+	assert.NoError(t, err)
+	expected := testtools.Collect(s)
+	assert.Len(t, expected, 1000)
+
+	s, err = Decode(iotest.OneByteReader(bytes.NewReader(data)), format, Encoding{BigEndian: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, s.Len(), "the length is unknown")
+	var actual [][2]float64
+	buf := make([][2]float64, 7)
+	for {
+		n, ok := s.Stream(buf)
+		if !ok {
+			break
+		}
+		actual = append(actual, buf[:n]...)
+		assert.Equal(t, len(actual), s.Len())
+	}
+	assert.NoError(t, s.Err())
+	testtools.AssertSamplesEqual(t, expected, actual)
+
+	s, err = Decode(iotest.HalfReader(bytes.NewReader(data)), format, Encoding{BigEndian: true})
+	assert.NoError(t, err)
+	testtools.CollectNum(11, s)
+	assert.NoError(t, s.Seek(500), "seeking forward discards the audio in between")
+	assert.Equal(t, 500, s.Position())
+	testtools.AssertSamplesEqual(t, expected[500:510], testtools.CollectNum(10, s))
+	assert.Error(t, s.Seek(100), "seeking backward isn't possible")
+	assert.Error(t, s.Seek(2000), "the audio ends before")
+	assert.Equal(t, 1000, s.Position())
+}
+
+func TestDecode_ShortReads(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	s, data := testtools.RandomDataStreamer(10000)
+	encoded, err := io.ReadAll(beep.NewReader(s, format))
+	assert.NoError(t, err)
+
+	// A Mixer drops a Streamer which returns fewer samples than requested, so short reads must
+	// not end the audio early.
+	d, err := Decode(testtools.NewChunkedReader(bytes.NewReader(encoded), 100), format, Encoding{})
+	assert.NoError(t, err)
+	var m beep.Mixer
+	m.KeepAlive(false)
+	m.Add(d)
+	assert.Len(t, testtools.Collect(&m), len(data))
+	assert.NoError(t, d.Err())
+}
+
+func TestDecode_ReadError(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 1, Precision: 2}
+	r := io.MultiReader(bytes.NewReader(make([]byte, 11)), iotest.ErrReader(io.ErrClosedPipe))
+	s, err := Decode(r, format, Encoding{})
+	assert.NoError(t, err)
+	assert.Len(t, testtools.Collect(s), 5)
+	assert.ErrorIs(t, s.Err(), io.ErrClosedPipe)
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	_, err := Decode(bytes.NewReader(nil), beep.Format{SampleRate: 44100, NumChannels: 0, Precision: 2}, Encoding{})
+	assert.Error(t, err)
+	_, err = Decode(bytes.NewReader(nil), beep.Format{SampleRate: 44100, NumChannels: 1, Precision: 2}, Encoding{Float: true})
+	assert.Error(t, err)
+	_, err = Decode(bytes.NewReader(nil), beep.Format{SampleRate: 44100, NumChannels: 1, Precision: 5}, Encoding{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,4 @@
+// Package pcm implements decoding and encoding of raw PCM audio, which is interleaved samples
+// without any header. Tools like ffmpeg read and write it through pipes, for example in the
+// s16le format.
+package pcm
@@ -0,0 +1,111 @@
+package pcm
+
+import (
+	"bufio"
+	"io"
+
+	"github.com/pkg/errors"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// EncodeOption configures how Encode and Encoder write the audio.
+type EncodeOption func(opts *encodeOptions)
+
+type encodeOptions struct {
+	dither  beep.Dither
+	shaping beep.NoiseShaping
+}
+
+// Dither sets the dither and noise shaping used when the samples are quantized to integers.
+// By default, samples are quantized without dither.
+func Dither(dither beep.Dither, shaping beep.NoiseShaping) EncodeOption {
+	return func(opts *encodeOptions) {
+		opts.dither = dither
+		opts.shaping = shaping
+	}
+}
+
+// Encode writes all audio streamed from s to w as raw PCM audio in the given format and
+// encoding.
+func Encode(w io.Writer, s beep.Streamer, format beep.Format, enc Encoding, opts ...EncodeOption) error {
+	e, err := NewEncoder(w, format, enc, opts...)
+	if err != nil {
+		return err
+	}
+	samples := make([][2]float64, 512)
+	for {
+		n, ok := s.Stream(samples)
+		if !ok {
+			break
+		}
+		if err := e.Write(samples[:n]); err != nil {
+			return err
+		}
+	}
+	return e.Close()
+}
+
+// Encoder writes audio to an io.Writer as raw PCM audio incrementally.
+type Encoder struct {
+	w      *bufio.Writer
+	enc    Encoding
+	q      *beep.Quantizer
+	buf    []byte
+	closed bool
+}
+
+// NewEncoder creates an Encoder writing audio in the given format and encoding to w.
+func NewEncoder(w io.Writer, format beep.Format, enc Encoding, opts ...EncodeOption) (*Encoder, error) {
+	var o encodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if err := validate(enc, format); err != nil {
+		return nil, err
+	}
+	if err := beep.CheckDither(o.dither, o.shaping); err != nil {
+		return nil, errors.Wrap(err, "pcm")
+	}
+	return &Encoder{
+		w:   bufio.NewWriter(w),
+		enc: enc,
+		q:   beep.NewQuantizer(format, o.dither, o.shaping),
+	}, nil
+}
+
+// Write encodes samples. The samples may be buffered until Flush or Close is called.
+func (e *Encoder) Write(samples [][2]float64) error {
+	if e.closed {
+		return errors.New("pcm: write to closed encoder")
+	}
+	width := e.q.Format().Width()
+	if len(e.buf) < len(samples)*width {
+		e.buf = make([]byte, len(samples)*width)
+	}
+	buf := e.buf
+	for _, sample := range samples {
+		buf = buf[e.q.Encode(e.enc, buf, sample):]
+	}
+	if _, err := e.w.Write(e.buf[:len(samples)*width]); err != nil {
+		return errors.Wrap(err, "pcm")
+	}
+	return nil
+}
+
+// Flush writes the buffered audio to the underlying writer, which is useful for live audio.
+func (e *Encoder) Flush() error {
+	if err := e.w.Flush(); err != nil {
+		return errors.Wrap(err, "pcm")
+	}
+	return nil
+}
+
+// Close flushes the buffered audio. It doesn't close the underlying writer.
+func (e *Encoder) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.Flush()
+}
@@ -0,0 +1,80 @@
+package pcm
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+func TestEncode(t *testing.T) {
+	format := beep.Format{SampleRate: 8000, NumChannels: 2, Precision: 2}
+	s := testtools.NewDataStreamer([][2]float64{{0.5, -1}})
+
+	var buf bytes.Buffer
+	assert.NoError(t, Encode(&buf, s, format, Encoding{BigEndian: true}))
+	assert.Equal(t, []byte{0x40, 0x00, 0x80, 0x00}, buf.Bytes())
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	encodings := []Encoding{
+		{},
+		{Unsigned: true},
+		{BigEndian: true},
+		{Unsigned: true, BigEndian: true},
+		{Float: true},
+		{Float: true, BigEndian: true},
+	}
+	for _, enc := range encodings {
+		for _, precision := range []int{1, 2, 3, 4, 8} {
+			format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: precision}
+			if validate(enc, format) != nil {
+				continue
+			}
+			t.Run(fmt.Sprintf("%+v/precision=%d", enc, precision), func(t *testing.T) {
+				s, data := testtools.RandomDataStreamer(1000)
+				var buf bytes.Buffer
+				assert.NoError(t, Encode(&buf, s, format, enc))
+				assert.Equal(t, 1000*format.Width(), buf.Len())
+
+				d, err := Decode(&buf, format, enc)
+				assert.NoError(t, err)
+				actual := testtools.Collect(d)
+				assert.Len(t, actual, len(data))
+				delta := 2 / math.Ldexp(1, precision*8-1)
+				if enc.Float {
+					delta = 1e-6
+				}
+				for i := range data {
+					assert.InDelta(t, data[i][0], actual[i][0], delta)
+					assert.InDelta(t, data[i][1], actual[i][1], delta)
+				}
+			})
+		}
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	format := beep.Format{SampleRate: 8000, NumChannels: 1, Precision: 1}
+	var buf bytes.Buffer
+	e, err := NewEncoder(&buf, format, Encoding{Unsigned: true})
+	assert.NoError(t, err)
+
+	assert.NoError(t, e.Write([][2]float64{{0.5, 0.5}, {-1, 0}}))
+	assert.Equal(t, 0, buf.Len(), "the samples are buffered")
+	assert.NoError(t, e.Flush())
+	assert.Equal(t, []byte{0xc0, 0x40}, buf.Bytes(), "mono is the average of both channels")
+
+	assert.NoError(t, e.Write([][2]float64{{0, 0}}))
+	assert.NoError(t, e.Close())
+	assert.Equal(t, []byte{0xc0, 0x40, 0x80}, buf.Bytes())
+	assert.Error(t, e.Write([][2]float64{{0, 0}}))
+
+	_, err = NewEncoder(&buf, beep.Format{SampleRate: 8000, NumChannels: 1, Precision: 8}, Encoding{})
+	assert.Error(t, err)
+}
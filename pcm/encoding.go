@@ -0,0 +1,28 @@
+package pcm
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// Encoding is the way samples are stored as bytes. The precision of the format determines the
+// size of each sample.
+//
+// The zero value is signed integers in little-endian byte order, which is ffmpeg's s16le format
+// for a precision of 2.
+type Encoding = beep.Encoding
+
+// validate checks whether samples of the format can be stored in the encoding.
+func validate(enc Encoding, format beep.Format) error {
+	if format.NumChannels <= 0 {
+		return errors.New("pcm: invalid number of channels (less than 1)")
+	}
+	if enc.Float && format.Precision != 4 && format.Precision != 8 {
+		return errors.New("pcm: unsupported precision, 4 or 8 is supported for floating point samples")
+	}
+	if !enc.Float && (format.Precision < 1 || format.Precision > 4) {
+		return errors.New("pcm: unsupported precision, 1, 2, 3 or 4 is supported")
+	}
+	return nil
+}
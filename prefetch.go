@@ -0,0 +1,201 @@
+package beep
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const prefetchChunkSize = 512
+
+// Prefetch returns a Prefetcher which decodes s ahead of time on a background goroutine and
+// streams it from a ring buffer holding up to the ahead duration of samples. The sample rate
+// sr is used to convert the ahead duration to a number of samples.
+//
+// Decoders read from disk or a network connection while streaming, which can take longer than
+// the audio thread is allowed to take. Wrapping them in a Prefetcher takes that I/O off the audio
+// thread. Only when the background goroutine falls behind entirely, Stream waits for it.
+//
+// The returned Prefetcher must be closed to stop the background goroutine. It takes ownership
+// of s: s must not be used directly while the Prefetcher is in use. If s is a StreamCloser, it's
+// closed together with the Prefetcher.
+//
+// The Prefetcher propagates errors from s through Err once all samples that were decoded before
+// the error occurred have been streamed.
+func Prefetch(s StreamSeeker, sr SampleRate, ahead time.Duration) *Prefetcher {
+	size := max(sr.N(ahead), prefetchChunkSize)
+	p := &Prefetcher{
+		s:    s,
+		len:  s.Len(),
+		pos:  s.Position(),
+		ring: make([][2]float64, size),
+		tmp:  make([][2]float64, prefetchChunkSize),
+		done: make(chan struct{}),
+	}
+	p.cond = sync.NewCond(&p.mu)
+	go p.run()
+	return p
+}
+
+// Prefetcher is a StreamSeekCloser created by Prefetch.
+type Prefetcher struct {
+	s   StreamSeeker
+	len int
+
+	// sMu guards s and tmp. It's held by the background goroutine while it streams from s.
+	sMu sync.Mutex
+	tmp [][2]float64
+
+	// mu guards the fields below.
+	mu     sync.Mutex
+	cond   *sync.Cond
+	ring   [][2]float64
+	start  int // index in ring of the next sample to stream
+	size   int // number of buffered samples
+	pos    int // position of the next sample to stream
+	eof    bool
+	err    error
+	closed bool
+
+	done chan struct{}
+}
+
+// run fills the ring buffer until the Prefetcher is closed.
+func (p *Prefetcher) run() {
+	defer close(p.done)
+	for {
+		p.mu.Lock()
+		for (p.size == len(p.ring) || p.eof) && !p.closed {
+			p.cond.Wait()
+		}
+		if p.closed {
+			p.mu.Unlock()
+			return
+		}
+		p.mu.Unlock()
+
+		p.sMu.Lock()
+		p.fill()
+		p.sMu.Unlock()
+	}
+}
+
+// fill streams one chunk from s into the ring buffer. The caller must hold sMu.
+func (p *Prefetcher) fill() {
+	p.mu.Lock()
+	if p.eof || p.closed {
+		p.mu.Unlock()
+		return
+	}
+	toStream := min(len(p.tmp), len(p.ring)-p.size)
+	p.mu.Unlock()
+
+	// Stream without holding mu, so that Stream can keep consuming buffered samples.
+	n, ok := p.s.Stream(p.tmp[:toStream])
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := 0; i < n; {
+		end := (p.start + p.size) % len(p.ring)
+		c := copy(p.ring[end:min(end+n-i, len(p.ring))], p.tmp[i:n])
+		p.size += c
+		i += c
+	}
+	if !ok || n < toStream {
+		p.eof = true
+		p.err = p.s.Err()
+	}
+	p.cond.Broadcast()
+}
+
+// Stream streams the prefetched samples. If not enough samples have been prefetched yet, Stream
+// waits for them.
+func (p *Prefetcher) Stream(samples [][2]float64) (n int, ok bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for len(samples) > 0 {
+		for p.size == 0 && !p.eof && !p.closed {
+			p.cond.Wait()
+		}
+		if p.size == 0 {
+			break
+		}
+		c := copy(samples, p.ring[p.start:min(p.start+p.size, len(p.ring))])
+		p.start = (p.start + c) % len(p.ring)
+		p.size -= c
+		p.pos += c
+		n += c
+		samples = samples[c:]
+		p.cond.Broadcast()
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// Err returns the error of the wrapped StreamSeeker once all samples prefetched before the error
+// have been streamed.
+func (p *Prefetcher) Err() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.size > 0 {
+		return nil
+	}
+	return p.err
+}
+
+// Len returns the total number of samples of the wrapped StreamSeeker.
+func (p *Prefetcher) Len() int {
+	return p.len
+}
+
+// Position returns the position of the next sample that Stream will return.
+func (p *Prefetcher) Position() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.pos
+}
+
+// Seek flushes the prefetched samples and seeks the wrapped StreamSeeker. Seek waits for the
+// chunk that is being decoded to complete. Afterwards, prefetching restarts from the new position.
+func (p *Prefetcher) Seek(pos int) error {
+	p.sMu.Lock()
+	defer p.sMu.Unlock()
+
+	if err := p.s.Seek(pos); err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.start = 0
+	p.size = 0
+	p.pos = pos
+	p.eof = false
+	p.err = nil
+	p.cond.Broadcast()
+	return nil
+}
+
+// Close stops the background goroutine and closes the wrapped StreamSeeker if it's a
+// StreamCloser. The Prefetcher streams no more samples afterwards.
+func (p *Prefetcher) Close() error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return errors.New("prefetch: already closed")
+	}
+	p.closed = true
+	p.size = 0
+	p.cond.Broadcast()
+	p.mu.Unlock()
+
+	<-p.done
+
+	if c, ok := p.s.(StreamCloser); ok {
+		return c.Close()
+	}
+	return nil
+}
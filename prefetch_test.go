@@ -0,0 +1,96 @@
+package beep_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+func TestPrefetch_ReturnBehaviour(t *testing.T) {
+	s, _ := testtools.RandomDataStreamer(10000)
+	p := beep.Prefetch(s, 44100, time.Second/100)
+	defer p.Close()
+
+	assert.Equal(t, 10000, p.Len())
+	testtools.AssertStreamerHasCorrectReturnBehaviour(t, p, 10000)
+}
+
+func TestPrefetch_StreamsAllSamples(t *testing.T) {
+	s, data := testtools.RandomDataStreamer(10000)
+	// A buffer smaller than the requested number of samples forces Stream to wait for the
+	// background goroutine multiple times.
+	p := beep.Prefetch(s, 44100, 0)
+	defer p.Close()
+
+	samples := make([][2]float64, 3000)
+	var actual [][2]float64
+	for {
+		n, ok := p.Stream(samples)
+		if !ok {
+			break
+		}
+		actual = append(actual, samples[:n]...)
+		assert.Equal(t, len(actual), p.Position())
+	}
+	assert.Equal(t, data, actual)
+	assert.NoError(t, p.Err())
+}
+
+func TestPrefetch_Seek(t *testing.T) {
+	s, data := testtools.RandomDataStreamer(10000)
+	p := beep.Prefetch(s, 44100, time.Second/10)
+	defer p.Close()
+
+	testtools.CollectNum(100, p)
+
+	err := p.Seek(5000)
+	assert.NoError(t, err)
+	assert.Equal(t, 5000, p.Position())
+	assert.Equal(t, data[5000:5100], testtools.CollectNum(100, p))
+
+	// Seeking after the source has been drained restarts prefetching.
+	testtools.Collect(p)
+	err = p.Seek(10)
+	assert.NoError(t, err)
+	assert.Equal(t, data[10:], testtools.Collect(p))
+}
+
+func TestPrefetch_SeekError(t *testing.T) {
+	s, data := testtools.RandomDataStreamer(1000)
+	seekErr := errors.New("seek error")
+	p := beep.Prefetch(testtools.NewSeekErrorStreamer(s, seekErr), 44100, time.Second/10)
+	defer p.Close()
+
+	testtools.CollectNum(100, p)
+	assert.Equal(t, seekErr, p.Seek(0))
+	assert.Equal(t, 100, p.Position())
+	assert.Equal(t, data[100:], testtools.Collect(p))
+}
+
+func TestPrefetch_PropagatesErrors(t *testing.T) {
+	s, data := testtools.RandomDataStreamer(1000)
+	streamErr := errors.New("stream error")
+	p := beep.Prefetch(testtools.NewDelayedErrorStreamer(s, 700, streamErr), 44100, time.Second)
+	defer p.Close()
+
+	assert.Equal(t, data[:700], testtools.Collect(p))
+	assert.Equal(t, streamErr, p.Err())
+}
+
+func TestPrefetch_Close(t *testing.T) {
+	s, _ := testtools.RandomDataStreamer(100000)
+	p := beep.Prefetch(s, 44100, time.Second/10)
+
+	testtools.CollectNum(100, p)
+	assert.NoError(t, p.Close())
+	assert.Error(t, p.Close())
+
+	n, ok := p.Stream(make([][2]float64, 10))
+	assert.Equal(t, 0, n)
+	assert.False(t, ok)
+}
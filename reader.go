@@ -0,0 +1,183 @@
+package beep
+
+import (
+	"fmt"
+	"io"
+)
+
+// ReaderOption configures NewReader and FromReader.
+type ReaderOption func(opts *readerOptions)
+
+type readerOptions struct {
+	enc     Encoding
+	dither  Dither
+	shaping NoiseShaping
+}
+
+// ReaderEncoding sets the encoding of the samples. By default, samples are signed integers in
+// little-endian byte order.
+func ReaderEncoding(enc Encoding) ReaderOption {
+	return func(opts *readerOptions) {
+		opts.enc = enc
+	}
+}
+
+// ReaderDither sets the dither and noise shaping used by NewReader when the samples are quantized
+// to integers. By default, samples are quantized without dither.
+func ReaderDither(dither Dither, shaping NoiseShaping) ReaderOption {
+	return func(opts *readerOptions) {
+		opts.dither = dither
+		opts.shaping = shaping
+	}
+}
+
+// NewReader returns an io.Reader which reads the audio streamed from s as interleaved samples
+// in format f, signed 16-bit little-endian integers for a precision of 2 by default. The sample
+// rate of f is ignored.
+//
+// Reads may return fewer bytes than requested and split frames. When s is drained, the reader
+// returns io.EOF, or the error of s if there is one.
+//
+// NewReader panics if the number of channels of f is less than 1 or the precision isn't supported
+// by the encoding: 1 to 6 bytes for integers and 4 or 8 bytes for floating point samples.
+func NewReader(s Streamer, f Format, opts ...ReaderOption) io.Reader {
+	o := newReaderOptions(f, opts)
+	return &reader{
+		s:   s,
+		enc: o.enc,
+		q:   NewQuantizer(f, o.dither, o.shaping),
+	}
+}
+
+// FromReader returns a Streamer which decodes the audio read from r as interleaved samples in
+// format f, signed 16-bit little-endian integers for a precision of 2 by default. It's the
+// inverse of NewReader.
+//
+// The Streamer is drained when r returns io.EOF, dropping a partial frame at the end. Other
+// errors of r are returned by the Err method of the Streamer once the samples decoded before the
+// error are streamed.
+//
+// FromReader panics if the number of channels of f is less than 1 or the precision isn't
+// supported by the encoding, see NewReader.
+func FromReader(r io.Reader, f Format, opts ...ReaderOption) Streamer {
+	o := newReaderOptions(f, opts)
+	return &fromReader{
+		r:   r,
+		f:   f,
+		enc: o.enc,
+	}
+}
+
+func newReaderOptions(f Format, opts []ReaderOption) readerOptions {
+	var o readerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if f.NumChannels < 1 {
+		panic(fmt.Errorf("invalid number of channels: %d", f.NumChannels))
+	}
+	if o.enc.Float && f.Precision != 4 && f.Precision != 8 {
+		panic(fmt.Errorf("invalid precision for floating point samples: %d", f.Precision))
+	}
+	if !o.enc.Float && (f.Precision < 1 || f.Precision > 6) {
+		panic(fmt.Errorf("invalid precision: %d", f.Precision))
+	}
+	return o
+}
+
+type reader struct {
+	s       Streamer
+	enc     Encoding
+	q       *Quantizer
+	samples [][2]float64
+	buf     []byte
+	pending []byte // encoded bytes which haven't been read yet
+	err     error
+}
+
+func (r *reader) Read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		width := r.q.Format().Width()
+		frames := max(len(p)/width, 1)
+		if len(r.samples) < frames {
+			r.samples = make([][2]float64, frames)
+			r.buf = make([]byte, frames*width)
+		}
+		frames, ok := r.s.Stream(r.samples[:frames])
+		if !ok {
+			r.err = r.s.Err()
+			if r.err == nil {
+				r.err = io.EOF
+			}
+			return 0, r.err
+		}
+		for i, sample := range r.samples[:frames] {
+			r.q.Encode(r.enc, r.buf[i*width:], sample)
+		}
+		r.pending = r.buf[:frames*width]
+	}
+	n = copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+type fromReader struct {
+	r       io.Reader
+	f       Format
+	enc     Encoding
+	buf     []byte
+	done    bool
+	readErr error // error of r, reported once the samples decoded before it are streamed
+	err     error
+}
+
+func (s *fromReader) Stream(samples [][2]float64) (n int, ok bool) {
+	if s.done {
+		s.err = s.readErr
+		return 0, false
+	}
+	if len(samples) == 0 {
+		return 0, true
+	}
+	width := s.f.Width()
+	wantBytes := len(samples) * width
+	if len(s.buf) < wantBytes {
+		s.buf = make([]byte, wantBytes)
+	}
+
+	// The whole request is read, because returning fewer samples signals the end of the audio.
+	// Unlike io.ReadFull, the loop keeps an error returned along with the data.
+	numBytes := 0
+	var err error
+	for numBytes < wantBytes && err == nil {
+		var read int
+		read, err = s.r.Read(s.buf[numBytes:wantBytes])
+		numBytes += read
+	}
+	if err != nil {
+		s.done = true
+		if err != io.EOF {
+			s.readErr = err
+		}
+	}
+
+	n = numBytes / width
+	for i := range samples[:n] {
+		samples[i], _ = s.f.Decode(s.enc, s.buf[i*width:])
+	}
+	if n == 0 {
+		s.err = s.readErr
+		return 0, false
+	}
+	return n, true
+}
+
+func (s *fromReader) Err() error {
+	return s.err
+}
@@ -0,0 +1,159 @@
+package beep_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"testing/iotest"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+func TestNewReader(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	s := testtools.NewDataStreamer([][2]float64{{0.5, -1}, {0, 0.25}})
+
+	data, err := io.ReadAll(beep.NewReader(s, format))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x00, 0x40, 0x00, 0x80, 0x00, 0x00, 0x00, 0x20}, data)
+
+	s = testtools.NewDataStreamer([][2]float64{{0.5, -1}, {0, 0.25}})
+	data, err = io.ReadAll(beep.NewReader(s, format, beep.ReaderEncoding(beep.Encoding{BigEndian: true})))
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x40, 0x00, 0x80, 0x00, 0x00, 0x00, 0x20, 0x00}, data)
+}
+
+func TestNewReader_SplitsFrames(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 3}
+	s, data := testtools.RandomDataStreamer(100)
+
+	// Reads of 1 byte can't hold a whole frame.
+	r := beep.NewReader(s, format)
+	var encoded []byte
+	p := make([]byte, 1)
+	for {
+		n, err := r.Read(p)
+		encoded = append(encoded, p[:n]...)
+		if err == io.EOF {
+			break
+		}
+		assert.NoError(t, err)
+	}
+	assert.Len(t, encoded, 100*format.Width())
+
+	decoded := testtools.Collect(beep.FromReader(bytes.NewReader(encoded), format))
+	assert.Len(t, decoded, len(data))
+	for i := range data {
+		assert.InDelta(t, data[i][0], decoded[i][0], 1.0/(1<<23))
+		assert.InDelta(t, data[i][1], decoded[i][1], 1.0/(1<<23))
+	}
+}
+
+func TestNewReader_StreamerError(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 1, Precision: 2}
+	s := testtools.NewErrorStreamer(io.ErrClosedPipe)
+
+	_, err := io.ReadAll(beep.NewReader(s, format))
+	assert.ErrorIs(t, err, io.ErrClosedPipe)
+}
+
+func TestNewReader_InvalidFormat(t *testing.T) {
+	s := beep.Silence(10)
+	assert.Panics(t, func() {
+		beep.NewReader(s, beep.Format{SampleRate: 44100, NumChannels: 0, Precision: 2})
+	})
+	assert.Panics(t, func() {
+		beep.NewReader(s, beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}, beep.ReaderEncoding(beep.Encoding{Float: true}))
+	})
+	assert.Panics(t, func() {
+		beep.FromReader(bytes.NewReader(nil), beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 7})
+	})
+}
+
+func TestFromReader(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 4}
+	encodings := []beep.Encoding{
+		{},
+		{Unsigned: true, BigEndian: true},
+		{Float: true},
+		{Float: true, BigEndian: true},
+	}
+	for _, enc := range encodings {
+		s, data := testtools.RandomDataStreamer(1000)
+		encoded, err := io.ReadAll(beep.NewReader(s, format, beep.ReaderEncoding(enc)))
+		assert.NoError(t, err)
+		// A partial frame at the end is dropped.
+		encoded = append(encoded, 1, 2, 3)
+
+		// Reads may return partial frames.
+		r := iotest.OneByteReader(bytes.NewReader(encoded))
+		decoded := testtools.Collect(beep.FromReader(r, format, beep.ReaderEncoding(enc)))
+		assert.Len(t, decoded, len(data))
+		for i := range data {
+			assert.InDelta(t, data[i][0], decoded[i][0], 1e-7)
+			assert.InDelta(t, data[i][1], decoded[i][1], 1e-7)
+		}
+	}
+}
+
+func TestFromReader_ShortReads(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	s, data := testtools.RandomDataStreamer(10000)
+	encoded, err := io.ReadAll(beep.NewReader(s, format))
+	assert.NoError(t, err)
+
+	// A Mixer drops a Streamer which returns fewer samples than requested, so short reads must
+	// not end the audio early.
+	var m beep.Mixer
+	m.KeepAlive(false)
+	m.Add(beep.FromReader(testtools.NewChunkedReader(bytes.NewReader(encoded), 100), format))
+	assert.Len(t, testtools.Collect(&m), len(data))
+}
+
+func TestFromReader_ReadError(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 1, Precision: 2}
+	r := io.MultiReader(bytes.NewReader(make([]byte, 10)), iotest.ErrReader(io.ErrClosedPipe))
+
+	s := beep.FromReader(r, format)
+	assert.Len(t, testtools.Collect(s), 5)
+	assert.ErrorIs(t, s.Err(), io.ErrClosedPipe)
+	testtools.AssertStreamerHasCorrectReturnBehaviour(t, beep.FromReader(bytes.NewReader(make([]byte, 2*100)), format), 100)
+}
+
+// dataErrReader returns its data along with err in a single Read and io.EOF afterwards.
+type dataErrReader struct {
+	data []byte
+	err  error
+}
+
+func (r *dataErrReader) Read(p []byte) (n int, err error) {
+	if r.data == nil {
+		return 0, io.EOF
+	}
+	n = copy(p, r.data)
+	r.data = nil
+	return n, r.err
+}
+
+func TestFromReader_ErrorAlongWithData(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 1, Precision: 2}
+	s := beep.FromReader(&dataErrReader{make([]byte, 11), io.ErrClosedPipe}, format)
+
+	samples := make([][2]float64, 10)
+	n, ok := s.Stream(samples[:0])
+	assert.Equal(t, 0, n)
+	assert.True(t, ok, "an empty slice doesn't drain the streamer")
+
+	n, ok = s.Stream(samples)
+	assert.Equal(t, 5, n, "the samples decoded before the error are returned")
+	assert.True(t, ok)
+	assert.NoError(t, s.Err())
+
+	n, ok = s.Stream(samples)
+	assert.Equal(t, 0, n)
+	assert.False(t, ok)
+	assert.ErrorIs(t, s.Err(), io.ErrClosedPipe)
+}
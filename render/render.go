@@ -0,0 +1,382 @@
+// Package render renders the audio of Streamers faster than real time, for example to export a
+// soundtrack to a file.
+//
+// A Renderer mirrors the Speaker of the speaker package: Streamers are added with Play and the
+// Renderer can be locked to modify them. Instead of pulling audio at the pace of an audio device,
+// Render pulls it as fast as possible and writes it to a Sink. Code which plays its audio through
+// the methods shared by both can thus be used for playback as well as for rendering.
+package render
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/flac"
+	"github.com/gopxl/beep/v2/wav"
+)
+
+const defaultBlockSize = 512
+
+// Options configures a Renderer created by New.
+type Options struct {
+	// SampleRate is the sample rate of the rendered audio and the Streamers played through the
+	// Renderer.
+	SampleRate beep.SampleRate
+
+	// Duration is the length of the rendered audio. If Duration is 0, rendering ends once all
+	// Streamers (or the master effects) have drained and no Streamers are scheduled by PlayAt
+	// anymore.
+	Duration time.Duration
+
+	// BlockSize is the maximum number of samples rendered at once. Between blocks, the Renderer
+	// can be locked and Progress is called. If BlockSize is 0, blocks of 512 samples are used.
+	BlockSize int
+
+	// MasterEffects, if set, builds the chain of effects applied to the mix of all playing
+	// Streamers, like the option of the same name of the speaker package.
+	MasterEffects func(beep.Streamer) beep.Streamer
+
+	// Progress, if set, is called with the duration of the audio rendered so far after each
+	// block.
+	Progress func(rendered time.Duration)
+}
+
+// Renderer mixes Streamers and renders them faster than real time.
+type Renderer struct {
+	sampleRate beep.SampleRate
+	duration   int // in samples, or 0 if unlimited
+	blockSize  int
+	progress   func(time.Duration)
+
+	mu        sync.Mutex
+	mixer     beep.Mixer
+	mix       mixStreamer
+	master    beep.Streamer
+	pos       int
+	scheduled []scheduledPlay // sorted by start
+}
+
+type scheduledPlay struct {
+	start     int
+	streamers []beep.Streamer
+}
+
+// New creates a Renderer.
+func New(opts Options) (*Renderer, error) {
+	if opts.SampleRate <= 0 {
+		return nil, errors.New("render: invalid sample rate")
+	}
+	if opts.Duration < 0 {
+		return nil, errors.New("render: invalid duration")
+	}
+	blockSize := opts.BlockSize
+	if blockSize == 0 {
+		blockSize = defaultBlockSize
+	}
+	if blockSize < 0 {
+		return nil, errors.New("render: invalid block size")
+	}
+
+	r := &Renderer{
+		sampleRate: opts.SampleRate,
+		duration:   opts.SampleRate.N(opts.Duration),
+		blockSize:  blockSize,
+		progress:   opts.Progress,
+	}
+	// The mixer drains with its last Streamer, so that the end of the audio is known exactly.
+	// The master effects are fed through mix, which keeps playing silence while more audio is to
+	// come.
+	r.mixer.KeepAlive(false)
+	r.mix.r = r
+	r.master = &r.mix
+	if opts.MasterEffects != nil {
+		r.master = opts.MasterEffects(&r.mix)
+	}
+	return r, nil
+}
+
+// SampleRate returns the sample rate the Renderer was created with.
+func (r *Renderer) SampleRate() beep.SampleRate {
+	return r.sampleRate
+}
+
+// Lock locks the Renderer. While locked, the Renderer won't pull new data from the playing
+// Streamers. Lock if you want to modify any currently playing Streamers during rendering.
+func (r *Renderer) Lock() {
+	r.mu.Lock()
+}
+
+// Unlock unlocks the Renderer. Call after modifying any currently playing Streamer.
+func (r *Renderer) Unlock() {
+	r.mu.Unlock()
+}
+
+// Play starts playing all provided Streamers at the current position of the Renderer.
+func (r *Renderer) Play(s ...beep.Streamer) {
+	r.mu.Lock()
+	r.mixer.Add(s...)
+	r.mu.Unlock()
+}
+
+// PlayAt schedules all provided Streamers to start playing at the given position of the
+// rendered audio. Streamers scheduled at a position that has already been rendered start playing
+// immediately.
+func (r *Renderer) PlayAt(at time.Duration, s ...beep.Streamer) {
+	start := r.sampleRate.N(at)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i, _ := slices.BinarySearchFunc(r.scheduled, start, func(p scheduledPlay, start int) int {
+		// Keep the order in which Streamers scheduled at the same position were added.
+		if p.start <= start {
+			return -1
+		}
+		return 1
+	})
+	r.scheduled = slices.Insert(r.scheduled, i, scheduledPlay{start, s})
+}
+
+// Clear removes all currently playing and scheduled Streamers from the Renderer.
+func (r *Renderer) Clear() {
+	r.mu.Lock()
+	r.mixer.Clear()
+	r.scheduled = nil
+	r.mu.Unlock()
+}
+
+// Position returns the duration of the audio rendered so far.
+func (r *Renderer) Position() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.sampleRate.D(r.pos)
+}
+
+// Sink receives the audio rendered by a Renderer.
+type Sink interface {
+	// WriteSamples writes the rendered samples. The samples must not be retained.
+	WriteSamples(samples [][2]float64) error
+}
+
+// Render renders the audio to sink until the end determined by the Options is reached or ctx is
+// done, in which case ctx's error is returned. Render may be called again to continue rendering
+// after the current position.
+func (r *Renderer) Render(ctx context.Context, sink Sink) error {
+	s := r.Streamer(ctx)
+	samples := make([][2]float64, r.blockSize)
+	for {
+		n, ok := s.Stream(samples)
+		if !ok {
+			return s.Err()
+		}
+		if err := sink.WriteSamples(samples[:n]); err != nil {
+			return errors.Wrap(err, "render")
+		}
+	}
+}
+
+// RenderWAV renders the audio to w in WAVE format like Render. If w can seek, the audio rendered
+// before ctx is done is written as a valid WAVE file and ctx's error is returned.
+//
+// If w can't seek, like a pipe, the header is written up front with the sizes determined by the
+// Duration option, or with the maximum sizes if it is 0. If ctx is done before the Duration is
+// reached, the header announces more audio than was written. The returned error then wraps both
+// ctx's error and the error of the encoder about the mismatch.
+func (r *Renderer) RenderWAV(ctx context.Context, w io.Writer, format beep.Format, opts ...wav.EncodeOption) error {
+	if format.SampleRate != r.sampleRate {
+		return errors.New("render: the sample rate of the format doesn't match the renderer")
+	}
+	if r.duration > 0 {
+		r.mu.Lock()
+		length := r.duration - r.pos
+		r.mu.Unlock()
+		opts = append([]wav.EncodeOption{wav.Length(int64(max(length, 0)))}, opts...)
+	}
+	e, err := wav.NewEncoder(w, format, opts...)
+	if err != nil {
+		return errors.Wrap(err, "render")
+	}
+	renderErr := r.Render(ctx, encoderSink{e})
+	closeErr := e.Close()
+	switch {
+	case closeErr == nil:
+		return renderErr
+	case renderErr == nil:
+		return errors.Wrap(closeErr, "render")
+	default:
+		return fmt.Errorf("render: %w: %w", renderErr, closeErr)
+	}
+}
+
+// RenderFLAC renders the audio to w in FLAC format like Render. If ctx is done, the audio rendered
+// until then is written as a valid FLAC stream and ctx's error is returned.
+func (r *Renderer) RenderFLAC(ctx context.Context, w io.WriteSeeker, format beep.Format, opts ...flac.EncodeOption) error {
+	if format.SampleRate != r.sampleRate {
+		return errors.New("render: the sample rate of the format doesn't match the renderer")
+	}
+	s := r.Streamer(ctx)
+	err := flac.Encode(w, s, format, opts...)
+	if ctxErr := s.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return errors.Wrap(err, "render")
+}
+
+type encoderSink struct {
+	e *wav.Encoder
+}
+
+func (s encoderSink) WriteSamples(samples [][2]float64) error {
+	return s.e.Write(samples)
+}
+
+// Streamer returns a Streamer which renders the audio when streamed, for example to pass it to
+// an encoder. The Streamer drains at the end determined by the Options or when ctx is done, in
+// which case its Err returns ctx's error.
+func (r *Renderer) Streamer(ctx context.Context) beep.Streamer {
+	return &renderStreamer{r: r, ctx: ctx}
+}
+
+// renderStreamer streams the audio of a Renderer until its end or until ctx is done.
+type renderStreamer struct {
+	r   *Renderer
+	ctx context.Context
+	err error
+}
+
+func (s *renderStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	r := s.r
+	for n < len(samples) {
+		if err := s.ctx.Err(); err != nil {
+			s.err = err
+			break
+		}
+
+		r.mu.Lock()
+		size := r.renderBlock(samples[n:])
+		pos := r.pos
+		r.mu.Unlock()
+		if size == 0 {
+			break
+		}
+		n += size
+
+		if r.progress != nil {
+			r.progress(r.sampleRate.D(pos))
+		}
+	}
+	if n == 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+func (s *renderStreamer) Err() error {
+	return s.err
+}
+
+// renderBlock starts the Streamers scheduled at the current position and renders at most one
+// block to samples, stopping at the start of the next scheduled Streamers or the end of the
+// audio. It returns the number of rendered samples, which is 0 at the end. The caller must hold
+// the lock.
+func (r *Renderer) renderBlock(samples [][2]float64) int {
+	for len(r.scheduled) > 0 && r.scheduled[0].start <= r.pos {
+		r.mixer.Add(r.scheduled[0].streamers...)
+		r.scheduled[0] = scheduledPlay{}
+		r.scheduled = r.scheduled[1:]
+	}
+
+	size := min(len(samples), r.blockSize)
+	if r.duration > 0 {
+		size = min(size, r.duration-r.pos)
+	}
+	if len(r.scheduled) > 0 {
+		size = min(size, r.scheduled[0].start-r.pos)
+	}
+	if size <= 0 {
+		return 0
+	}
+
+	n, _ := r.master.Stream(samples[:size])
+	if n < size && (r.duration > 0 || len(r.scheduled) > 0) {
+		// Fill the gap until the end or the next scheduled Streamers with silence.
+		clear(samples[n:size])
+		n = size
+	}
+	r.pos += n
+	return n
+}
+
+// mixStreamer streams the mixer of a Renderer. Unlike the mixer, it plays silence instead of
+// draining while Streamers are scheduled or the Duration isn't reached, so that stateful master
+// effects keep working between the scheduled Streamers. The caller must hold the lock.
+type mixStreamer struct {
+	r *Renderer
+}
+
+func (m *mixStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	r := m.r
+	n, _ = r.mixer.Stream(samples)
+	if r.duration > 0 || len(r.scheduled) > 0 {
+		clear(samples[n:])
+		return len(samples), true
+	}
+	return n, n > 0
+}
+
+func (m *mixStreamer) Err() error {
+	return nil
+}
+
+// ToBuffer returns a Sink which appends the rendered audio to b.
+func ToBuffer(b *beep.Buffer) Sink {
+	return bufferSink{b}
+}
+
+type bufferSink struct {
+	b *beep.Buffer
+}
+
+func (s bufferSink) WriteSamples(samples [][2]float64) error {
+	s.b.Append(beep.StreamerFunc(func(out [][2]float64) (n int, ok bool) {
+		n = copy(out, samples)
+		samples = samples[n:]
+		return n, n > 0
+	}))
+	return nil
+}
+
+// ToWriter returns a Sink which writes the rendered audio to w as raw interleaved PCM in the given
+// format. Samples are signed, except for a precision of 1 byte, which is unsigned like in WAVE
+// files. The sample rate of the format is ignored.
+func ToWriter(w io.Writer, format beep.Format) Sink {
+	return &writerSink{w: w, f: format}
+}
+
+type writerSink struct {
+	w   io.Writer
+	f   beep.Format
+	buf []byte
+}
+
+func (s *writerSink) WriteSamples(samples [][2]float64) error {
+	size := len(samples) * s.f.Width()
+	if len(s.buf) < size {
+		s.buf = make([]byte, size)
+	}
+	p := s.buf[:size]
+	for i, sample := range samples {
+		if s.f.Precision == 1 {
+			s.f.EncodeUnsigned(p[i*s.f.Width():], sample)
+		} else {
+			s.f.EncodeSigned(p[i*s.f.Width():], sample)
+		}
+	}
+	_, err := s.w.Write(p)
+	return err
+}
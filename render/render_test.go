@@ -0,0 +1,262 @@
+package render_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/orcaman/writerseeker"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/effects"
+	"github.com/gopxl/beep/v2/flac"
+	"github.com/gopxl/beep/v2/internal/testtools"
+	"github.com/gopxl/beep/v2/render"
+	"github.com/gopxl/beep/v2/wav"
+)
+
+// samplesSink collects the rendered samples.
+type samplesSink [][2]float64
+
+func (s *samplesSink) WriteSamples(samples [][2]float64) error {
+	*s = append(*s, samples...)
+	return nil
+}
+
+func TestRenderer_EndsWhenDrained(t *testing.T) {
+	r, err := render.New(render.Options{SampleRate: 1000, BlockSize: 64})
+	assert.NoError(t, err)
+
+	s, data := testtools.RandomDataStreamer(1000)
+	r.Play(s)
+
+	var got samplesSink
+	assert.NoError(t, r.Render(context.Background(), &got))
+	testtools.AssertSamplesEqual(t, data, got)
+	assert.Equal(t, time.Second, r.Position())
+}
+
+func TestRenderer_Duration(t *testing.T) {
+	r, err := render.New(render.Options{SampleRate: 1000, Duration: 500 * time.Millisecond})
+	assert.NoError(t, err)
+
+	s, data := testtools.RandomDataStreamer(300)
+	r.Play(s)
+
+	var got samplesSink
+	assert.NoError(t, r.Render(context.Background(), &got))
+	assert.Len(t, got, 500)
+	testtools.AssertSamplesEqual(t, data, got[:300])
+	testtools.AssertSamplesEqual(t, make([][2]float64, 200), got[300:])
+}
+
+func TestRenderer_PlayAt(t *testing.T) {
+	r, err := render.New(render.Options{SampleRate: 1000})
+	assert.NoError(t, err)
+
+	s1, data1 := testtools.RandomDataStreamer(100)
+	s2, data2 := testtools.RandomDataStreamer(100)
+	r.PlayAt(250*time.Millisecond, s2)
+	r.PlayAt(100*time.Millisecond, s1)
+
+	var got samplesSink
+	assert.NoError(t, r.Render(context.Background(), &got))
+	assert.Len(t, got, 350)
+	testtools.AssertSamplesEqual(t, make([][2]float64, 100), got[:100])
+	testtools.AssertSamplesEqual(t, data1, got[100:200])
+	testtools.AssertSamplesEqual(t, make([][2]float64, 50), got[200:250])
+	testtools.AssertSamplesEqual(t, data2, got[250:])
+}
+
+func TestRenderer_ProgressAndCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var progress []time.Duration
+	r, err := render.New(render.Options{
+		SampleRate: 1000,
+		BlockSize:  100,
+		Progress: func(rendered time.Duration) {
+			progress = append(progress, rendered)
+			if rendered >= 300*time.Millisecond {
+				cancel()
+			}
+		},
+	})
+	assert.NoError(t, err)
+	r.Play(beep.Silence(-1))
+
+	var got samplesSink
+	assert.Equal(t, context.Canceled, r.Render(ctx, &got))
+	assert.Len(t, got, 300)
+	assert.Equal(t, []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond}, progress)
+}
+
+func TestRenderer_MasterEffects(t *testing.T) {
+	r, err := render.New(render.Options{
+		SampleRate: 1000,
+		MasterEffects: func(mix beep.Streamer) beep.Streamer {
+			return beep.Take(50, mix)
+		},
+	})
+	assert.NoError(t, err)
+	s, data := testtools.RandomDataStreamer(100)
+	r.Play(s)
+
+	var got samplesSink
+	assert.NoError(t, r.Render(context.Background(), &got))
+	testtools.AssertSamplesEqual(t, data[:50], got)
+}
+
+func TestRenderer_MasterEffectsBetweenScheduledStreamers(t *testing.T) {
+	r, err := render.New(render.Options{
+		SampleRate: 1000,
+		MasterEffects: func(mix beep.Streamer) beep.Streamer {
+			// The threshold is never reached, so the limiter only delays the audio.
+			return effects.Limiter(mix, 1000, 2, 10*time.Millisecond, 50*time.Millisecond)
+		},
+	})
+	assert.NoError(t, err)
+	s1, data1 := testtools.RandomDataStreamer(100)
+	s2, data2 := testtools.RandomDataStreamer(100)
+	r.PlayAt(0, s1)
+	r.PlayAt(300*time.Millisecond, s2)
+
+	var got samplesSink
+	assert.NoError(t, r.Render(context.Background(), &got))
+	assert.Len(t, got, 409, "the delayed samples of the limiter are rendered at the end")
+	testtools.AssertSamplesEqual(t, make([][2]float64, 9), got[:9])
+	testtools.AssertSamplesEqual(t, data1, got[9:109])
+	testtools.AssertSamplesEqual(t, make([][2]float64, 200), got[109:309])
+	testtools.AssertSamplesEqual(t, data2, got[309:])
+}
+
+func TestRenderer_Streamer(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := render.New(render.Options{SampleRate: 1000})
+	assert.NoError(t, err)
+	s, data := testtools.RandomDataStreamer(300)
+	r.Play(s)
+
+	rendered := r.Streamer(ctx)
+	testtools.AssertSamplesEqual(t, data[:100], testtools.CollectNum(100, rendered))
+	cancel()
+	assert.Empty(t, testtools.Collect(rendered))
+	assert.Equal(t, context.Canceled, rendered.Err())
+	assert.Equal(t, 100*time.Millisecond, r.Position())
+}
+
+func TestRenderer_RenderFLAC(t *testing.T) {
+	r, err := render.New(render.Options{SampleRate: 22050})
+	assert.NoError(t, err)
+	s, data := testtools.RandomDataStreamer(1000)
+	r.Play(s)
+
+	var w writerseeker.WriterSeeker
+	format := beep.Format{SampleRate: 22050, NumChannels: 2, Precision: 3}
+	assert.NoError(t, r.RenderFLAC(context.Background(), &w, format))
+
+	d, decodedFormat, err := flac.Decode(w.Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, format, decodedFormat)
+	got := testtools.Collect(d)
+	assert.Len(t, got, 1000)
+	for i := range data {
+		assert.InDelta(t, data[i][0], got[i][0], 1.0/(1<<22))
+	}
+
+	err = r.RenderFLAC(context.Background(), &writerseeker.WriterSeeker{}, beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2})
+	assert.Error(t, err)
+}
+
+func TestToBuffer(t *testing.T) {
+	r, err := render.New(render.Options{SampleRate: 1000})
+	assert.NoError(t, err)
+	s, data := testtools.RandomDataStreamer(1000)
+	r.Play(s)
+
+	b := beep.NewBuffer(beep.Format{SampleRate: 1000, NumChannels: 2, Precision: 4})
+	assert.NoError(t, r.Render(context.Background(), render.ToBuffer(b)))
+	assert.Equal(t, 1000, b.Len())
+	got := testtools.Collect(b.Streamer(0, b.Len()))
+	for i := range data {
+		assert.InDelta(t, data[i][0], got[i][0], 1e-9)
+		assert.InDelta(t, data[i][1], got[i][1], 1e-9)
+	}
+}
+
+func TestToWriter(t *testing.T) {
+	r, err := render.New(render.Options{SampleRate: 1000})
+	assert.NoError(t, err)
+	r.Play(testtools.NewDataStreamer([][2]float64{{1, -1}, {0, 0.5}}))
+
+	var buf bytes.Buffer
+	assert.NoError(t, r.Render(context.Background(), render.ToWriter(&buf, beep.Format{NumChannels: 1, Precision: 1})))
+	assert.Equal(t, []byte{128, 160}, buf.Bytes())
+}
+
+func TestRenderer_RenderWAV(t *testing.T) {
+	r, err := render.New(render.Options{SampleRate: 22050})
+	assert.NoError(t, err)
+	s, data := testtools.RandomDataStreamer(1000)
+	r.Play(s)
+
+	var w writerseeker.WriterSeeker
+	format := beep.Format{SampleRate: 22050, NumChannels: 2, Precision: 3}
+	assert.NoError(t, r.RenderWAV(context.Background(), &w, format))
+
+	d, decodedFormat, err := wav.Decode(w.Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, format, decodedFormat)
+	got := testtools.Collect(d)
+	assert.Len(t, got, 1000)
+	for i := range data {
+		assert.InDelta(t, data[i][0], got[i][0], 1.0/(1<<23))
+	}
+
+	err = r.RenderWAV(context.Background(), &writerseeker.WriterSeeker{}, beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2})
+	assert.Error(t, err)
+}
+
+func TestRenderer_RenderWAVToPipe(t *testing.T) {
+	r, err := render.New(render.Options{SampleRate: 22050, Duration: time.Second})
+	assert.NoError(t, err)
+	r.Play(beep.Silence(-1))
+
+	var buf bytes.Buffer
+	format := beep.Format{SampleRate: 22050, NumChannels: 2, Precision: 2}
+	assert.NoError(t, r.RenderWAV(context.Background(), struct{ io.Writer }{&buf}, format))
+
+	d, _, err := wav.Decode(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, 22050, d.Len())
+}
+
+func TestRenderer_RenderWAVToPipeCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	r, err := render.New(render.Options{
+		SampleRate: 22050,
+		Duration:   time.Second,
+		BlockSize:  1000,
+		Progress: func(rendered time.Duration) {
+			if rendered >= 100*time.Millisecond {
+				cancel()
+			}
+		},
+	})
+	assert.NoError(t, err)
+	r.Play(beep.Silence(-1))
+
+	var buf bytes.Buffer
+	format := beep.Format{SampleRate: 22050, NumChannels: 2, Precision: 2}
+	err = r.RenderWAV(ctx, struct{ io.Writer }{&buf}, format)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.ErrorContains(t, err, "the header announces 22050", "the file holds less audio than its header announces")
+}
@@ -112,3 +112,8 @@ func FuzzResampler_SetRatio(f *testing.F) {
 		testtools.CollectNum(1024, r)
 	})
 }
+
+func TestResampler_DoesNotAllocate(t *testing.T) {
+	s, _ := testtools.RandomDataStreamer(20000)
+	testtools.AssertStreamerDoesNotAllocate(t, beep.Resample(4, 44100, 48000, s))
+}
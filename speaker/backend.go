@@ -0,0 +1,378 @@
+package speaker
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/wav"
+)
+
+// Backend opens the Outputs a Speaker plays through.
+type Backend interface {
+	// Open opens an Output for audio in the requested format. The bufferSize is the number of
+	// samples the Speaker wants buffered between its Streamers and the listener.
+	//
+	// The Output may run in a different format than requested, in which case the Speaker
+	// resamples and converts its audio to match.
+	Open(format OutputFormat, bufferSize int) (Output, error)
+}
+
+// Output is an audio output opened by a Backend.
+type Output interface {
+	// Format returns the format the Output runs in.
+	Format() OutputFormat
+
+	// Start starts pulling audio from r. The audio is interleaved and encoded in the
+	// Output's Format. Start is called once.
+	Start(r io.Reader) error
+
+	// Pause stops pulling audio until Resume is called.
+	Pause() error
+
+	// Resume continues pulling audio after Pause.
+	Resume() error
+
+	// Close stops pulling audio and releases the Output's resources.
+	Close() error
+}
+
+// Clock decides when the Outputs of the backends without an audio device pull audio.
+// Use RealtimeClock or a VirtualClock.
+type Clock interface {
+	// attach calls pull each time the given number of samples should be pulled, until detach
+	// is called.
+	attach(sampleRate beep.SampleRate, bufferSize int, pull func(n int) bool) (detach func())
+}
+
+// RealtimeClock returns a Clock which pulls audio at the pace it would be played by an audio
+// device.
+func RealtimeClock() Clock {
+	return realtimeClock{}
+}
+
+type realtimeClock struct{}
+
+func (realtimeClock) attach(sampleRate beep.SampleRate, bufferSize int, pull func(n int) bool) (detach func()) {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(sampleRate.D(max(bufferSize/2, 1)))
+		defer ticker.Stop()
+
+		start := time.Now()
+		pulled := 0
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-ticker.C:
+				due := sampleRate.N(now.Sub(start))
+				if !pull(due - pulled) {
+					return
+				}
+				pulled = due
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// VirtualClock is a Clock which only pulls audio when Advance is called. It makes playback
+// deterministic and independent of the wall clock, which is useful in tests.
+type VirtualClock struct {
+	mu      sync.Mutex
+	elapsed time.Duration
+	pullers map[*virtualPuller]struct{}
+}
+
+type virtualPuller struct {
+	sampleRate beep.SampleRate
+	bufferSize int
+	pull       func(n int) bool
+	elapsed    time.Duration
+	pulled     int
+}
+
+// NewVirtualClock creates a VirtualClock at time 0.
+func NewVirtualClock() *VirtualClock {
+	return &VirtualClock{
+		pullers: make(map[*virtualPuller]struct{}),
+	}
+}
+
+func (c *VirtualClock) attach(sampleRate beep.SampleRate, bufferSize int, pull func(n int) bool) (detach func()) {
+	p := &virtualPuller{
+		sampleRate: sampleRate,
+		bufferSize: max(bufferSize, 1),
+		pull:       pull,
+	}
+	c.mu.Lock()
+	c.pullers[p] = struct{}{}
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		delete(c.pullers, p)
+		c.mu.Unlock()
+	}
+}
+
+// Advance moves the clock forward by d. All Outputs driven by the clock pull the audio for that
+// duration before Advance returns. The audio is pulled in chunks of at most the buffer size.
+func (c *VirtualClock) Advance(d time.Duration) {
+	// Advance is serialized, so that the audio of each step is pulled in order.
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.elapsed += d
+	for p := range c.pullers {
+		p.elapsed += d
+		// Round to the nearest sample, so that advancing by SampleRate.D(n) pulls n samples.
+		due := int((p.elapsed*time.Duration(p.sampleRate) + time.Second/2) / time.Second)
+		for p.pulled < due {
+			n := min(due-p.pulled, p.bufferSize)
+			if !p.pull(n) {
+				delete(c.pullers, p)
+				break
+			}
+			p.pulled += n
+		}
+	}
+}
+
+// Elapsed returns the total duration the clock has been advanced by.
+func (c *VirtualClock) Elapsed() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.elapsed
+}
+
+// NewNullBackend returns a Backend which discards all audio. The audio is still pulled from the
+// Streamers at the pace determined by clock, so playback behaves as it would on a real device.
+// This is useful for tests and servers without a sound card.
+func NewNullBackend(clock Clock) Backend {
+	return &sinkBackend{clock: clock, shared: true, open: func(OutputFormat) (sink, error) {
+		return nullSink{}, nil
+	}}
+}
+
+// NewWriterBackend returns a Backend which writes the audio to w as raw interleaved samples in the
+// format requested by the Speaker. The audio is pulled at the pace determined by clock.
+//
+// The Backend can only be used by a single Speaker.
+func NewWriterBackend(w io.Writer, clock Clock) Backend {
+	return &sinkBackend{clock: clock, open: func(OutputFormat) (sink, error) {
+		return writerSink{w}, nil
+	}}
+}
+
+// NewWAVBackend returns a Backend which writes the audio to w in WAVE format. The audio is pulled
+// at the pace determined by clock.
+//
+// If w is an io.WriteSeeker, the header is updated with the final sizes when the Output is
+// closed. Otherwise, the sizes are set to the maximum value, which most tools interpret as
+// "until the end of the file".
+//
+// The Backend can only be used by a single Speaker.
+func NewWAVBackend(w io.Writer, clock Clock) Backend {
+	return &sinkBackend{clock: clock, open: func(format OutputFormat) (sink, error) {
+		return newWAVSink(w, format)
+	}}
+}
+
+// sink receives the audio pulled by a sinkOutput.
+type sink interface {
+	io.Writer
+	Close() error
+}
+
+type sinkBackend struct {
+	clock  Clock
+	open   func(format OutputFormat) (sink, error)
+	shared bool // whether multiple Outputs may be opened
+
+	mu     sync.Mutex
+	opened bool
+}
+
+func (b *sinkBackend) Open(format OutputFormat, bufferSize int) (Output, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.opened && !b.shared {
+		return nil, errors.New("speaker: backend is already in use")
+	}
+	s, err := b.open(format)
+	if err != nil {
+		return nil, err
+	}
+	b.opened = true
+	return &sinkOutput{
+		backend:    b,
+		clock:      b.clock,
+		sink:       s,
+		format:     format,
+		bufferSize: bufferSize,
+	}, nil
+}
+
+// sinkOutput pulls audio into a sink whenever its Clock says so.
+type sinkOutput struct {
+	backend    *sinkBackend
+	clock      Clock
+	sink       sink
+	format     OutputFormat
+	bufferSize int
+
+	mu     sync.Mutex
+	r      io.Reader
+	buf    []byte
+	paused bool
+	err    error
+	detach func()
+}
+
+func (o *sinkOutput) Format() OutputFormat {
+	return o.format
+}
+
+func (o *sinkOutput) Start(r io.Reader) error {
+	o.r = r
+	o.detach = o.clock.attach(o.format.SampleRate, o.bufferSize, o.pull)
+	return nil
+}
+
+// pull reads n samples from the reader and writes them to the sink. It returns false when the
+// Output can't continue.
+func (o *sinkOutput) pull(n int) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.err != nil {
+		return false
+	}
+	if o.paused {
+		return true
+	}
+	size := n * o.format.Width()
+	if len(o.buf) < size {
+		o.buf = make([]byte, size)
+	}
+	p := o.buf[:size]
+	if _, err := io.ReadFull(o.r, p); err != nil {
+		o.err = err
+		return false
+	}
+	if _, err := o.sink.Write(p); err != nil {
+		o.err = err
+		return false
+	}
+	return true
+}
+
+func (o *sinkOutput) Pause() error {
+	o.mu.Lock()
+	o.paused = true
+	o.mu.Unlock()
+	return nil
+}
+
+func (o *sinkOutput) Resume() error {
+	o.mu.Lock()
+	o.paused = false
+	o.mu.Unlock()
+	return nil
+}
+
+func (o *sinkOutput) Close() error {
+	if o.detach != nil {
+		o.detach()
+	}
+	o.mu.Lock()
+	err := o.sink.Close()
+	o.mu.Unlock()
+
+	// The backend can be used again, for example after the Speaker is reinitialized.
+	o.backend.mu.Lock()
+	o.backend.opened = false
+	o.backend.mu.Unlock()
+	return err
+}
+
+type nullSink struct{}
+
+func (nullSink) Write(p []byte) (int, error) { return len(p), nil }
+func (nullSink) Close() error                { return nil }
+
+type writerSink struct {
+	w io.Writer
+}
+
+func (s writerSink) Write(p []byte) (int, error) { return s.w.Write(p) }
+func (s writerSink) Close() error                { return nil }
+
+// wavSink decodes the audio back to samples and writes them with a wav.Encoder. The samples
+// are encoded exactly as the Output received them.
+type wavSink struct {
+	enc     *wav.Encoder
+	format  OutputFormat
+	samples [][2]float64
+}
+
+func newWAVSink(w io.Writer, format OutputFormat) (*wavSink, error) {
+	// The speaker may play for hours, so the file may grow larger than 4 GiB.
+	opts := []wav.EncodeOption{wav.LargeFile()}
+	if format.SampleFormat == SampleFormatFloat32 {
+		opts = append(opts, wav.Float())
+	}
+	enc, err := wav.NewEncoder(w, beep.Format{
+		SampleRate:  format.SampleRate,
+		NumChannels: format.NumChannels,
+		Precision:   format.SampleFormat.Size(),
+	}, opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "speaker")
+	}
+	return &wavSink{enc: enc, format: format}, nil
+}
+
+func (s *wavSink) Write(p []byte) (int, error) {
+	width := s.format.Width()
+	n := len(p) / width
+	if len(s.samples) < n {
+		s.samples = make([][2]float64, n)
+	}
+	samples := s.samples[:n]
+	pcm := s.format.pcmFormat()
+	for i := range samples {
+		frame := p[i*width:]
+		switch s.format.SampleFormat {
+		case SampleFormatFloat32:
+			// The other channels are silent.
+			samples[i][0] = float64(math.Float32frombits(binary.LittleEndian.Uint32(frame)))
+			samples[i][1] = samples[i][0]
+			if s.format.NumChannels > 1 {
+				samples[i][1] = float64(math.Float32frombits(binary.LittleEndian.Uint32(frame[4:])))
+			}
+		case SampleFormatUint8:
+			samples[i], _ = pcm.DecodeUnsigned(frame)
+		default:
+			samples[i], _ = pcm.DecodeSigned(frame)
+		}
+	}
+	if err := s.enc.Write(samples); err != nil {
+		return 0, errors.Wrap(err, "speaker")
+	}
+	return n * width, nil
+}
+
+func (s *wavSink) Close() error {
+	return errors.Wrap(s.enc.Close(), "speaker")
+}
@@ -0,0 +1,192 @@
+package speaker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/orcaman/writerseeker"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/internal/testtools"
+	"github.com/gopxl/beep/v2/wav"
+)
+
+func TestWriterBackend(t *testing.T) {
+	var buf bytes.Buffer
+	clock := NewVirtualClock()
+	sp, err := New(Options{SampleRate: 44100, BufferSize: 512, Backend: NewWriterBackend(&buf, clock)})
+	assert.NoError(t, err)
+
+	s, data := testtools.RandomDataStreamer(1000)
+	sp.Play(s)
+	clock.Advance(beep.SampleRate(44100).D(1500))
+	assert.NoError(t, sp.Close())
+
+	assert.Equal(t, 1500*stereo16.Width(), buf.Len())
+	decoded := make([][2]float64, 1500)
+	for i := range decoded {
+		decoded[i], _ = stereo16.pcmFormat().DecodeSigned(buf.Bytes()[i*stereo16.Width():])
+	}
+	for i := range data {
+		assert.InDelta(t, data[i][0], decoded[i][0], 1.0/(1<<15))
+		assert.InDelta(t, data[i][1], decoded[i][1], 1.0/(1<<15))
+	}
+	assert.Equal(t, make([][2]float64, 500), decoded[1000:], "expected silence after the streamer drained")
+}
+
+func TestWAVBackend(t *testing.T) {
+	var w writerseeker.WriterSeeker
+	clock := NewVirtualClock()
+	sp, err := New(Options{SampleRate: 22050, BufferSize: 512, Backend: NewWAVBackend(&w, clock)})
+	assert.NoError(t, err)
+
+	s, data := testtools.RandomDataStreamer(1000)
+	sp.Play(s)
+	clock.Advance(beep.SampleRate(22050).D(1000))
+	assert.NoError(t, sp.Close())
+
+	d, format, err := wav.Decode(w.Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, beep.Format{SampleRate: 22050, NumChannels: 2, Precision: 2}, format)
+	assert.Equal(t, 1000, d.Len())
+
+	decoded := testtools.Collect(d)
+	for i := range data {
+		assert.InDelta(t, data[i][0], decoded[i][0], 1.0/(1<<15))
+		assert.InDelta(t, data[i][1], decoded[i][1], 1.0/(1<<15))
+	}
+}
+
+func TestWAVBackend_Float32Surround(t *testing.T) {
+	var w writerseeker.WriterSeeker
+	clock := NewVirtualClock()
+	sp, err := New(Options{
+		SampleRate:   22050,
+		BufferSize:   512,
+		NumChannels:  3,
+		SampleFormat: SampleFormatFloat32,
+		Backend:      NewWAVBackend(&w, clock),
+	})
+	assert.NoError(t, err)
+
+	s, data := testtools.RandomDataStreamer(1000)
+	sp.Play(s)
+	clock.Advance(beep.SampleRate(22050).D(1000))
+	assert.NoError(t, sp.Close())
+
+	encoded, err := io.ReadAll(w.Reader())
+	assert.NoError(t, err)
+	// A WAVE_FORMAT_EXTENSIBLE fmt chunk after the JUNK chunk, and a fact chunk, which float
+	// samples require.
+	assert.Equal(t, []byte("fmt "), encoded[12+36:][:4])
+	assert.Equal(t, uint16(0xfffe), binary.LittleEndian.Uint16(encoded[12+36+8:]))
+	assert.True(t, bytes.Contains(encoded, []byte("fact")))
+
+	d, format, err := wav.Decode(bytes.NewReader(encoded))
+	assert.NoError(t, err)
+	assert.Equal(t, beep.Format{SampleRate: 22050, NumChannels: 3, Precision: 4}, format)
+	assert.Equal(t, 1000, d.Len())
+	decoded := testtools.Collect(d)
+	for i := range data {
+		assert.InDelta(t, data[i][0], decoded[i][0], 1e-7)
+		assert.InDelta(t, data[i][1], decoded[i][1], 1e-7)
+	}
+}
+
+func TestBackend_ReopenAfterClose(t *testing.T) {
+	backend := NewWriterBackend(&bytes.Buffer{}, NewVirtualClock())
+	sp, err := New(Options{SampleRate: 44100, Backend: backend})
+	assert.NoError(t, err)
+	assert.NoError(t, sp.Close())
+
+	sp, err = New(Options{SampleRate: 44100, Backend: backend})
+	assert.NoError(t, err)
+	assert.NoError(t, sp.Close())
+}
+
+func TestBackend_CanOnlyBeUsedOnce(t *testing.T) {
+	backend := NewWriterBackend(&bytes.Buffer{}, NewVirtualClock())
+	sp, err := New(Options{SampleRate: 44100, Backend: backend})
+	assert.NoError(t, err)
+	defer sp.Close()
+
+	_, err = New(Options{SampleRate: 44100, Backend: backend})
+	assert.Error(t, err)
+}
+
+func TestSpeaker_SuspendResume(t *testing.T) {
+	var buf bytes.Buffer
+	clock := NewVirtualClock()
+	sp, err := New(Options{SampleRate: 44100, BufferSize: 100, Backend: NewWriterBackend(&buf, clock)})
+	assert.NoError(t, err)
+	defer sp.Close()
+
+	s, _ := testtools.RandomDataStreamer(1000)
+	sp.Play(s)
+
+	assert.NoError(t, sp.Suspend())
+	clock.Advance(time.Second)
+	assert.Equal(t, 0, buf.Len())
+
+	assert.NoError(t, sp.Resume())
+	clock.Advance(beep.SampleRate(44100).D(100))
+	assert.Equal(t, 100*stereo16.Width(), buf.Len())
+}
+
+func TestSuspendResume_DefaultSpeaker(t *testing.T) {
+	assert.Error(t, Suspend(), "the speaker isn't initialized")
+
+	var buf bytes.Buffer
+	clock := NewVirtualClock()
+	assert.NoError(t, InitWithOptions(Options{SampleRate: 44100, BufferSize: 100, Backend: NewWriterBackend(&buf, clock)}))
+	defer Close()
+
+	assert.NoError(t, Suspend())
+	clock.Advance(time.Second)
+	assert.Equal(t, 0, buf.Len())
+
+	assert.NoError(t, Resume())
+	clock.Advance(beep.SampleRate(44100).D(100))
+	assert.Equal(t, 100*stereo16.Width(), buf.Len())
+}
+
+func TestSpeaker_PlayAndWaitWithVirtualClock(t *testing.T) {
+	clock := NewVirtualClock()
+	sp, err := New(Options{SampleRate: 44100, BufferSize: 512, Backend: NewNullBackend(clock)})
+	assert.NoError(t, err)
+	defer sp.Close()
+
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				clock.Advance(time.Millisecond)
+			}
+		}
+	}()
+
+	s, _ := testtools.RandomDataStreamer(44100)
+	sp.PlayAndWait(s)
+	close(stop)
+
+	assert.GreaterOrEqual(t, clock.Elapsed(), time.Second)
+}
+
+func TestNullBackend_Realtime(t *testing.T) {
+	sp, err := New(Options{SampleRate: 44100, BufferSize: 441, Backend: NewNullBackend(RealtimeClock())})
+	assert.NoError(t, err)
+	defer sp.Close()
+
+	start := time.Now()
+	s, _ := testtools.RandomDataStreamer(44100 / 20)
+	sp.PlayAndWait(s)
+
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
@@ -0,0 +1,142 @@
+package speaker
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// defaultSpeaker is controlled by the package level functions. Its zero value is usable, so
+// Streamers can be added before Init is called.
+var defaultSpeaker Speaker
+
+// Init initializes audio playback through speaker. Must be called before using this package.
+//
+// The bufferSize argument specifies the number of samples of the speaker's buffer. Bigger
+// bufferSize means lower CPU usage and more reliable playback. Lower bufferSize means better
+// responsiveness and less delay.
+//
+// Init returns an error if the speaker is already initialized. After Close, Init may be called
+// again, for example with a different sample rate.
+func Init(sampleRate beep.SampleRate, bufferSize int) error {
+	if bufferSize <= 0 {
+		return errors.New("speaker: invalid buffer size")
+	}
+	return defaultSpeaker.init(Options{
+		SampleRate: sampleRate,
+		BufferSize: bufferSize,
+	})
+}
+
+// InitWithOptions initializes the speaker like Init, but allows configuring it further. For
+// example, a different Backend can be used to run code that uses the speaker without a sound
+// card:
+//
+//	speaker.InitWithOptions(speaker.Options{
+//		SampleRate: sr,
+//		Backend:    speaker.NewNullBackend(speaker.RealtimeClock()),
+//	})
+func InitWithOptions(opts Options) error {
+	return defaultSpeaker.init(opts)
+}
+
+// Close closes audio playback. However, the underlying driver context keeps existing, because
+// closing it isn't supported (https://github.com/hajimehoshi/oto/issues/149). In most cases,
+// there is certainly no need to call Close even when the program doesn't play anymore, because
+// in properly set systems, the default mixer handles multiple concurrent processes.
+func Close() {
+	_ = defaultSpeaker.Close()
+}
+
+// Lock locks the speaker. While locked, speaker won't pull new data from the playing Streamers. Lock
+// if you want to modify any currently playing Streamers to avoid race conditions.
+//
+// Always lock speaker for as little time as possible, to avoid playback glitches.
+func Lock() {
+	defaultSpeaker.Lock()
+}
+
+// Unlock unlocks the speaker. Call after modifying any currently playing Streamer.
+func Unlock() {
+	defaultSpeaker.Unlock()
+}
+
+// SetDither sets the dither and noise shaping applied when the samples are converted to the
+// speaker's output. Dither isn't applied to float output. By default, no dither is applied.
+//
+// The change takes effect the next time the speaker pulls data from the playing Streamers.
+func SetDither(d beep.Dither, s beep.NoiseShaping) {
+	defaultSpeaker.SetDither(d, s)
+}
+
+// Play starts playing all provided Streamers through the speaker.
+func Play(s ...beep.Streamer) {
+	defaultSpeaker.Play(s...)
+}
+
+// Start starts playing s through the speaker like Play, and returns a Playback to wait for the end
+// of s or to stop it.
+func Start(s beep.Streamer) *Playback {
+	return defaultSpeaker.Start(s)
+}
+
+// PlayAndWait plays all provided Streamers through the speaker and waits until they have all finished playing.
+func PlayAndWait(s ...beep.Streamer) {
+	defaultSpeaker.PlayAndWait(s...)
+}
+
+// PlayContext plays all provided Streamers through the speaker and waits until they have all
+// finished playing. If ctx is done first, the Streamers are removed from the speaker and ctx's
+// error is returned. Otherwise, the errors of the Streamers are returned.
+func PlayContext(ctx context.Context, s ...beep.Streamer) error {
+	return defaultSpeaker.PlayContext(ctx, s...)
+}
+
+// Suspend suspends the entire audio play.
+//
+// This function is intended to save resources when no audio is playing.
+// To suspend individual streams, use the beep.Ctrl.
+func Suspend() error {
+	return defaultSpeaker.Suspend()
+}
+
+// Resume resumes the entire audio play, which was suspended by Suspend.
+func Resume() error {
+	return defaultSpeaker.Resume()
+}
+
+// Clear removes all currently playing Streamers from the speaker.
+// Previously buffered samples may still be played.
+func Clear() {
+	defaultSpeaker.Clear()
+}
+
+// Stats returns the current playback statistics of the speaker. Stats must not be called while
+// the speaker is locked.
+func Stats() PlaybackStats {
+	return defaultSpeaker.Stats()
+}
+
+// SetMasterVolume sets the gain applied to the mix of all playing Streamers after the master
+// effects. A volume of 1 leaves the mix unchanged and 0 silences it.
+func SetMasterVolume(volume float64) {
+	defaultSpeaker.SetMasterVolume(volume)
+}
+
+// SetMasterEffects replaces the chain of master effects, see Options.MasterEffects. A nil chain
+// removes the master effects.
+func SetMasterEffects(chain func(beep.Streamer) beep.Streamer) {
+	defaultSpeaker.SetMasterEffects(chain)
+}
+
+// SetErrorHandler sets the function called with the Streamers which stop playing because of an
+// error. The other Streamers keep playing. A nil handler ignores the errors, which is the
+// default.
+//
+// The handler is called on the audio goroutine and must return quickly to avoid playback
+// glitches.
+func SetErrorHandler(handler func(s beep.Streamer, err error)) {
+	defaultSpeaker.SetErrorHandler(handler)
+}
@@ -0,0 +1,116 @@
+package speaker
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// SampleFormat is the encoding of a single sample of a single channel sent to an Output.
+type SampleFormat int
+
+const (
+	// SampleFormatInt16 is signed 16-bit little-endian PCM. This is the default.
+	SampleFormatInt16 SampleFormat = iota
+
+	// SampleFormatFloat32 is 32-bit little-endian IEEE 754 floating point. Samples are nominally
+	// in the range [-1, 1], but aren't clipped, so no headroom is lost.
+	SampleFormatFloat32
+
+	// SampleFormatUint8 is unsigned 8-bit PCM.
+	SampleFormatUint8
+)
+
+// Size returns the number of bytes of a single sample of a single channel.
+func (f SampleFormat) Size() int {
+	switch f {
+	case SampleFormatInt16:
+		return 2
+	case SampleFormatFloat32:
+		return 4
+	case SampleFormatUint8:
+		return 1
+	default:
+		panic(fmt.Errorf("speaker: invalid sample format: %d", f))
+	}
+}
+
+func (f SampleFormat) valid() bool {
+	return f >= SampleFormatInt16 && f <= SampleFormatUint8
+}
+
+func (f SampleFormat) String() string {
+	switch f {
+	case SampleFormatInt16:
+		return "int16"
+	case SampleFormatFloat32:
+		return "float32"
+	case SampleFormatUint8:
+		return "uint8"
+	default:
+		return fmt.Sprintf("SampleFormat(%d)", int(f))
+	}
+}
+
+// OutputFormat describes the audio sent to an Output.
+type OutputFormat struct {
+	// SampleRate is the number of samples per second.
+	SampleRate beep.SampleRate
+
+	// NumChannels is the number of interleaved channels. Mono output is a mix of the left and
+	// right channel. With more than two channels, the left and right channel are sent to the
+	// first two and the others are silent.
+	NumChannels int
+
+	// SampleFormat is the encoding of the samples.
+	SampleFormat SampleFormat
+}
+
+// Width returns the number of bytes of a single frame (samples in all channels).
+func (f OutputFormat) Width() int {
+	return f.NumChannels * f.SampleFormat.Size()
+}
+
+// pcmFormat returns the beep.Format used to encode integer samples. The sample rate doesn't
+// influence the encoding and is left unset.
+func (f OutputFormat) pcmFormat() beep.Format {
+	return beep.Format{NumChannels: f.NumChannels, Precision: f.SampleFormat.Size()}
+}
+
+// encoder converts samples to an OutputFormat.
+type encoder struct {
+	f OutputFormat
+	q *beep.Quantizer
+}
+
+func newEncoder(f OutputFormat, d beep.Dither, shaping beep.NoiseShaping) encoder {
+	e := encoder{f: f}
+	if f.SampleFormat != SampleFormatFloat32 {
+		e.q = beep.NewQuantizer(f.pcmFormat(), d, shaping)
+	}
+	return e
+}
+
+// encode encodes sample to p, which must be at least e.f.Width() bytes long.
+func (e encoder) encode(p []byte, sample [2]float64) {
+	switch e.f.SampleFormat {
+	case SampleFormatInt16:
+		e.q.EncodeSigned(p, sample)
+	case SampleFormatUint8:
+		e.q.EncodeUnsigned(p, sample)
+	case SampleFormatFloat32:
+		if e.f.NumChannels == 1 {
+			putFloat32(p, (sample[0]+sample[1])/2)
+			return
+		}
+		putFloat32(p, sample[0])
+		putFloat32(p[4:], sample[1])
+		clear(p[8:e.f.Width()])
+	}
+}
+
+func putFloat32(p []byte, x float64) {
+	binary.LittleEndian.PutUint32(p, math.Float32bits(float32(x)))
+}
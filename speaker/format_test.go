@@ -0,0 +1,62 @@
+package speaker
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+func float32At(p []byte, i int) float32 {
+	return math.Float32frombits(binary.LittleEndian.Uint32(p[i*4:]))
+}
+
+func TestEncoder_Float32(t *testing.T) {
+	sample := [2]float64{0.25, -1.5}
+
+	p := make([]byte, 8)
+	newEncoder(OutputFormat{NumChannels: 2, SampleFormat: SampleFormatFloat32}, beep.DitherNone, beep.NoiseShapingNone).encode(p, sample)
+	assert.Equal(t, []float32{0.25, -1.5}, []float32{float32At(p, 0), float32At(p, 1)}, "float output mustn't be clipped")
+
+	p = make([]byte, 4)
+	newEncoder(OutputFormat{NumChannels: 1, SampleFormat: SampleFormatFloat32}, beep.DitherNone, beep.NoiseShapingNone).encode(p, sample)
+	assert.Equal(t, float32(-0.625), float32At(p, 0))
+
+	p = bytes.Repeat([]byte{0xff}, 16)
+	newEncoder(OutputFormat{NumChannels: 4, SampleFormat: SampleFormatFloat32}, beep.DitherNone, beep.NoiseShapingNone).encode(p, sample)
+	assert.Equal(t, []float32{0.25, -1.5, 0, 0}, []float32{float32At(p, 0), float32At(p, 1), float32At(p, 2), float32At(p, 3)})
+}
+
+func TestEncoder_Uint8(t *testing.T) {
+	p := make([]byte, 2)
+	newEncoder(OutputFormat{NumChannels: 2, SampleFormat: SampleFormatUint8}, beep.DitherNone, beep.NoiseShapingNone).encode(p, [2]float64{-1, 0})
+	assert.Equal(t, []byte{0, 128}, p)
+}
+
+func TestSpeaker_MonoFloat32Output(t *testing.T) {
+	var buf bytes.Buffer
+	clock := NewVirtualClock()
+	sp, err := New(Options{
+		SampleRate:   44100,
+		BufferSize:   512,
+		NumChannels:  1,
+		SampleFormat: SampleFormatFloat32,
+		Backend:      NewWriterBackend(&buf, clock),
+	})
+	assert.NoError(t, err)
+
+	s, data := testtools.RandomDataStreamer(1000)
+	sp.Play(s)
+	clock.Advance(beep.SampleRate(44100).D(1000))
+	assert.NoError(t, sp.Close())
+
+	assert.Equal(t, 1000*4, buf.Len())
+	for i := range data {
+		assert.Equal(t, float32((data[i][0]+data[i][1])/2), float32At(buf.Bytes(), i))
+	}
+}
@@ -0,0 +1,93 @@
+package speaker
+
+import (
+	"time"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/effects"
+)
+
+// ClipProtection selects how a Speaker treats samples outside the range [-1, 1] before they're
+// converted to its output format.
+type ClipProtection int
+
+const (
+	// ClipHard clips the samples at -1 and 1 when they're converted to an integer format. Float
+	// output isn't clipped. This is the default.
+	ClipHard ClipProtection = iota
+
+	// ClipSoft saturates loud samples smoothly (see effects.SoftClip).
+	ClipSoft
+
+	// ClipLimit lowers the gain of the output ahead of peaks (see effects.Limiter). This adds
+	// the limiter's lookahead of 5ms to the latency.
+	ClipLimit
+)
+
+const (
+	limiterLookahead = 5 * time.Millisecond
+	limiterRelease   = 100 * time.Millisecond
+)
+
+func (c ClipProtection) valid() bool {
+	return c >= ClipHard && c <= ClipLimit
+}
+
+// protect wraps s, which produces audio at the sample rate sr, in the clip protection c.
+func (c ClipProtection) protect(s beep.Streamer, sr beep.SampleRate) beep.Streamer {
+	switch c {
+	case ClipSoft:
+		return effects.SoftClip(s)
+	case ClipLimit:
+		return effects.Limiter(s, sr, 1, limiterLookahead, limiterRelease)
+	default:
+		return s
+	}
+}
+
+// masterBus applies the master effects and the master volume to the mix of a Speaker. It's only
+// used while the Speaker is locked.
+type masterBus struct {
+	mix     beep.Streamer
+	effects beep.Streamer // the mix wrapped in the master effects
+	volume  float64
+	report  func(s beep.Streamer, err error)
+}
+
+// setEffects wraps the mix in the chain of effects. A nil chain removes the effects.
+func (b *masterBus) setEffects(mix beep.Streamer, chain func(beep.Streamer) beep.Streamer) {
+	b.mix = mix
+	b.effects = mix
+	if chain != nil {
+		b.effects = chain(mix)
+	}
+}
+
+// Stream streams the mix with the master effects and volume applied. It never drains: when the
+// effects end, silence is streamed. When the effects fail, the error is reported and the effects
+// are bypassed from then on.
+func (b *masterBus) Stream(samples [][2]float64) (n int, ok bool) {
+	n, ok = b.effects.Stream(samples)
+	if !ok && b.effects != b.mix {
+		if err := b.effects.Err(); err != nil {
+			if b.report != nil {
+				b.report(b.effects, err)
+			}
+			b.effects = b.mix
+			m, _ := b.mix.Stream(samples[n:])
+			n += m
+		}
+	}
+	clear(samples[n:])
+	if b.volume != 1 {
+		for i := range samples[:n] {
+			samples[i][0] *= b.volume
+			samples[i][1] *= b.volume
+		}
+	}
+	return len(samples), true
+}
+
+func (b *masterBus) Err() error {
+	return nil
+}
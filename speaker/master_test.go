@@ -0,0 +1,94 @@
+package speaker
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/effects"
+	"github.com/gopxl/beep/v2/generators"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+// playFloat plays s through a stereo float32 Speaker created with opts and returns the first n
+// samples of the output.
+func playFloat(t *testing.T, opts Options, n int, setup func(sp *Speaker), s beep.Streamer) [][2]float32 {
+	t.Helper()
+	var buf bytes.Buffer
+	clock := NewVirtualClock()
+	opts.SampleRate = 44100
+	opts.BufferSize = 512
+	opts.SampleFormat = SampleFormatFloat32
+	opts.Backend = NewWriterBackend(&buf, clock)
+	sp, err := New(opts)
+	assert.NoError(t, err)
+	if setup != nil {
+		setup(sp)
+	}
+
+	sp.Play(s)
+	clock.Advance(opts.SampleRate.D(n))
+	assert.NoError(t, sp.Close())
+
+	out := make([][2]float32, n)
+	for i := range out {
+		out[i] = [2]float32{float32At(buf.Bytes(), 2*i), float32At(buf.Bytes(), 2*i+1)}
+	}
+	return out
+}
+
+func TestSpeaker_MasterVolumeAndEffects(t *testing.T) {
+	s, data := testtools.RandomDataStreamer(1000)
+	out := playFloat(t, Options{
+		MasterEffects: func(mix beep.Streamer) beep.Streamer {
+			return effects.Mono(mix)
+		},
+	}, 1000, func(sp *Speaker) {
+		sp.SetMasterVolume(0.5)
+		assert.Equal(t, 0.5, sp.MasterVolume())
+	}, s)
+
+	for i := range data {
+		expected := float32((data[i][0] + data[i][1]) / 2 * 0.5)
+		assert.Equal(t, [2]float32{expected, expected}, out[i])
+	}
+}
+
+func TestSpeaker_SetMasterEffects(t *testing.T) {
+	s, data := testtools.RandomDataStreamer(1000)
+	out := playFloat(t, Options{}, 1000, func(sp *Speaker) {
+		sp.SetMasterEffects(func(mix beep.Streamer) beep.Streamer {
+			return &effects.Gain{Streamer: mix, Gain: 1}
+		})
+	}, s)
+	for i := range data {
+		assert.Equal(t, [2]float32{float32(data[i][0] * 2), float32(data[i][1] * 2)}, out[i])
+	}
+}
+
+func TestSpeaker_ClipProtection(t *testing.T) {
+	loud := func() beep.Streamer {
+		tone, err := generators.SineTone(44100, 440)
+		assert.NoError(t, err)
+		return &effects.Gain{Streamer: tone, Gain: 2}
+	}
+	peak := func(out [][2]float32) float64 {
+		var p float64
+		for _, x := range out {
+			p = max(p, math.Abs(float64(x[0])), math.Abs(float64(x[1])))
+		}
+		return p
+	}
+	n := beep.SampleRate(44100).N(100 * time.Millisecond)
+
+	assert.InDelta(t, 3, peak(playFloat(t, Options{}, n, nil, loud())), 0.01, "float output isn't clipped by default")
+	assert.LessOrEqual(t, peak(playFloat(t, Options{ClipProtection: ClipSoft}, n, nil, loud())), 1.0)
+	assert.LessOrEqual(t, peak(playFloat(t, Options{ClipProtection: ClipLimit}, n, nil, loud())), 1.0)
+
+	_, err := New(Options{SampleRate: 44100, ClipProtection: ClipProtection(-1)})
+	assert.Error(t, err)
+}
@@ -0,0 +1,207 @@
+package speaker
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/ebitengine/oto/v3"
+	"github.com/pkg/errors"
+)
+
+// otoFormats maps the sample formats to the formats of Oto.
+var otoFormats = map[SampleFormat]oto.Format{
+	SampleFormatInt16:   oto.FormatSignedInt16LE,
+	SampleFormatFloat32: oto.FormatFloat32LE,
+	SampleFormatUint8:   oto.FormatUnsignedInt8,
+}
+
+// driverContext is the part of oto.Context used by the Outputs, so that tests can replace it.
+type driverContext interface {
+	NewPlayer(r io.Reader) driverPlayer
+	Suspend() error
+	Resume() error
+}
+
+// driverPlayer is the part of oto.Player used by the Outputs.
+type driverPlayer interface {
+	Play()
+	Pause()
+	SetBufferSize(bufferSize int)
+	BufferedSize() int
+	Close() error
+}
+
+type otoDriverContext struct {
+	*oto.Context
+}
+
+func (c otoDriverContext) NewPlayer(r io.Reader) driverPlayer {
+	return c.Context.NewPlayer(r)
+}
+
+var (
+	// The driver context can only be created once per process. It's shared by all Speakers.
+	contextMu         sync.Mutex
+	otoContext        driverContext
+	contextFormat     OutputFormat
+	contextBufferSize int
+
+	// outputs holds the started outputs. The context is suspended while all of them are
+	// paused.
+	outputs          = make(map[*otoOutput]struct{})
+	contextSuspended bool
+)
+
+// NewOtoBackend returns a Backend which plays audio through the system's audio output using
+// Oto. This is the Backend used when none is specified.
+//
+// The driver is initialized by the first Output that is opened and can't be reinitialized.
+// Outputs opened afterwards run in the format of the first one. The driver's buffer size is
+// determined by the first Output as well.
+func NewOtoBackend() Backend {
+	return otoBackend{}
+}
+
+type otoBackend struct{}
+
+func (otoBackend) Open(format OutputFormat, bufferSize int) (Output, error) {
+	// We split the total amount of buffer size between the driver and the player.
+	// This seems to be a decent ratio on my machine, but it may have different
+	// results on other OS's because of different underlying implementations.
+	// Both buffers try to keep themselves filled, so the total buffered
+	// number of samples should be some number less than bufferSize.
+	driverBufferSize := bufferSize / 2
+	playerBufferSize := bufferSize / 2
+
+	ctx, ctxFormat, ctxBufferSize, err := getContext(format, driverBufferSize)
+	if err != nil {
+		return nil, err
+	}
+	return &otoOutput{
+		ctx:              ctx,
+		format:           ctxFormat,
+		driverBufferSize: ctxBufferSize,
+		playerBufferSize: playerBufferSize,
+	}, nil
+}
+
+// getContext returns the driver context with its format and buffer size, creating it if it
+// doesn't exist yet.
+func getContext(format OutputFormat, bufferSize int) (driverContext, OutputFormat, int, error) {
+	contextMu.Lock()
+	defer contextMu.Unlock()
+
+	if otoContext != nil {
+		return otoContext, contextFormat, contextBufferSize, nil
+	}
+
+	ctx, readyChan, err := oto.NewContext(&oto.NewContextOptions{
+		SampleRate:   int(format.SampleRate),
+		ChannelCount: format.NumChannels,
+		Format:       otoFormats[format.SampleFormat],
+		BufferSize:   format.SampleRate.D(bufferSize),
+	})
+	if err != nil {
+		return nil, OutputFormat{}, 0, errors.Wrap(err, "failed to initialize speaker")
+	}
+	<-readyChan
+
+	otoContext = otoDriverContext{ctx}
+	contextFormat = format
+	contextBufferSize = bufferSize
+	return otoContext, contextFormat, contextBufferSize, nil
+}
+
+type otoOutput struct {
+	ctx              driverContext
+	format           OutputFormat
+	driverBufferSize int
+	playerBufferSize int
+	player           driverPlayer
+	underruns        *underrunDetector
+	paused           bool // guarded by contextMu
+}
+
+func (o *otoOutput) Format() OutputFormat {
+	return o.format
+}
+
+func (o *otoOutput) Start(r io.Reader) error {
+	contextMu.Lock()
+	// The context stays suspended if a Speaker was closed while suspended, but this Output
+	// plays.
+	if contextSuspended {
+		if err := o.ctx.Resume(); err != nil {
+			contextMu.Unlock()
+			return errors.Wrap(err, "failed to resume the speaker")
+		}
+		contextSuspended = false
+	}
+	outputs[o] = struct{}{}
+	contextMu.Unlock()
+
+	o.underruns = newUnderrunDetector(r, o.format, o.format.SampleRate.D(o.driverBufferSize))
+	o.player = o.ctx.NewPlayer(o.underruns)
+	o.player.SetBufferSize(o.playerBufferSize * o.format.Width())
+	o.player.Play()
+	return nil
+}
+
+func (o *otoOutput) Pause() error {
+	o.player.Pause()
+	o.underruns.reset()
+
+	contextMu.Lock()
+	defer contextMu.Unlock()
+	o.paused = true
+	// The context is shared, so the audio device is only released when no Output plays.
+	for other := range outputs {
+		if !other.paused {
+			return nil
+		}
+	}
+	if contextSuspended {
+		return nil
+	}
+	if err := o.ctx.Suspend(); err != nil {
+		return errors.Wrap(err, "failed to suspend the speaker")
+	}
+	contextSuspended = true
+	return nil
+}
+
+func (o *otoOutput) Resume() error {
+	contextMu.Lock()
+	o.paused = false
+	if contextSuspended {
+		if err := o.ctx.Resume(); err != nil {
+			contextMu.Unlock()
+			return errors.Wrap(err, "failed to resume the speaker")
+		}
+		contextSuspended = false
+	}
+	contextMu.Unlock()
+
+	o.underruns.reset()
+	o.player.Play()
+	return nil
+}
+
+// Latency estimates the latency from the samples buffered by the player and the size of the
+// driver's buffer. Oto doesn't expose how much of the driver's buffer is filled.
+func (o *otoOutput) Latency() time.Duration {
+	buffered := o.player.BufferedSize() / o.format.Width()
+	return o.format.SampleRate.D(buffered + o.driverBufferSize)
+}
+
+func (o *otoOutput) Underruns() (count int, total time.Duration) {
+	return o.underruns.Underruns()
+}
+
+func (o *otoOutput) Close() error {
+	contextMu.Lock()
+	delete(outputs, o)
+	contextMu.Unlock()
+	return o.player.Close()
+}
@@ -0,0 +1,93 @@
+package speaker
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDriverContext replaces Oto's context, which needs an audio device.
+type fakeDriverContext struct {
+	suspended bool
+}
+
+func (c *fakeDriverContext) NewPlayer(io.Reader) driverPlayer {
+	return &fakeDriverPlayer{}
+}
+
+func (c *fakeDriverContext) Suspend() error {
+	c.suspended = true
+	return nil
+}
+
+func (c *fakeDriverContext) Resume() error {
+	c.suspended = false
+	return nil
+}
+
+type fakeDriverPlayer struct {
+	playing bool
+}
+
+func (p *fakeDriverPlayer) Play()             { p.playing = true }
+func (p *fakeDriverPlayer) Pause()            { p.playing = false }
+func (p *fakeDriverPlayer) SetBufferSize(int) {}
+func (p *fakeDriverPlayer) BufferedSize() int { return 0 }
+func (p *fakeDriverPlayer) Close() error      { return nil }
+
+// useFakeDriverContext makes the Oto backend use ctx until the test ends.
+func useFakeDriverContext(t *testing.T, ctx *fakeDriverContext) {
+	contextMu.Lock()
+	defer contextMu.Unlock()
+	otoContext = ctx
+	contextFormat = OutputFormat{SampleRate: 44100, NumChannels: 2, SampleFormat: SampleFormatInt16}
+	contextBufferSize = 2205
+	t.Cleanup(func() {
+		contextMu.Lock()
+		defer contextMu.Unlock()
+		otoContext = nil
+		contextSuspended = false
+	})
+}
+
+func TestOtoBackend_InitAfterClosingSuspended(t *testing.T) {
+	ctx := &fakeDriverContext{}
+	useFakeDriverContext(t, ctx)
+
+	assert.NoError(t, Init(44100, 4410))
+	assert.NoError(t, Suspend())
+	assert.True(t, ctx.suspended)
+	Close()
+
+	assert.NoError(t, Init(44100, 4410))
+	defer Close()
+	assert.False(t, ctx.suspended, "the reinitialized speaker plays")
+	assert.NoError(t, Suspend())
+	assert.True(t, ctx.suspended)
+	assert.NoError(t, Resume())
+	assert.False(t, ctx.suspended)
+}
+
+func TestOtoBackend_SuspendsWhenAllOutputsArePaused(t *testing.T) {
+	ctx := &fakeDriverContext{}
+	useFakeDriverContext(t, ctx)
+
+	sp1, err := New(Options{SampleRate: 44100})
+	assert.NoError(t, err)
+	defer sp1.Close()
+	sp2, err := New(Options{SampleRate: 44100})
+	assert.NoError(t, err)
+	defer sp2.Close()
+
+	assert.NoError(t, sp1.Suspend())
+	assert.False(t, ctx.suspended, "the other speaker still plays")
+	assert.NoError(t, sp2.Suspend())
+	assert.True(t, ctx.suspended)
+
+	// A new speaker plays while the others are suspended.
+	sp3, err := New(Options{SampleRate: 44100})
+	assert.NoError(t, err)
+	defer sp3.Close()
+	assert.False(t, ctx.suspended)
+}
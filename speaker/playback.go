@@ -0,0 +1,182 @@
+package speaker
+
+import (
+	"context"
+	"errors"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// Playback is a handle to a Streamer played by Start.
+type Playback struct {
+	sp   *Speaker
+	s    beep.Streamer
+	done chan struct{}
+	err  error
+
+	// The fields below are guarded by the Speaker's lock.
+	stopped bool
+	drained bool
+	end     int64 // the number of samples sent to the Output when the Streamer is fully sent
+}
+
+// Done returns a channel which is closed when the Streamer has finished playing, when Stop was
+// called or when the Speaker was cleared or closed.
+//
+// The Streamer has finished playing once it's drained and its last samples have been played by
+// the Output. While the Speaker is suspended, the Streamer doesn't finish.
+func (p *Playback) Done() <-chan struct{} {
+	return p.done
+}
+
+// Err returns the error of the Streamer once Done is closed, and nil before.
+func (p *Playback) Err() error {
+	select {
+	case <-p.done:
+		return p.err
+	default:
+		return nil
+	}
+}
+
+// Stop removes the Streamer from the Speaker and closes Done. Stop does nothing if Done is
+// already closed. Stop must not be called while the Speaker is locked.
+func (p *Playback) Stop() {
+	p.sp.mu.Lock()
+	defer p.sp.mu.Unlock()
+	p.stopped = true
+	p.sp.finish(p)
+}
+
+// stream streams the Streamer until it's drained or stopped.
+func (p *Playback) stream(samples [][2]float64) (n int, ok bool) {
+	if p.stopped || p.drained {
+		return 0, false
+	}
+	n, ok = p.s.Stream(samples)
+	// The mixer removes Streamers which return fewer samples than requested.
+	if !ok || n < len(samples) {
+		p.drained = true
+		p.err = p.s.Err()
+		p.end = p.sp.sent.Load() + int64(p.sp.inFlight)
+		if p.err != nil {
+			p.sp.reportError(p.s, p.err)
+		}
+	}
+	return n, ok
+}
+
+// playbackStreamer is added to the mixer for a Playback.
+type playbackStreamer struct {
+	p *Playback
+}
+
+func (ps playbackStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	return ps.p.stream(samples)
+}
+
+func (ps playbackStreamer) Err() error {
+	return nil
+}
+
+// Start starts playing s through the Speaker like Play, and returns a Playback to wait for the
+// end of s or to stop it.
+func (s *Speaker) Start(st beep.Streamer) *Playback {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.start(st)
+}
+
+// start adds a Playback of st. The caller must hold the lock.
+func (s *Speaker) start(st beep.Streamer) *Playback {
+	p := &Playback{
+		sp:   s,
+		s:    st,
+		done: make(chan struct{}),
+	}
+	if s.playbacks == nil {
+		s.playbacks = make(map[*Playback]struct{})
+	}
+	s.playbacks[p] = struct{}{}
+	s.mixer.Add(playbackStreamer{p})
+	return p
+}
+
+// streamerError is an error of a Streamer which is yet to be passed to the error handler.
+type streamerError struct {
+	s   beep.Streamer
+	err error
+}
+
+// reportError queues err to be passed to the error handler once the Speaker is unlocked. The
+// caller must hold the lock.
+func (s *Speaker) reportError(st beep.Streamer, err error) {
+	if s.errorHandler != nil {
+		s.errs = append(s.errs, streamerError{st, err})
+	}
+}
+
+// finish closes the Done channel of p if it's not closed yet. The caller must hold the lock.
+func (s *Speaker) finish(p *Playback) {
+	if _, ok := s.playbacks[p]; !ok {
+		return
+	}
+	delete(s.playbacks, p)
+	close(p.done)
+}
+
+// finishAll finishes all Playbacks. The caller must hold the lock.
+func (s *Speaker) finishAll() {
+	for p := range s.playbacks {
+		p.stopped = true
+		s.finish(p)
+	}
+}
+
+// finishPlayed finishes the drained Playbacks whose samples have all been played.
+func (s *Speaker) finishPlayed() {
+	st := s.Stats()
+	if st.SampleRate <= 0 {
+		return
+	}
+	played := st.playedSamples()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for p := range s.playbacks {
+		if p.drained && p.end <= played {
+			s.finish(p)
+		}
+	}
+}
+
+// PlayContext plays all provided Streamers through the Speaker and waits until they have all
+// finished playing, like PlayAndWait. If ctx is done first, the Streamers are removed from the
+// Speaker and ctx's error is returned. Otherwise, the errors of the Streamers are returned.
+func (s *Speaker) PlayContext(ctx context.Context, st ...beep.Streamer) error {
+	ps := make([]*Playback, len(st))
+	s.mu.Lock()
+	for i, e := range st {
+		ps[i] = s.start(e)
+	}
+	s.mu.Unlock()
+
+	for _, p := range ps {
+		select {
+		case <-p.Done():
+		case <-ctx.Done():
+			for _, p := range ps {
+				p.Stop()
+			}
+			return ctx.Err()
+		}
+	}
+
+	var errs []error
+	for _, p := range ps {
+		if err := p.Err(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
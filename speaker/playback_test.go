@@ -0,0 +1,189 @@
+package speaker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+// newTestSpeaker creates a Speaker playing at 1000 samples per second, which pulls audio only when
+// the returned clock is advanced.
+func newTestSpeaker(t *testing.T) (*Speaker, *VirtualClock) {
+	t.Helper()
+	clock := NewVirtualClock()
+	sp, err := New(Options{SampleRate: 1000, BufferSize: 10, Backend: NewWriterBackend(io.Discard, clock)})
+	assert.NoError(t, err)
+	t.Cleanup(func() { sp.Close() })
+	return sp, clock
+}
+
+func isDone(p *Playback) bool {
+	select {
+	case <-p.Done():
+		return true
+	default:
+		return false
+	}
+}
+
+func TestPlayback_Done(t *testing.T) {
+	sp, clock := newTestSpeaker(t)
+
+	p := sp.Start(beep.Silence(95))
+	clock.Advance(90 * time.Millisecond)
+	assert.False(t, isDone(p))
+
+	clock.Advance(10 * time.Millisecond)
+	assert.True(t, isDone(p))
+	assert.NoError(t, p.Err())
+}
+
+func TestPlayback_Err(t *testing.T) {
+	sp, clock := newTestSpeaker(t)
+
+	err := errors.New("oh no")
+	p := sp.Start(testtools.NewDelayedErrorStreamer(beep.Silence(-1), 50, err))
+	assert.NoError(t, p.Err(), "Err must be nil before Done is closed")
+
+	clock.Advance(100 * time.Millisecond)
+	assert.True(t, isDone(p))
+	assert.Equal(t, err, p.Err())
+}
+
+func TestPlayback_Stop(t *testing.T) {
+	sp, clock := newTestSpeaker(t)
+
+	s, _ := testtools.RandomDataStreamer(1000)
+	p := sp.Start(s)
+	clock.Advance(100 * time.Millisecond)
+	p.Stop()
+	assert.True(t, isDone(p))
+
+	clock.Advance(100 * time.Millisecond)
+	assert.Equal(t, 100, s.Position(), "the streamer must be removed from the speaker")
+
+	// Stopping twice is fine.
+	p.Stop()
+}
+
+func TestPlayback_Clear(t *testing.T) {
+	sp, _ := newTestSpeaker(t)
+
+	p := sp.Start(beep.Silence(-1))
+	sp.Clear()
+	assert.True(t, isDone(p))
+}
+
+func TestSpeaker_PlayContextCanceled(t *testing.T) {
+	sp, clock := newTestSpeaker(t)
+
+	s, _ := testtools.RandomDataStreamer(1000)
+	ctx, cancel := context.WithCancel(context.Background())
+	result := make(chan error)
+	go func() {
+		result <- sp.PlayContext(ctx, s)
+	}()
+
+	// Wait for the streamer to be playing.
+	for {
+		clock.Advance(10 * time.Millisecond)
+		sp.Lock()
+		pos := s.Position()
+		sp.Unlock()
+		if pos > 0 {
+			break
+		}
+	}
+
+	cancel()
+	assert.Equal(t, context.Canceled, <-result)
+
+	sp.Lock()
+	pos := s.Position()
+	sp.Unlock()
+	clock.Advance(100 * time.Millisecond)
+	assert.Equal(t, pos, s.Position(), "the streamer must be removed from the speaker")
+}
+
+func TestSpeaker_PlayContextReturnsStreamerErrors(t *testing.T) {
+	sp, clock := newTestSpeaker(t)
+
+	err := errors.New("oh no")
+	result := make(chan error)
+	go func() {
+		result <- sp.PlayContext(context.Background(), beep.Silence(20), testtools.NewErrorStreamer(err))
+	}()
+
+	for {
+		select {
+		case got := <-result:
+			assert.ErrorIs(t, got, err)
+			return
+		default:
+			clock.Advance(10 * time.Millisecond)
+		}
+	}
+}
+
+func TestSpeaker_ErrorHandler(t *testing.T) {
+	var buf bytes.Buffer
+	clock := NewVirtualClock()
+	type streamerError struct {
+		s   beep.Streamer
+		err error
+	}
+	var errs []streamerError
+	sp, err := New(Options{
+		SampleRate:   1000,
+		BufferSize:   10,
+		SampleFormat: SampleFormatFloat32,
+		Backend:      NewWriterBackend(&buf, clock),
+		ErrorHandler: func(s beep.Streamer, err error) {
+			errs = append(errs, streamerError{s, err})
+		},
+	})
+	assert.NoError(t, err)
+	defer sp.Close()
+
+	failure := errors.New("oh no")
+	failing := testtools.NewDelayedErrorStreamer(beep.Silence(-1), 25, failure)
+	good, data := testtools.RandomDataStreamer(100)
+	sp.Play(failing, good)
+	clock.Advance(100 * time.Millisecond)
+
+	assert.Equal(t, []streamerError{{failing, failure}}, errs)
+	for i := range data {
+		assert.Equal(t, float32(data[i][0]), float32At(buf.Bytes(), 2*i), "the other streamers must keep playing")
+	}
+}
+
+func TestSpeaker_ErrorHandlerBypassesFailingMasterEffects(t *testing.T) {
+	sp, clock := newTestSpeaker(t)
+
+	failure := errors.New("oh no")
+	var effects beep.Streamer
+	var got error
+	sp.SetErrorHandler(func(s beep.Streamer, err error) {
+		assert.Equal(t, effects, s)
+		got = err
+	})
+	sp.SetMasterEffects(func(mix beep.Streamer) beep.Streamer {
+		effects = testtools.NewDelayedErrorStreamer(mix, 30, failure)
+		return effects
+	})
+
+	s, _ := testtools.RandomDataStreamer(1000)
+	sp.Play(s)
+	clock.Advance(100 * time.Millisecond)
+
+	assert.Equal(t, failure, got)
+	assert.Equal(t, 100, s.Position(), "the mix must keep playing without the master effects")
+}
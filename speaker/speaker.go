@@ -1,179 +1,396 @@
 // Package speaker implements playback of beep.Streamer values through physical speakers.
+//
+// The package level functions control a default Speaker, which is set up by Init. Additional,
+// independent Speakers can be created with New.
 package speaker
 
 import (
+	"context"
 	"io"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/ebitengine/oto/v3"
 	"github.com/pkg/errors"
 
 	"github.com/gopxl/beep/v2"
-	"github.com/gopxl/beep/v2/internal/util"
 )
 
-const channelCount = 2
-const bitDepthInBytes = 2
-const bytesPerSample = bitDepthInBytes * channelCount
-const otoFormat = oto.FormatSignedInt16LE
+// defaultNumChannels is the number of channels used if Options.NumChannels is 0.
+const defaultNumChannels = 2
 
-var (
-	mu      sync.Mutex
-	mixer   beep.Mixer
-	context *oto.Context
-	player  *oto.Player
+// resampleQuality is the quality used to resample Speakers whose sample rate differs from the
+// sample rate of their Output.
+const resampleQuality = 4
 
-	bufferDuration time.Duration
-)
+// Options configures a Speaker created by New.
+type Options struct {
+	// SampleRate is the sample rate of the Streamers played through the Speaker.
+	SampleRate beep.SampleRate
+
+	// BufferSize is the number of samples of the Speaker's buffer. Bigger BufferSize means lower
+	// CPU usage and more reliable playback. Lower BufferSize means better responsiveness and less
+	// delay. If BufferSize is 0, a buffer of 1/10th of a second is used.
+	BufferSize int
+
+	// NumChannels is the number of channels of the output. If NumChannels is 0, stereo output is
+	// used.
+	NumChannels int
+
+	// SampleFormat is the encoding of the samples sent to the output. The zero value is signed
+	// 16-bit PCM. The Backend may choose a different format, in which case the audio is
+	// converted to the format of the Output.
+	SampleFormat SampleFormat
 
-// Init initializes audio playback through speaker. Must be called before using this package.
+	// MasterEffects, if set, builds the chain of effects applied to the mix of all playing
+	// Streamers. It's called with the mix and returns the Streamer the Speaker plays, for
+	// example:
+	//
+	//	func(mix beep.Streamer) beep.Streamer {
+	//		return effects.NewEqualizer(mix, sr, sections)
+	//	}
+	MasterEffects func(beep.Streamer) beep.Streamer
+
+	// ClipProtection selects how samples outside the range [-1, 1] are handled before they're
+	// converted to the output format. By default, they're clipped.
+	ClipProtection ClipProtection
+
+	// ErrorHandler, if set, is called with the Streamers which stop playing because of an error,
+	// including the master effects. The other Streamers keep playing. See SetErrorHandler.
+	ErrorHandler func(s beep.Streamer, err error)
+
+	// Backend opens the Output the Speaker plays through. If Backend is nil, the system's audio
+	// output is used (see NewOtoBackend).
+	Backend Backend
+
+	// StatsCallback, if set, is called with the Speaker's Stats each time the Output has
+	// pulled audio from the Speaker. It's called on the audio goroutine, without the Speaker
+	// being locked, and must return quickly to avoid playback glitches.
+	StatsCallback func(PlaybackStats)
+}
+
+// Speaker plays Streamers through an Output, by default the system's audio output. Each Speaker
+// has its own mixer, lock and buffer, so multiple Speakers can be used independently of each
+// other.
 //
-// The bufferSize argument specifies the number of samples of the speaker's buffer. Bigger
-// bufferSize means lower CPU usage and more reliable playback. Lower bufferSize means better
-// responsiveness and less delay.
-func Init(sampleRate beep.SampleRate, bufferSize int) error {
-	if context != nil {
+// The mix of the playing Streamers passes through the master effects and the master volume.
+// If the Output runs at a different sample rate than the Speaker, the audio is resampled.
+// Finally, the clip protection is applied.
+type Speaker struct {
+	mu    sync.Mutex
+	mixer beep.Mixer
+	bus   masterBus
+
+	sampleRate beep.SampleRate
+	output     Output
+	delay      time.Duration // latency added by the clip protection
+
+	// sent is the number of samples sent to the Output. inFlight is the number of samples
+	// requested by the read in progress and is guarded by mu.
+	sent     atomic.Int64
+	inFlight int
+
+	// playbacks holds the Playbacks whose Done channel isn't closed yet.
+	playbacks map[*Playback]struct{}
+
+	// errs holds the errors to pass to errorHandler after the current read.
+	errorHandler func(s beep.Streamer, err error)
+	errs         []streamerError
+
+	dither  beep.Dither
+	shaping beep.NoiseShaping
+}
+
+// New creates a Speaker and starts playback. The Speaker plays silence until Streamers are
+// added using Play.
+func New(opts Options) (*Speaker, error) {
+	s := &Speaker{}
+	if err := s.init(opts); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Speaker) init(opts Options) error {
+	if opts.SampleRate <= 0 {
+		return errors.New("speaker: invalid sample rate")
+	}
+	bufferSize := opts.BufferSize
+	if bufferSize == 0 {
+		bufferSize = opts.SampleRate.N(time.Second / 10)
+	}
+	if bufferSize < 0 {
+		return errors.New("speaker: invalid buffer size")
+	}
+	numChannels := opts.NumChannels
+	if numChannels == 0 {
+		numChannels = defaultNumChannels
+	}
+	if numChannels < 0 {
+		return errors.New("speaker: invalid number of channels")
+	}
+	if !opts.SampleFormat.valid() {
+		return errors.New("speaker: invalid sample format")
+	}
+	if !opts.ClipProtection.valid() {
+		return errors.New("speaker: invalid clip protection")
+	}
+
+	backend := opts.Backend
+	if backend == nil {
+		backend = NewOtoBackend()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.output != nil {
 		return errors.New("speaker cannot be initialized more than once")
 	}
 
-	mixer = beep.Mixer{}
-
-	// We split the total amount of buffer size between the driver and the player.
-	// This seems to be a decent ratio on my machine, but it may have different
-	// results on other OS's because of different underlying implementations.
-	// Both buffers try to keep themselves filled, so the total buffered
-	// number of samples should be some number less than bufferSize.
-	driverBufferSize := bufferSize / 2
-	playerBufferSize := bufferSize / 2
-
-	var err error
-	var readyChan chan struct{}
-	context, readyChan, err = oto.NewContext(&oto.NewContextOptions{
-		SampleRate:   int(sampleRate),
-		ChannelCount: channelCount,
-		Format:       otoFormat,
-		BufferSize:   sampleRate.D(driverBufferSize),
-	})
+	output, err := backend.Open(OutputFormat{
+		SampleRate:   opts.SampleRate,
+		NumChannels:  numChannels,
+		SampleFormat: opts.SampleFormat,
+	}, bufferSize)
 	if err != nil {
-		return errors.Wrap(err, "failed to initialize speaker")
+		return err
 	}
-	<-readyChan
+	format := output.Format()
 
-	player = context.NewPlayer(newReaderFromStreamer(&mixer))
-	player.SetBufferSize(playerBufferSize * bytesPerSample)
-	player.Play()
+	s.mixer = beep.Mixer{}
+	s.bus = masterBus{volume: 1, report: s.reportError}
+	s.errorHandler = opts.ErrorHandler
+	s.bus.setEffects(&s.mixer, opts.MasterEffects)
+	var source beep.Streamer = &s.bus
+	if format.SampleRate != opts.SampleRate {
+		source = beep.Resample(resampleQuality, opts.SampleRate, format.SampleRate, source)
+	}
+	source = opts.ClipProtection.protect(source, format.SampleRate)
+	s.delay = 0
+	if opts.ClipProtection == ClipLimit {
+		s.delay = limiterLookahead
+	}
+
+	s.sent.Store(0)
+	r := newReaderFromStreamer(s, source, format)
+	r.statsCallback = opts.StatsCallback
+	if err := output.Start(r); err != nil {
+		output.Close()
+		return err
+	}
 
-	bufferDuration = sampleRate.D(bufferSize)
+	s.output = output
+	s.sampleRate = opts.SampleRate
 
 	return nil
 }
 
-// Close closes audio playback. However, the underlying driver context keeps existing, because
-// closing it isn't supported (https://github.com/hajimehoshi/oto/issues/149). In most cases,
-// there is certainly no need to call Close even when the program doesn't play anymore, because
-// in properly set systems, the default mixer handles multiple concurrent processes.
-func Close() {
-	if player != nil {
-		player.Close()
-		player = nil
-		Clear()
+// SampleRate returns the sample rate the Speaker was created with.
+func (s *Speaker) SampleRate() beep.SampleRate {
+	return s.sampleRate
+}
+
+// Stats returns the current playback statistics of the Speaker. Stats must not be called while
+// the Speaker is locked, for example from a Streamer being played.
+func (s *Speaker) Stats() PlaybackStats {
+	s.mu.Lock()
+	output, delay := s.output, s.delay
+	s.mu.Unlock()
+
+	st := PlaybackStats{SamplesSent: s.sent.Load()}
+	if output == nil {
+		return st
+	}
+	st.SampleRate = output.Format().SampleRate
+	st.Latency = delay
+	if lr, ok := output.(LatencyReporter); ok {
+		st.Latency += lr.Latency()
+	}
+	if ur, ok := output.(UnderrunReporter); ok {
+		st.Underruns, st.UnderrunDuration = ur.Underruns()
+	}
+	return st
+}
+
+// Close stops playback, closes the Output and removes all Streamers from the Speaker.
+func (s *Speaker) Close() error {
+	s.mu.Lock()
+	output := s.output
+	s.output = nil
+	s.mu.Unlock()
+
+	if output == nil {
+		return nil
+	}
+	// The Output may be reading from the Speaker, so close it without holding the lock.
+	err := output.Close()
+	s.Clear()
+	if err != nil {
+		return errors.Wrap(err, "speaker: failed to close output")
 	}
+	return nil
 }
 
-// Lock locks the speaker. While locked, speaker won't pull new data from the playing Streamers. Lock
-// if you want to modify any currently playing Streamers to avoid race conditions.
+// Lock locks the Speaker. While locked, the Speaker won't pull new data from the playing
+// Streamers. Lock if you want to modify any currently playing Streamers to avoid race conditions.
 //
-// Always lock speaker for as little time as possible, to avoid playback glitches.
-func Lock() {
-	mu.Lock()
+// Always lock the Speaker for as little time as possible, to avoid playback glitches.
+func (s *Speaker) Lock() {
+	s.mu.Lock()
 }
 
-// Unlock unlocks the speaker. Call after modifying any currently playing Streamer.
-func Unlock() {
-	mu.Unlock()
+// Unlock unlocks the Speaker. Call after modifying any currently playing Streamer.
+func (s *Speaker) Unlock() {
+	s.mu.Unlock()
 }
 
-// Play starts playing all provided Streamers through the speaker.
-func Play(s ...beep.Streamer) {
-	mu.Lock()
-	mixer.Add(s...)
-	mu.Unlock()
+// SetDither sets the dither and noise shaping applied when the samples are converted to the
+// Speaker's output. Dither isn't applied to float output. By default, no dither is applied.
+//
+// The change takes effect the next time the Speaker pulls data from the playing Streamers.
+func (s *Speaker) SetDither(d beep.Dither, shaping beep.NoiseShaping) {
+	// Validate the arguments here instead of panicking in the audio thread.
+	beep.NewQuantizer(beep.Format{NumChannels: 2, Precision: 2}, d, shaping)
+
+	s.mu.Lock()
+	s.dither, s.shaping = d, shaping
+	s.mu.Unlock()
 }
 
-// PlayAndWait plays all provided Streamers through the speaker and waits until they have all finished playing.
-func PlayAndWait(s ...beep.Streamer) {
-	mu.Lock()
-	var wg sync.WaitGroup
-	wg.Add(len(s))
-	for _, e := range s {
-		mixer.Add(beep.Seq(e, beep.Callback(func() {
-			wg.Done()
-		})))
-	}
-	mu.Unlock()
+// SetMasterVolume sets the gain applied to the mix of all playing Streamers after the master
+// effects. A volume of 1 leaves the mix unchanged and 0 silences it. The default is 1.
+func (s *Speaker) SetMasterVolume(volume float64) {
+	s.mu.Lock()
+	s.bus.volume = volume
+	s.mu.Unlock()
+}
 
-	// Wait for the streamers to drain.
-	wg.Wait()
+// MasterVolume returns the volume set by SetMasterVolume.
+func (s *Speaker) MasterVolume() float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.bus.volume
+}
 
-	// Wait the expected time it takes for the samples to reach the driver.
-	time.Sleep(bufferDuration)
+// SetMasterEffects replaces the chain of master effects, like Options.MasterEffects. A nil chain
+// removes the master effects. The playing Streamers keep playing.
+//
+// To change the parameters of the current effects instead, lock the Speaker and modify them. Init
+// and New reset the master effects and volume to those of the Options.
+func (s *Speaker) SetMasterEffects(chain func(beep.Streamer) beep.Streamer) {
+	s.mu.Lock()
+	s.bus.setEffects(&s.mixer, chain)
+	s.mu.Unlock()
 }
 
-// Suspend suspends the entire audio play.
+// SetErrorHandler sets the function called with the Streamers which stop playing because of an
+// error. A nil handler ignores the errors, which is the default.
 //
-// This function is intended to save resources when no audio is playing.
-// To suspend individual streams, use the beep.Ctrl.
-func Suspend() error {
-	err := context.Suspend()
-	if err != nil {
-		return errors.Wrap(err, "failed to suspend the speaker")
+// The handler is called on the audio goroutine, without the Speaker being locked, and must
+// return quickly to avoid playback glitches.
+func (s *Speaker) SetErrorHandler(handler func(s beep.Streamer, err error)) {
+	s.mu.Lock()
+	s.errorHandler = handler
+	s.mu.Unlock()
+}
+
+// Play starts playing all provided Streamers through the Speaker.
+func (s *Speaker) Play(st ...beep.Streamer) {
+	s.mu.Lock()
+	for _, e := range st {
+		s.start(e)
 	}
-	return nil
+	s.mu.Unlock()
 }
 
-// Resume resumes the entire audio play, which was suspended by Suspend.
-func Resume() error {
-	err := context.Resume()
-	if err != nil {
-		return errors.Wrap(err, "failed to resume the speaker")
+// PlayAndWait plays all provided Streamers through the Speaker and waits until they have all
+// finished playing, including the latency of the Output. While the Speaker is suspended,
+// PlayAndWait keeps waiting. PlayAndWait returns early if the Speaker is cleared or closed.
+func (s *Speaker) PlayAndWait(st ...beep.Streamer) {
+	_ = s.PlayContext(context.Background(), st...)
+}
+
+// Suspend pauses the Speaker. Playing Streamers are kept, but not streamed until Resume is
+// called. The Oto backend releases the audio device while no Speaker plays, which saves
+// resources when no audio is playing. To suspend individual streams, use beep.Ctrl.
+func (s *Speaker) Suspend() error {
+	s.mu.Lock()
+	output := s.output
+	s.mu.Unlock()
+	if output == nil {
+		return errors.New("speaker: speaker isn't initialized")
 	}
-	return nil
+	return errors.Wrap(output.Pause(), "speaker")
+}
+
+// Resume resumes the Speaker after it was paused by Suspend.
+func (s *Speaker) Resume() error {
+	s.mu.Lock()
+	output := s.output
+	s.mu.Unlock()
+	if output == nil {
+		return errors.New("speaker: speaker isn't initialized")
+	}
+	return errors.Wrap(output.Resume(), "speaker")
 }
 
-// Clear removes all currently playing Streamers from the speaker.
-// Previously buffered samples may still be played.
-func Clear() {
-	mu.Lock()
-	mixer.Clear()
-	mu.Unlock()
+// Clear removes all currently playing Streamers from the Speaker and closes the Done channels of
+// their Playbacks. Previously buffered samples may still be played.
+func (s *Speaker) Clear() {
+	s.mu.Lock()
+	s.mixer.Clear()
+	s.finishAll()
+	s.mu.Unlock()
 }
 
 // sampleReader is a wrapper for beep.Streamer to implement io.Reader.
 type sampleReader struct {
+	sp  *Speaker
 	s   beep.Streamer
 	buf [][2]float64
+
+	width   int
+	enc     encoder
+	dither  beep.Dither
+	shaping beep.NoiseShaping
+
+	statsCallback func(PlaybackStats)
+	errs          []streamerError
 }
 
-func newReaderFromStreamer(s beep.Streamer) *sampleReader {
+// newReaderFromStreamer creates a sampleReader which streams from s while holding the lock of
+// Speaker sp and encodes the samples in format f.
+func newReaderFromStreamer(sp *Speaker, s beep.Streamer, f OutputFormat) *sampleReader {
 	return &sampleReader{
-		s: s,
+		sp:    sp,
+		s:     s,
+		width: f.Width(),
+		enc:   newEncoder(f, beep.DitherNone, beep.NoiseShapingNone),
 	}
 }
 
 // Read pulls samples from the streamer and fills buf with the encoded
 // samples. Read expects the size of buf be divisible by the length
-// of a sample (= channel count * bit depth in bytes).
+// of a frame (= channel count * sample size in bytes).
 func (s *sampleReader) Read(buf []byte) (n int, err error) {
 	// Read samples from streamer
-	if len(buf)%bytesPerSample != 0 {
+	if len(buf)%s.width != 0 {
 		return 0, errors.New("requested number of bytes do not align with the samples")
 	}
-	ns := len(buf) / bytesPerSample
+	ns := len(buf) / s.width
 	if len(s.buf) < ns {
 		s.buf = make([][2]float64, ns)
 	}
-	ns, ok := s.stream(s.buf[:ns])
+	ns, ok, handler := s.stream(s.buf[:ns])
+	// Pass the errors of the Streamers that stopped to the error handler.
+	for i, e := range s.errs {
+		if handler != nil {
+			handler(e.s, e.err)
+		}
+		s.errs[i] = streamerError{}
+	}
+	s.errs = s.errs[:0]
 	if !ok {
 		if s.s.Err() != nil {
 			return 0, errors.Wrap(s.s.Err(), "streamer returned error when requesting samples")
@@ -185,24 +402,32 @@ func (s *sampleReader) Read(buf []byte) (n int, err error) {
 
 	// Convert samples to bytes
 	for i := range s.buf[:ns] {
-		for c := range s.buf[i] {
-			val := s.buf[i][c]
-			val = util.Clamp(val, -1, 1)
-			valInt16 := int16(val * (1<<15 - 1))
-			low := byte(valInt16)
-			high := byte(valInt16 >> 8)
-			buf[i*bytesPerSample+c*bitDepthInBytes+0] = low
-			buf[i*bytesPerSample+c*bitDepthInBytes+1] = high
-		}
+		s.enc.encode(buf[i*s.width:], s.buf[i])
+	}
+
+	s.sp.sent.Add(int64(ns))
+	s.sp.finishPlayed()
+	if s.statsCallback != nil {
+		s.statsCallback(s.sp.Stats())
 	}
 
-	return ns * bytesPerSample, nil
+	return ns * s.width, nil
 }
 
 // stream pull samples from the streamer while preventing concurrency
-// problems by locking the global mixer.
-func (s *sampleReader) stream(samples [][2]float64) (n int, ok bool) {
-	mu.Lock()
-	defer mu.Unlock()
-	return s.s.Stream(samples)
+// problems by locking the speaker's mixer. It also picks up changes made
+// by SetDither and collects the errors to pass to the returned handler.
+func (s *sampleReader) stream(samples [][2]float64) (n int, ok bool, handler func(beep.Streamer, error)) {
+	s.sp.mu.Lock()
+	defer s.sp.mu.Unlock()
+	if s.dither != s.sp.dither || s.shaping != s.sp.shaping {
+		s.dither, s.shaping = s.sp.dither, s.sp.shaping
+		s.enc = newEncoder(s.enc.f, s.dither, s.shaping)
+	}
+	s.sp.inFlight = len(samples)
+	n, ok = s.s.Stream(samples)
+	// Take the errors, so that they can be handled without holding the lock. The buffers are
+	// swapped to reuse them.
+	s.errs, s.sp.errs = s.sp.errs, s.errs
+	return n, ok, s.sp.errorHandler
 }
@@ -5,17 +5,21 @@ import (
 	"io"
 	"testing"
 
+	"github.com/gopxl/beep/v2"
 	"github.com/gopxl/beep/v2/internal/testtools"
 )
 
+// stereo16 is the default output format.
+var stereo16 = OutputFormat{NumChannels: 2, SampleFormat: SampleFormatInt16}
+
 func BenchmarkSampleReader_Read(b *testing.B) {
-	// note: must be multiples of bytesPerSample
+	// note: must be multiples of the frame width
 	bufferSizes := []int{64, 512, 8192, 32768}
 
 	for _, bs := range bufferSizes {
 		b.Run(fmt.Sprintf("with buffer size %d", bs), func(b *testing.B) {
 			s, _ := testtools.RandomDataStreamer(b.N)
-			r := newReaderFromStreamer(s)
+			r := newReaderFromStreamer(&Speaker{}, s, stereo16)
 			buf := make([]byte, bs)
 
 			b.StartTimer()
@@ -34,3 +38,29 @@ func BenchmarkSampleReader_Read(b *testing.B) {
 		})
 	}
 }
+
+func TestSampleReader_DoesNotAllocate(t *testing.T) {
+	s, _ := testtools.RandomDataStreamer(100000)
+	r := newReaderFromStreamer(&Speaker{}, s, stereo16)
+	// FromReader decodes the bytes read from r back to samples without allocating.
+	testtools.AssertStreamerDoesNotAllocate(t, beep.FromReader(r, stereo16.pcmFormat()))
+}
+
+func TestNew_InvalidOptions(t *testing.T) {
+	_, err := New(Options{SampleRate: 0, BufferSize: 1024})
+	if err == nil {
+		t.Fatal("expected an error for an invalid sample rate")
+	}
+	_, err = New(Options{SampleRate: 44100, BufferSize: -1})
+	if err == nil {
+		t.Fatal("expected an error for an invalid buffer size")
+	}
+	_, err = New(Options{SampleRate: 44100, NumChannels: -1})
+	if err == nil {
+		t.Fatal("expected an error for an invalid number of channels")
+	}
+	_, err = New(Options{SampleRate: 44100, SampleFormat: SampleFormat(-1)})
+	if err == nil {
+		t.Fatal("expected an error for an invalid sample format")
+	}
+}
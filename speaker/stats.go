@@ -0,0 +1,120 @@
+package speaker
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// PlaybackStats describes the playback of a Speaker.
+type PlaybackStats struct {
+	// SampleRate is the sample rate of the Speaker's Output. The sample counts are given at
+	// this rate.
+	SampleRate beep.SampleRate
+
+	// SamplesSent is the number of samples the Speaker has sent to its Output.
+	SamplesSent int64
+
+	// Latency is the estimated time it takes for a sample sent to the Output to become audible.
+	Latency time.Duration
+
+	// Underruns is the number of times the Output ran out of audio because the Speaker couldn't
+	// produce it in time.
+	Underruns int
+
+	// UnderrunDuration is the estimated total length of the gaps caused by underruns.
+	UnderrunDuration time.Duration
+}
+
+// Played returns the duration of the audio that has become audible so far. Use it to line up
+// visuals with the audio.
+func (st PlaybackStats) Played() time.Duration {
+	if st.SampleRate <= 0 {
+		return 0
+	}
+	return max(st.SampleRate.D(int(st.SamplesSent))-st.Latency, 0)
+}
+
+// playedSamples returns the number of samples that have become audible so far.
+func (st PlaybackStats) playedSamples() int64 {
+	// Round the latency up, so that samples aren't reported as played too early.
+	latency := (st.Latency*time.Duration(st.SampleRate) + time.Second - 1) / time.Second
+	return st.SamplesSent - int64(latency)
+}
+
+// LatencyReporter is implemented by Outputs which can estimate their latency. Outputs which
+// don't implement it are assumed to have no latency.
+type LatencyReporter interface {
+	// Latency returns the estimated time it takes for audio read by the Output to become
+	// audible.
+	Latency() time.Duration
+}
+
+// UnderrunReporter is implemented by Outputs which can detect underruns.
+type UnderrunReporter interface {
+	// Underruns returns the number of times the Output ran out of audio and the estimated
+	// total length of the resulting gaps.
+	Underruns() (count int, total time.Duration)
+}
+
+// underrunDetector wraps the reader of a device which plays audio in real time. It compares the
+// amount of audio read with the time that passed to detect when the device must have run out of
+// audio.
+type underrunDetector struct {
+	r         io.Reader
+	format    OutputFormat
+	tolerance time.Duration    // the device's own buffer, which covers late reads
+	now       func() time.Time // replaceable for tests
+
+	mu    sync.Mutex
+	start time.Time // start of the current uninterrupted run
+	read  int       // samples read since start
+	count int
+	total time.Duration
+}
+
+func newUnderrunDetector(r io.Reader, format OutputFormat, tolerance time.Duration) *underrunDetector {
+	return &underrunDetector{
+		r:         r,
+		format:    format,
+		tolerance: tolerance,
+		now:       time.Now,
+	}
+}
+
+func (d *underrunDetector) Read(p []byte) (n int, err error) {
+	d.mu.Lock()
+	now := d.now()
+	if d.start.IsZero() {
+		d.start = now
+	} else if exhausted := d.start.Add(d.format.SampleRate.D(d.read) + d.tolerance); now.After(exhausted) {
+		d.count++
+		d.total += now.Sub(exhausted)
+		d.start = now
+		d.read = 0
+	}
+	d.mu.Unlock()
+
+	n, err = d.r.Read(p)
+
+	d.mu.Lock()
+	d.read += n / d.format.Width()
+	d.mu.Unlock()
+	return n, err
+}
+
+// reset restarts the detection, for example after the device was paused.
+func (d *underrunDetector) reset() {
+	d.mu.Lock()
+	d.start = time.Time{}
+	d.read = 0
+	d.mu.Unlock()
+}
+
+func (d *underrunDetector) Underruns() (count int, total time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.count, d.total
+}
@@ -0,0 +1,148 @@
+package speaker
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+func TestPlaybackStats_Played(t *testing.T) {
+	st := PlaybackStats{SampleRate: 1000, SamplesSent: 500, Latency: 100 * time.Millisecond}
+	assert.Equal(t, 400*time.Millisecond, st.Played())
+
+	st.Latency = time.Second
+	assert.Equal(t, time.Duration(0), st.Played())
+
+	assert.Equal(t, time.Duration(0), PlaybackStats{}.Played())
+}
+
+func TestSpeaker_Stats(t *testing.T) {
+	clock := NewVirtualClock()
+	var calls []PlaybackStats
+	sp, err := New(Options{
+		SampleRate:    44100,
+		BufferSize:    512,
+		Backend:       NewNullBackend(clock),
+		StatsCallback: func(st PlaybackStats) { calls = append(calls, st) },
+	})
+	assert.NoError(t, err)
+
+	assert.Equal(t, PlaybackStats{SampleRate: 44100}, sp.Stats())
+
+	clock.Advance(beep.SampleRate(44100).D(1000))
+	assert.Equal(t, PlaybackStats{SampleRate: 44100, SamplesSent: 1000}, sp.Stats())
+	assert.Equal(t, []PlaybackStats{
+		{SampleRate: 44100, SamplesSent: 512},
+		{SampleRate: 44100, SamplesSent: 1000},
+	}, calls)
+
+	assert.NoError(t, sp.Close())
+	assert.Equal(t, PlaybackStats{SamplesSent: 1000}, sp.Stats())
+}
+
+// latencyBackend opens Outputs which report a fixed latency.
+type latencyBackend struct {
+	Backend
+	latency time.Duration
+}
+
+func (b latencyBackend) Open(format OutputFormat, bufferSize int) (Output, error) {
+	o, err := b.Backend.Open(format, bufferSize)
+	return latencyOutput{o, b.latency}, err
+}
+
+type latencyOutput struct {
+	Output
+	latency time.Duration
+}
+
+func (o latencyOutput) Latency() time.Duration {
+	return o.latency
+}
+
+func TestSpeaker_PlayAndWaitIncludesLatency(t *testing.T) {
+	clock := NewVirtualClock()
+	backend := latencyBackend{NewWriterBackend(io.Discard, clock), 100 * time.Millisecond}
+	sp, err := New(Options{SampleRate: 1000, BufferSize: 10, Backend: backend})
+	assert.NoError(t, err)
+	defer sp.Close()
+
+	s, _ := testtools.RandomDataStreamer(500)
+	done := make(chan struct{})
+	go func() {
+		sp.PlayAndWait(s)
+		close(done)
+	}()
+
+	// Drain the streamer, including the read that finds it drained, without playing the latency.
+	drained := false
+	for !drained {
+		clock.Advance(10 * time.Millisecond)
+		sp.Lock()
+		drained = s.Position() == s.Len()
+		sp.Unlock()
+	}
+	clock.Advance(10 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("PlayAndWait returned before the latency had passed")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	clock.Advance(100 * time.Millisecond)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("PlayAndWait didn't return after the audio was played")
+	}
+}
+
+func TestUnderrunDetector(t *testing.T) {
+	now := time.Unix(0, 0)
+	d := newUnderrunDetector(bytes.NewReader(make([]byte, 1<<20)), OutputFormat{SampleRate: 1000, NumChannels: 2}, 20*time.Millisecond)
+	d.now = func() time.Time { return now }
+	buf := make([]byte, 10*stereo16.Width())
+
+	read := func() {
+		_, err := d.Read(buf)
+		assert.NoError(t, err)
+	}
+
+	// Reads which keep up with the playback, or are late less than the tolerance.
+	for i := 0; i < 10; i++ {
+		read()
+		now = now.Add(10 * time.Millisecond)
+	}
+	now = now.Add(15 * time.Millisecond)
+	read()
+	count, total := d.Underruns()
+	assert.Equal(t, 0, count)
+	assert.Equal(t, time.Duration(0), total)
+
+	// 110ms of audio was read, so the device ran out of audio at 130ms.
+	now = time.Unix(0, 0).Add(180 * time.Millisecond)
+	read()
+	count, total = d.Underruns()
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 50*time.Millisecond, total)
+
+	// After an underrun, the detection starts over.
+	now = now.Add(25 * time.Millisecond)
+	read()
+	count, total = d.Underruns()
+	assert.Equal(t, 1, count)
+	assert.Equal(t, 50*time.Millisecond, total)
+
+	// Time spent paused isn't an underrun.
+	d.reset()
+	now = now.Add(time.Hour)
+	read()
+	count, _ = d.Underruns()
+	assert.Equal(t, 1, count)
+}
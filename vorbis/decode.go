@@ -17,6 +17,9 @@ const (
 // Decode takes a ReadCloser containing audio data in ogg/vorbis format and returns a StreamSeekCloser,
 // which streams that audio. The Seek method will panic if rc is not io.Seeker.
 //
+// Unlike the WAV decoder, Stream allocates memory, because the oggvorbis library does while decoding
+// frames. Wrap the streamer in beep.Prefetch to keep decoding off the audio thread.
+//
 // Do not close the supplied ReadSeekCloser, instead, use the Close method of the returned
 // StreamSeekCloser when you want to release the resources.
 func Decode(rc io.ReadCloser) (s beep.StreamSeekCloser, format beep.Format, err error) {
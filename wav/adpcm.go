@@ -0,0 +1,334 @@
+package wav
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// imaStepTable and imaIndexTable are the step sizes and step index adjustments of IMA ADPCM.
+var (
+	imaStepTable = [89]int32{
+		7, 8, 9, 10, 11, 12, 13, 14, 16, 17,
+		19, 21, 23, 25, 28, 31, 34, 37, 41, 45,
+		50, 55, 60, 66, 73, 80, 88, 97, 107, 118,
+		130, 143, 157, 173, 190, 209, 230, 253, 279, 307,
+		337, 371, 408, 449, 494, 544, 598, 658, 724, 796,
+		876, 963, 1060, 1166, 1282, 1411, 1552, 1707, 1878, 2066,
+		2272, 2499, 2749, 3024, 3327, 3660, 4026, 4428, 4871, 5358,
+		5894, 6484, 7132, 7845, 8630, 9493, 10442, 11487, 12635, 13899,
+		15289, 16818, 18500, 20350, 22385, 24623, 27086, 29794, 32767,
+	}
+	imaIndexTable = [16]int32{-1, -1, -1, -1, 2, 4, 6, 8, -1, -1, -1, -1, 2, 4, 6, 8}
+)
+
+// msAdaptationTable and msCoefficients are the delta adaptation factors and the standard
+// predictor coefficients of Microsoft ADPCM.
+var (
+	msAdaptationTable = [16]int32{230, 230, 230, 230, 307, 409, 512, 614, 768, 614, 512, 409, 307, 230, 230, 230}
+	msCoefficients    = [][2]int32{{256, 0}, {512, -256}, {0, 0}, {192, 64}, {240, 0}, {460, -208}, {392, -232}}
+)
+
+// blockDecoder decodes ADPCM audio, which is stored in blocks of BytesPerFrame bytes. Each block
+// starts with the state of the decoder, so decoding and seeking happen block by block.
+type blockDecoder struct {
+	d               *decoder
+	ima             bool       // IMA ADPCM or Microsoft ADPCM
+	coefs           [][2]int32 // predictor coefficients of Microsoft ADPCM
+	blockAlign      int
+	samplesPerBlock int
+	length          int
+
+	block   []byte
+	decoded [][2]float64
+	next    int // index of the next sample in decoded
+	end     int // number of samples in decoded
+	pos     int
+}
+
+func newBlockDecoder(d *decoder) (*blockDecoder, error) {
+	b := &blockDecoder{
+		d:          d,
+		ima:        d.h.FormatType == formatTypeIMAADPCM,
+		blockAlign: int(d.h.BytesPerFrame),
+	}
+	channels := int(d.h.NumChans)
+	if channels > 2 {
+		return nil, errors.New("wav: unsupported number of ADPCM channels, 1 or 2 are supported")
+	}
+	if d.h.BitsPerSample != 4 {
+		return nil, errors.New("wav: unsupported number of bits per ADPCM sample, 4 is supported")
+	}
+	if b.blockAlign <= b.headerSize() {
+		return nil, errors.New("wav: invalid ADPCM block size")
+	}
+
+	// cbSize is followed by wSamplesPerBlock and, for Microsoft ADPCM, the coefficients.
+	extra := d.fmtExtra
+	if len(extra) >= 2 {
+		extra = extra[2:min(len(extra), 2+int(binary.LittleEndian.Uint16(extra)))]
+	}
+	b.samplesPerBlock = b.blockFrames(b.blockAlign)
+	if len(extra) >= 2 {
+		if spb := int(binary.LittleEndian.Uint16(extra)); spb > 0 && spb < b.samplesPerBlock {
+			b.samplesPerBlock = spb
+		}
+	}
+	b.coefs = msCoefficients
+	if !b.ima && len(extra) >= 4 {
+		numCoef := int(binary.LittleEndian.Uint16(extra[2:]))
+		if numCoef > 0 && len(extra) >= 4+4*numCoef {
+			b.coefs = make([][2]int32, numCoef)
+			for i := range b.coefs {
+				b.coefs[i][0] = int32(int16(binary.LittleEndian.Uint16(extra[4+4*i:])))
+				b.coefs[i][1] = int32(int16(binary.LittleEndian.Uint16(extra[6+4*i:])))
+			}
+		}
+	}
+
+	// Without a fact chunk, the length is determined by the size of the data.
+	numBlocks := d.h.DataSize / int64(b.blockAlign)
+	lastBlock := int(d.h.DataSize % int64(b.blockAlign))
+	b.length = int(numBlocks) * b.samplesPerBlock
+	if lastBlock > b.headerSize() {
+		b.length += min(b.blockFrames(lastBlock), b.samplesPerBlock)
+	}
+	if d.frames > 0 && int(d.frames) < b.length {
+		b.length = int(d.frames)
+	}
+
+	b.block = make([]byte, b.blockAlign)
+	b.decoded = make([][2]float64, b.blockFrames(b.blockAlign))
+	return b, nil
+}
+
+// headerSize returns the size of the header of each block.
+func (b *blockDecoder) headerSize() int {
+	if b.ima {
+		return 4 * int(b.d.h.NumChans)
+	}
+	return 7 * int(b.d.h.NumChans)
+}
+
+// blockFrames returns the number of frames in a block of size bytes.
+func (b *blockDecoder) blockFrames(size int) int {
+	channels := int(b.d.h.NumChans)
+	data := size - b.headerSize()
+	if data < 0 {
+		return 0
+	}
+	if b.ima {
+		// The first sample is in the header and the data holds groups of 8 samples per channel.
+		return 1 + data/(4*channels)*8
+	}
+	// The first two samples are in the header and each byte holds two samples.
+	return 2 + data*2/channels
+}
+
+func (b *blockDecoder) Stream(samples [][2]float64) (n int, ok bool) {
+	for n < len(samples) && b.pos < b.length {
+		if b.next == b.end && !b.readBlock() {
+			break
+		}
+		m := copy(samples[n:], b.decoded[b.next:min(b.end, b.next+b.length-b.pos)])
+		b.next += m
+		b.pos += m
+		n += m
+	}
+	return n, n > 0
+}
+
+// readBlock reads and decodes the next block. It returns false at the end of the data or if an
+// error occurred.
+func (b *blockDecoder) readBlock() bool {
+	d := b.d
+	if d.err != nil {
+		return false
+	}
+	size := int(min(int64(b.blockAlign), d.h.DataSize-d.pos))
+	if size <= b.headerSize() {
+		return false
+	}
+	size, err := io.ReadFull(d.r, b.block[:size])
+	d.pos += int64(size)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		d.err = errors.Wrap(err, "wav")
+		return false
+	}
+	if size <= b.headerSize() {
+		return false
+	}
+
+	var n int
+	if b.ima {
+		n = b.decodeIMA(b.block[:size])
+	} else {
+		n, err = b.decodeMS(b.block[:size])
+		if err != nil {
+			d.err = err
+			return false
+		}
+	}
+	b.next, b.end = 0, min(n, b.samplesPerBlock)
+	return true
+}
+
+// decodeIMA decodes a block of IMA ADPCM and returns the number of decoded frames.
+func (b *blockDecoder) decodeIMA(block []byte) int {
+	channels := int(b.d.h.NumChans)
+	var pred, index [2]int32
+	for c := 0; c < channels; c++ {
+		pred[c] = int32(int16(binary.LittleEndian.Uint16(block[4*c:])))
+		index[c] = min(int32(block[4*c+2]), 88)
+		b.decoded[0][c] = float64(pred[c]) / (1 << 15)
+	}
+
+	n := 1
+	for data := block[4*channels:]; len(data) >= 4*channels; data = data[4*channels:] {
+		for c := 0; c < channels; c++ {
+			for i, x := range data[4*c : 4*c+4] {
+				for j, nibble := range [2]byte{x & 0x0f, x >> 4} {
+					step := imaStepTable[index[c]]
+					diff := step >> 3
+					if nibble&4 != 0 {
+						diff += step
+					}
+					if nibble&2 != 0 {
+						diff += step >> 1
+					}
+					if nibble&1 != 0 {
+						diff += step >> 2
+					}
+					if nibble&8 != 0 {
+						diff = -diff
+					}
+					pred[c] = min(max(pred[c]+diff, -1<<15), 1<<15-1)
+					index[c] = min(max(index[c]+imaIndexTable[nibble], 0), 88)
+					b.decoded[n+2*i+j][c] = float64(pred[c]) / (1 << 15)
+				}
+			}
+		}
+		n += 8
+	}
+
+	if channels == 1 {
+		for i := range b.decoded[:n] {
+			b.decoded[i][1] = b.decoded[i][0]
+		}
+	}
+	return n
+}
+
+// decodeMS decodes a block of Microsoft ADPCM and returns the number of decoded frames.
+func (b *blockDecoder) decodeMS(block []byte) (int, error) {
+	channels := int(b.d.h.NumChans)
+	var coef [2][2]int32
+	var delta, s1, s2 [2]int32
+	for c := 0; c < channels; c++ {
+		i := int(block[c])
+		if i >= len(b.coefs) {
+			return 0, fmt.Errorf("wav: invalid MS ADPCM predictor index %d", i)
+		}
+		coef[c] = b.coefs[i]
+		delta[c] = int32(int16(binary.LittleEndian.Uint16(block[channels+2*c:])))
+		s1[c] = int32(int16(binary.LittleEndian.Uint16(block[3*channels+2*c:])))
+		s2[c] = int32(int16(binary.LittleEndian.Uint16(block[5*channels+2*c:])))
+		// The second sample of the block comes first.
+		b.decoded[0][c] = float64(s2[c]) / (1 << 15)
+		b.decoded[1][c] = float64(s1[c]) / (1 << 15)
+	}
+
+	n, c := 2, 0
+	for _, x := range block[7*channels:] {
+		// The high nibble comes first, the channels alternate.
+		for _, nibble := range [2]byte{x >> 4, x & 0x0f} {
+			signed := int32(nibble)
+			if signed >= 8 {
+				signed -= 16
+			}
+			pred := (s1[c]*coef[c][0]+s2[c]*coef[c][1])>>8 + signed*delta[c]
+			pred = min(max(pred, -1<<15), 1<<15-1)
+			s2[c], s1[c] = s1[c], pred
+			delta[c] = max(msAdaptationTable[nibble]*delta[c]>>8, 16)
+			b.decoded[n][c] = float64(pred) / (1 << 15)
+
+			c++
+			if c == channels {
+				c = 0
+				n++
+			}
+		}
+	}
+
+	if channels == 1 {
+		for i := range b.decoded[:n] {
+			b.decoded[i][1] = b.decoded[i][0]
+		}
+	}
+	return n, nil
+}
+
+func (b *blockDecoder) Err() error {
+	return b.d.err
+}
+
+func (b *blockDecoder) Len() int {
+	return b.length
+}
+
+func (b *blockDecoder) Position() int {
+	return b.pos
+}
+
+// Seek seeks to the start of the block containing p and skips the samples of the block before p.
+// If the resource isn't io.Seeker, it decodes and discards the samples up to p instead.
+func (b *blockDecoder) Seek(p int) error {
+	d := b.d
+	if p < 0 || b.length < p {
+		return fmt.Errorf("wav: seek position %v out of range [%v, %v]", p, 0, b.length)
+	}
+	if d.seeker == nil {
+		if p < b.pos {
+			return errors.New("wav: seek error: can't seek backwards, because the resource isn't io.Seeker")
+		}
+		samples := make([][2]float64, 512)
+		for b.pos < p {
+			if _, ok := b.Stream(samples[:min(len(samples), p-b.pos)]); !ok {
+				if d.err != nil {
+					return d.err
+				}
+				return errors.New("wav: seek error: missing block")
+			}
+		}
+		return nil
+	}
+	block := p / b.samplesPerBlock
+	pos := int64(block) * int64(b.blockAlign)
+	if _, err := d.seeker.Seek(pos+d.hsz, io.SeekStart); err != nil { // hsz is the size of the header
+		return errors.Wrap(err, "wav: seek error")
+	}
+	d.pos = pos
+	b.pos = block * b.samplesPerBlock
+	b.next, b.end = 0, 0
+	if skip := p - b.pos; skip > 0 {
+		if !b.readBlock() {
+			if d.err != nil {
+				return d.err
+			}
+			return errors.New("wav: seek error: missing block")
+		}
+		b.next = min(skip, b.end)
+		b.pos += b.next
+	}
+	return nil
+}
+
+func (b *blockDecoder) Metadata() *Metadata {
+	return b.d.Metadata()
+}
+
+func (b *blockDecoder) Close() error {
+	return b.d.Close()
+}
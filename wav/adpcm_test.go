@@ -0,0 +1,276 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+// compressedFile builds a WAVE file of a compressed format.
+func compressedFile(t *testing.T, formatType int16, format formatchunk, extra []byte, frames int, data []byte) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	write := func(data any) {
+		assert.NoError(t, binary.Write(&b, binary.LittleEndian, data))
+	}
+	write([]byte("RIFF"))
+	write(uint32(0)) // filled in below
+	write([]byte("WAVE"))
+	write([]byte("fmt "))
+	write(uint32(16 + 2 + len(extra)))
+	write(formatType)
+	write(format)
+	write(uint16(len(extra)))
+	write(extra)
+	if frames >= 0 {
+		write([]byte("fact"))
+		write(uint32(4))
+		write(uint32(frames))
+	}
+	write([]byte("data"))
+	write(uint32(len(data)))
+	write(data)
+	file := b.Bytes()
+	binary.LittleEndian.PutUint32(file[4:], uint32(len(file)-8))
+	return file
+}
+
+// sine returns n samples of a sine wave as 16-bit integers.
+func sine(n int) []int32 {
+	s := make([]int32, n)
+	for i := range s {
+		s[i] = int32(10000 * math.Sin(float64(i)/20))
+	}
+	return s
+}
+
+// encodeIMA encodes mono samples as IMA ADPCM blocks with the given number of samples per block.
+func encodeIMA(samples []int32, samplesPerBlock int) []byte {
+	var (
+		out   []byte
+		index int32 // carried over to the next block
+	)
+	for len(samples) > 0 {
+		block := samples[:min(samplesPerBlock, len(samples))]
+		samples = samples[len(block):]
+
+		pred := block[0]
+		out = binary.LittleEndian.AppendUint16(out, uint16(int16(pred)))
+		out = append(out, byte(index), 0)
+		var nibbles []byte
+		for _, x := range block[1:] {
+			step := imaStepTable[index]
+			diff := x - pred
+			var nibble byte
+			if diff < 0 {
+				nibble = 8
+				diff = -diff
+			}
+			if diff >= step {
+				nibble |= 4
+				diff -= step
+			}
+			if diff >= step>>1 {
+				nibble |= 2
+				diff -= step >> 1
+			}
+			if diff >= step>>2 {
+				nibble |= 1
+			}
+
+			// Track the decoder.
+			d := step >> 3
+			if nibble&4 != 0 {
+				d += step
+			}
+			if nibble&2 != 0 {
+				d += step >> 1
+			}
+			if nibble&1 != 0 {
+				d += step >> 2
+			}
+			if nibble&8 != 0 {
+				d = -d
+			}
+			pred = min(max(pred+d, -1<<15), 1<<15-1)
+			index = min(max(index+imaIndexTable[nibble], 0), 88)
+			nibbles = append(nibbles, nibble)
+		}
+		for len(nibbles)%8 != 0 {
+			nibbles = append(nibbles, 0)
+		}
+		for i := 0; i < len(nibbles); i += 2 {
+			out = append(out, nibbles[i]|nibbles[i+1]<<4)
+		}
+	}
+	return out
+}
+
+// encodeMS encodes mono samples as Microsoft ADPCM blocks with the given number of samples per
+// block, always using the second standard predictor.
+func encodeMS(samples []int32, samplesPerBlock int) []byte {
+	var (
+		out   []byte
+		delta = int32(16) // carried over to the next block
+	)
+	for len(samples) > 0 {
+		block := samples[:min(samplesPerBlock, len(samples))]
+		samples = samples[len(block):]
+
+		s2, s1 := block[0], block[1]
+		out = append(out, 1)
+		out = binary.LittleEndian.AppendUint16(out, uint16(int16(delta)))
+		out = binary.LittleEndian.AppendUint16(out, uint16(int16(s1)))
+		out = binary.LittleEndian.AppendUint16(out, uint16(int16(s2)))
+		var nibbles []byte
+		for _, x := range block[2:] {
+			pred := (s1*512 - s2*256) >> 8
+			e := (x - pred) / delta
+			e = min(max(e, -8), 7)
+			nibbles = append(nibbles, byte(e)&0x0f)
+			pred = min(max(pred+e*delta, -1<<15), 1<<15-1)
+			s2, s1 = s1, pred
+			delta = max(msAdaptationTable[byte(e)&0x0f]*delta>>8, 16)
+		}
+		if len(nibbles)%2 != 0 {
+			nibbles = append(nibbles, 0)
+		}
+		for i := 0; i < len(nibbles); i += 2 {
+			out = append(out, nibbles[i]<<4|nibbles[i+1])
+		}
+	}
+	return out
+}
+
+func TestDecode_ADPCM(t *testing.T) {
+	const numSamples = 1000
+	samples := sine(numSamples)
+
+	tests := []struct {
+		name       string
+		formatType int16
+		blockAlign int16
+		extra      func(samplesPerBlock int) []byte
+		encode     func(samples []int32, samplesPerBlock int) []byte
+		spb        int
+	}{
+		{
+			name:       "IMA",
+			formatType: formatTypeIMAADPCM,
+			blockAlign: 256,
+			spb:        505,
+			extra: func(spb int) []byte {
+				return binary.LittleEndian.AppendUint16(nil, uint16(spb))
+			},
+			encode: encodeIMA,
+		},
+		{
+			name:       "MS",
+			formatType: formatTypeMSADPCM,
+			blockAlign: 256,
+			spb:        500,
+			extra: func(spb int) []byte {
+				extra := binary.LittleEndian.AppendUint16(nil, uint16(spb))
+				extra = binary.LittleEndian.AppendUint16(extra, uint16(len(msCoefficients)))
+				for _, c := range msCoefficients {
+					extra = binary.LittleEndian.AppendUint16(extra, uint16(int16(c[0])))
+					extra = binary.LittleEndian.AppendUint16(extra, uint16(int16(c[1])))
+				}
+				return extra
+			},
+			encode: encodeMS,
+		},
+	}
+	for _, test := range tests {
+		for _, fact := range []bool{true, false} {
+			t.Run(fmt.Sprintf("%s/fact=%v", test.name, fact), func(t *testing.T) {
+				frames := -1
+				if fact {
+					frames = numSamples
+				}
+				format := formatchunk{NumChans: 1, SampleRate: 8000, ByteRate: 4055, BytesPerFrame: test.blockAlign, BitsPerSample: 4}
+				data := test.encode(samples, test.spb)
+				file := compressedFile(t, test.formatType, format, test.extra(test.spb), frames, data)
+
+				s, f, err := Decode(bytes.NewReader(file))
+				assert.NoError(t, err)
+				assert.Equal(t, beep.Format{SampleRate: 8000, NumChannels: 1, Precision: 2}, f)
+				if fact {
+					assert.Equal(t, numSamples, s.Len())
+				} else {
+					// The last block is padded to whole groups of samples.
+					assert.GreaterOrEqual(t, s.Len(), numSamples)
+				}
+
+				decoded := testtools.Collect(s)
+				assert.NoError(t, s.Err())
+				assert.Len(t, decoded, s.Len())
+				for i, x := range samples {
+					if i < 10 {
+						// The step size of the first block still adapts to the signal.
+						continue
+					}
+					assert.InDelta(t, float64(x)/(1<<15), decoded[i][0], 0.05, "sample %d", i)
+					assert.Equal(t, decoded[i][0], decoded[i][1])
+				}
+
+				// Seeking into the middle of a block decodes the same samples.
+				for _, p := range []int{0, 1, test.spb - 1, test.spb, test.spb + 17, 900} {
+					assert.NoError(t, s.Seek(p))
+					assert.Equal(t, p, s.Position())
+					got := testtools.CollectNum(10, s)
+					testtools.AssertSamplesEqual(t, decoded[p:p+10], got)
+				}
+			})
+		}
+	}
+}
+
+func TestDecode_ADPCMStereo(t *testing.T) {
+	// One IMA ADPCM block with 9 frames: the headers hold the first samples and one group of 8
+	// samples follows per channel.
+	data := []byte{
+		0x00, 0x01, 0x00, 0x00, // left: 256, step index 0
+		0x00, 0xff, 0x00, 0x00, // right: -256, step index 0
+		0x77, 0x77, 0x77, 0x77, // left: increasing
+		0xff, 0xff, 0xff, 0xff, // right: decreasing
+	}
+	format := formatchunk{NumChans: 2, SampleRate: 8000, ByteRate: 8000, BytesPerFrame: 16, BitsPerSample: 4}
+	file := compressedFile(t, formatTypeIMAADPCM, format, binary.LittleEndian.AppendUint16(nil, 9), 9, data)
+
+	s, _, err := Decode(bytes.NewReader(file))
+	assert.NoError(t, err)
+	decoded := testtools.Collect(s)
+	assert.Len(t, decoded, 9)
+	assert.Equal(t, [2]float64{256.0 / (1 << 15), -256.0 / (1 << 15)}, decoded[0])
+	// The first step adds 7>>3 + 7 + 7>>1 + 7>>2 = 11.
+	assert.Equal(t, [2]float64{267.0 / (1 << 15), -267.0 / (1 << 15)}, decoded[1])
+	for i := 1; i < len(decoded); i++ {
+		assert.Greater(t, decoded[i][0], decoded[i-1][0])
+		assert.Less(t, decoded[i][1], decoded[i-1][1])
+	}
+}
+
+func TestDecode_ADPCMInvalid(t *testing.T) {
+	format := formatchunk{NumChans: 1, SampleRate: 8000, ByteRate: 8000, BytesPerFrame: 4, BitsPerSample: 4}
+	_, _, err := Decode(bytes.NewReader(compressedFile(t, formatTypeIMAADPCM, format, nil, -1, nil)))
+	assert.Error(t, err, "a block must be larger than its header")
+
+	format = formatchunk{NumChans: 3, SampleRate: 8000, ByteRate: 8000, BytesPerFrame: 256, BitsPerSample: 4}
+	_, _, err = Decode(bytes.NewReader(compressedFile(t, formatTypeMSADPCM, format, nil, -1, nil)))
+	assert.Error(t, err)
+
+	// The predictor index is out of range.
+	format = formatchunk{NumChans: 1, SampleRate: 8000, ByteRate: 8000, BytesPerFrame: 8, BitsPerSample: 4}
+	s, _, err := Decode(bytes.NewReader(compressedFile(t, formatTypeMSADPCM, format, nil, -1, []byte{9, 16, 0, 0, 0, 0, 0, 0})))
+	assert.NoError(t, err)
+	testtools.Collect(s)
+	assert.Error(t, s.Err())
+}
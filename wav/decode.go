@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"math"
-	"time"
 
 	"github.com/pkg/errors"
 
@@ -14,12 +13,29 @@ import (
 )
 
 // Decode takes a Reader containing audio data in WAVE format and returns a StreamSeekCloser,
-// which streams that audio. The Seek method will panic if rc is not io.Seeker.
+// which streams that audio. If r can't seek, like a pipe or a network connection, the Seek
+// method only seeks forward by discarding the audio in between and returns an error otherwise.
+// If reading fails while discarding, Seek returns the error and the position is left where the
+// reading stopped.
+//
+// Besides integer PCM and IEEE float audio, G.711 A-law and µ-law as well as IMA and Microsoft
+// ADPCM are decoded. ADPCM audio is stored in blocks, so seeking decodes from the start of the
+// block containing the position.
+//
+// The returned StreamSeekCloser implements MetadataStreamer, which provides the LIST/INFO, bext,
+// cue and smpl chunks preceding the audio data. Use ReadMetadata to also read the chunks which
+// follow the audio data.
 //
 // Do not close the supplied Reader, instead, use the Close method of the returned
 // StreamSeekCloser when you want to release the resources.
 func Decode(r io.Reader) (s beep.StreamSeekCloser, format beep.Format, err error) {
-	d := decoder{r: r}
+	d := decoder{r: r, metadata: new(Metadata)}
+	if seeker, ok := r.(io.Seeker); ok {
+		// Files like stdin may be pipes which can't seek.
+		if _, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			d.seeker = seeker
+		}
+	}
 	defer func() { // hacky way to always close r if an error occurred
 		if closer, ok := d.r.(io.Closer); ok {
 			if err != nil {
@@ -32,14 +48,18 @@ func Decode(r io.Reader) (s beep.StreamSeekCloser, format beep.Format, err error
 	if err := binary.Read(r, binary.LittleEndian, d.h.RiffMark[:]); err != nil {
 		return nil, beep.Format{}, errors.Wrap(err, "wav")
 	}
-	if string(d.h.RiffMark[:]) != "RIFF" {
+	// RF64 and BW64 files store the sizes which don't fit into 32 bits in a ds64 chunk.
+	rf64 := string(d.h.RiffMark[:]) == "RF64" || string(d.h.RiffMark[:]) == "BW64"
+	if string(d.h.RiffMark[:]) != "RIFF" && !rf64 {
 		return nil, beep.Format{}, fmt.Errorf("wav: missing RIFF at the beginning > %s", string(d.h.RiffMark[:]))
 	}
 
 	// READ Total file size
-	if err := binary.Read(r, binary.LittleEndian, &d.h.FileSize); err != nil {
+	var size32 uint32
+	if err := binary.Read(r, binary.LittleEndian, &size32); err != nil {
 		return nil, beep.Format{}, errors.Wrap(err, "wav: missing RIFF file size")
 	}
+	d.h.FileSize = int64(size32)
 	if err := binary.Read(r, binary.LittleEndian, d.h.WaveMark[:]); err != nil {
 		return nil, beep.Format{}, errors.Wrap(err, "wav: missing RIFF file type")
 	}
@@ -49,19 +69,41 @@ func Decode(r io.Reader) (s beep.StreamSeekCloser, format beep.Format, err error
 
 	// check each formtypes
 	ft := [4]byte{0, 0, 0, 0}
-	var fs int32
+	var (
+		fs   uint32
+		ds64 *ds64chunk
+	)
 	d.hsz = 4 + 4 + 4 // add size of (RiffMark + FileSize + WaveMark)
 	for string(ft[:]) != "data" {
 		if err = binary.Read(r, binary.LittleEndian, ft[:]); err != nil {
 			return nil, beep.Format{}, errors.Wrap(err, "wav: missing chunk type")
 		}
 		switch {
+		case string(ft[:]) == "ds64" && rf64:
+			if err := binary.Read(r, binary.LittleEndian, &fs); err != nil {
+				return nil, beep.Format{}, errors.Wrap(err, "wav: missing ds64 chunk size")
+			}
+			if fs < 28 {
+				return nil, beep.Format{}, errors.New("wav: invalid ds64 chunk size")
+			}
+			ds64 = new(ds64chunk)
+			if err := binary.Read(r, binary.LittleEndian, ds64); err != nil {
+				return nil, beep.Format{}, errors.Wrap(err, "wav: missing ds64 chunk body")
+			}
+			// skip the table of other chunk sizes, which aren't needed
+			if _, err := io.CopyN(io.Discard, r, int64(fs)-28); err != nil {
+				return nil, beep.Format{}, errors.Wrap(err, "wav: missing ds64 chunk body")
+			}
+			if ds64.RiffSize != 0 && d.h.FileSize == 0xFFFFFFFF {
+				d.h.FileSize = int64(ds64.RiffSize)
+			}
+			d.hsz += 4 + 4 + int64(fs) + int64(fs)%2
 		case string(ft[:]) == "fmt ":
 			d.h.FmtMark = ft
 			if err := binary.Read(r, binary.LittleEndian, &d.h.FormatSize); err != nil {
 				return nil, beep.Format{}, errors.New("wav: missing format chunk size")
 			}
-			d.hsz += 4 + 4 + d.h.FormatSize // add size of (FmtMark + FormatSize + its trailing size)
+			d.hsz += 4 + 4 + int64(d.h.FormatSize) // add size of (FmtMark + FormatSize + its trailing size)
 			if err := binary.Read(r, binary.LittleEndian, &d.h.FormatType); err != nil {
 				return nil, beep.Format{}, errors.New("wav: missing format type")
 			}
@@ -79,14 +121,20 @@ func Decode(r io.Reader) (s beep.StreamSeekCloser, format beep.Format, err error
 				d.h.ByteRate = fmtchunk.ByteRate
 				d.h.BytesPerFrame = fmtchunk.BytesPerFrame
 				d.h.BitsPerSample = fmtchunk.BitsPerSample
+				d.validBits = fmtchunk.Samples
 
-				// SubFormat is represented by GUID. Plain PCM is KSDATAFORMAT_SUBTYPE_PCM GUID.
-				// See https://docs.microsoft.com/en-us/windows-hardware/drivers/ddi/content/ksmedia/ns-ksmedia-waveformatextensible
-				pcmguid := guid{
-					0x00000001, 0x0000, 0x0010,
-					[8]byte{0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71},
+				// skip any extra bytes after WAVEFORMATEXTENSIBLE
+				if d.h.FormatSize > 40 {
+					if _, err := io.CopyN(io.Discard, r, int64(d.h.FormatSize-40)); err != nil {
+						return nil, beep.Format{}, errors.Wrap(err, "wav: missing extended format chunk body")
+					}
 				}
-				if fmtchunk.SubFormat != pcmguid {
+
+				switch fmtchunk.SubFormat {
+				case subFormatPCM:
+				case subFormatFloat:
+					d.float = true
+				default:
 					return nil, beep.Format{}, fmt.Errorf(
 						"wav: unsupported sub format type - %08x-%04x-%04x-%s",
 						fmtchunk.SubFormat.Data1, fmtchunk.SubFormat.Data2, fmtchunk.SubFormat.Data3,
@@ -104,33 +152,59 @@ func Decode(r io.Reader) (s beep.StreamSeekCloser, format beep.Format, err error
 				d.h.ByteRate = fmtchunk.ByteRate
 				d.h.BytesPerFrame = fmtchunk.BytesPerFrame
 				d.h.BitsPerSample = fmtchunk.BitsPerSample
+				d.float = d.h.FormatType == formatTypeFloat
 
-				// it would be skipping cbSize (WAVEFORMATEX's last member).
+				// keep cbSize (WAVEFORMATEX's last member) and the extra information of
+				// compressed formats following it
 				if d.h.FormatSize > 16 {
-					trash := make([]byte, d.h.FormatSize-16)
-					if err := binary.Read(r, binary.LittleEndian, trash); err != nil {
+					d.fmtExtra = make([]byte, d.h.FormatSize-16)
+					if err := binary.Read(r, binary.LittleEndian, d.fmtExtra); err != nil {
 						return nil, beep.Format{}, errors.Wrap(err, "wav: missing extended format chunk body")
 					}
 				}
 			}
+		case string(ft[:]) == "fact":
+			// The fact chunk holds the number of frames of compressed formats.
+			if err := binary.Read(r, binary.LittleEndian, &fs); err != nil {
+				return nil, beep.Format{}, errors.Wrap(err, "wav: missing fact chunk size")
+			}
+			body := make([]byte, int64(fs)+int64(fs)%2)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return nil, beep.Format{}, errors.Wrap(err, "wav: missing fact chunk body")
+			}
+			if fs >= 4 {
+				d.frames = int64(binary.LittleEndian.Uint32(body))
+			}
+			d.hsz += 4 + 4 + int64(len(body))
 		case string(ft[:]) == "data":
 			d.h.DataMark = ft
-			if err := binary.Read(r, binary.LittleEndian, &d.h.DataSize); err != nil {
+			if err := binary.Read(r, binary.LittleEndian, &size32); err != nil {
 				return nil, beep.Format{}, errors.Wrap(err, "wav: missing data chunk size")
 			}
+			d.h.DataSize = int64(size32)
+			if ds64 != nil && size32 == 0xFFFFFFFF {
+				d.h.DataSize = int64(ds64.DataSize)
+			}
 			d.hsz += 4 + 4 //add size of (DataMark + DataSize)
+		case isMetadataChunk(string(ft[:])):
+			if err := binary.Read(r, binary.LittleEndian, &fs); err != nil {
+				return nil, beep.Format{}, errors.Wrapf(err, "wav: missing %s chunk size", string(ft[:]))
+			}
+			body := make([]byte, int64(fs)+int64(fs)%2)
+			if _, err := io.ReadFull(r, body); err != nil {
+				return nil, beep.Format{}, errors.Wrapf(err, "wav: missing %s chunk body", string(ft[:]))
+			}
+			d.metadata.parseChunk(string(ft[:]), body[:fs])
+			d.hsz += 4 + 4 + int64(len(body))
 		default:
 			if err := binary.Read(r, binary.LittleEndian, &fs); err != nil {
 				return nil, beep.Format{}, errors.Wrap(err, "wav: missing unknown chunk size")
 			}
-			if fs%2 != 0 {
-				fs = fs + 1
-			}
-			trash := make([]byte, fs)
-			if err := binary.Read(r, binary.LittleEndian, trash); err != nil {
+			skip := int64(fs) + int64(fs)%2
+			if _, err := io.CopyN(io.Discard, r, skip); err != nil {
 				return nil, beep.Format{}, errors.Wrap(err, "wav: missing unknown chunk body")
 			}
-			d.hsz += 4 + 4 + fs //add size of (Unknown formtype + formsize + its trailing size)
+			d.hsz += 4 + 4 + skip //add size of (Unknown formtype + formsize + its trailing size)
 		}
 	}
 
@@ -140,15 +214,53 @@ func Decode(r io.Reader) (s beep.StreamSeekCloser, format beep.Format, err error
 	if string(d.h.DataMark[:]) != "data" {
 		return nil, beep.Format{}, errors.New("wav: missing data chunk marker")
 	}
-	if d.h.FormatType != 1 && d.h.FormatType != -2 && d.h.FormatType != 3 {
-		return nil, beep.Format{}, fmt.Errorf("wav: unsupported format type - %d", d.h.FormatType)
-	}
 	if d.h.NumChans <= 0 {
 		return nil, beep.Format{}, errors.New("wav: invalid number of channels (less than 1)")
 	}
-	if d.h.BitsPerSample != 8 && d.h.BitsPerSample != 16 && d.h.BitsPerSample != 24 && (d.h.FormatType != 3 || d.h.BitsPerSample != 32) {
+	switch d.h.FormatType {
+	case formatTypePCM, formatTypeFloat, formatTypeExtensible:
+	case formatTypeALaw, formatTypeMuLaw:
+		if d.h.BitsPerSample != 8 {
+			return nil, beep.Format{}, errors.New("wav: unsupported number of bits per G.711 sample, 8 is supported")
+		}
+		format = beep.Format{
+			SampleRate:  beep.SampleRate(d.h.SampleRate),
+			NumChannels: int(d.h.NumChans),
+			Precision:   2, // G.711 decodes to 13 or 14 bits
+		}
+		if int(d.h.BytesPerFrame) < int(d.h.NumChans) {
+			return nil, beep.Format{}, errors.New("wav: invalid number of bytes per frame")
+		}
+		return &d, format, nil
+	case formatTypeIMAADPCM, formatTypeMSADPCM:
+		bd, err := newBlockDecoder(&d)
+		if err != nil {
+			return nil, beep.Format{}, err
+		}
+		format = beep.Format{
+			SampleRate:  beep.SampleRate(d.h.SampleRate),
+			NumChannels: int(d.h.NumChans),
+			Precision:   2, // ADPCM decodes to 16 bits
+		}
+		return bd, format, nil
+	default:
+		return nil, beep.Format{}, fmt.Errorf("wav: unsupported format type - %d", d.h.FormatType)
+	}
+	if d.float && d.h.BitsPerSample != 32 && d.h.BitsPerSample != 64 {
+		return nil, beep.Format{}, errors.New("wav: unsupported number of bits per float sample, 32 or 64 are supported")
+	}
+	if !d.float && d.h.BitsPerSample != 8 && d.h.BitsPerSample != 16 && d.h.BitsPerSample != 24 && d.h.BitsPerSample != 32 {
 		return nil, beep.Format{}, errors.New("wav: unsupported number of bits per sample, 8 or 16 or 24 or 32 are supported")
 	}
+	if int(d.h.BytesPerFrame) < int(d.h.NumChans)*int(d.h.BitsPerSample/8) {
+		return nil, beep.Format{}, errors.New("wav: invalid number of bytes per frame")
+	}
+	if d.validBits == 0 || d.float {
+		d.validBits = d.h.BitsPerSample
+	}
+	if d.validBits < 0 || d.validBits > d.h.BitsPerSample {
+		return nil, beep.Format{}, errors.New("wav: invalid number of valid bits per sample")
+	}
 	format = beep.Format{
 		SampleRate:  beep.SampleRate(d.h.SampleRate),
 		NumChannels: int(d.h.NumChans),
@@ -164,6 +276,20 @@ type guid struct {
 	Data4 [8]byte
 }
 
+// SubFormat of WAVEFORMATEXTENSIBLE is represented by GUID. Plain PCM is KSDATAFORMAT_SUBTYPE_PCM
+// GUID and floating point samples are KSDATAFORMAT_SUBTYPE_IEEE_FLOAT GUID.
+// See https://docs.microsoft.com/en-us/windows-hardware/drivers/ddi/content/ksmedia/ns-ksmedia-waveformatextensible
+var (
+	subFormatPCM = guid{
+		0x00000001, 0x0000, 0x0010,
+		[8]byte{0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71},
+	}
+	subFormatFloat = guid{
+		0x00000003, 0x0000, 0x0010,
+		[8]byte{0x80, 0x00, 0x00, 0xaa, 0x00, 0x38, 0x9b, 0x71},
+	}
+)
+
 type formatchunk struct {
 	NumChans      int16
 	SampleRate    int32
@@ -180,9 +306,17 @@ type formatchunkextensible struct {
 	SubFormat     guid
 }
 
+// ds64chunk is the start of the ds64 chunk of RF64 and BW64 files.
+type ds64chunk struct {
+	RiffSize    uint64
+	DataSize    uint64
+	SampleCount uint64
+	TableLength uint32
+}
+
 type header struct {
 	RiffMark      [4]byte
-	FileSize      int32
+	FileSize      int64
 	WaveMark      [4]byte
 	FmtMark       [4]byte
 	FormatSize    int32
@@ -193,15 +327,23 @@ type header struct {
 	BytesPerFrame int16
 	BitsPerSample int16
 	DataMark      [4]byte
-	DataSize      int32
+	DataSize      int64
 }
 
 type decoder struct {
-	r   io.Reader
-	h   header
-	hsz int32
-	pos int32
-	err error
+	r         io.Reader
+	seeker    io.Seeker // nil if r can't seek
+	h         header
+	float     bool   // whether samples are IEEE floats
+	validBits int16  // number of bits which are used of each sample, starting with the most significant one
+	fmtExtra  []byte // cbSize and the following bytes of WAVEFORMATEX
+	frames    int64  // number of frames from the fact chunk, or 0
+	metadata  *Metadata
+	hsz       int64
+	pos       int64
+	err       error
+	buf       []byte
+	left      int // number of bytes of a partial frame at the start of buf
 }
 
 func (d *decoder) Stream(samples [][2]float64) (n int, ok bool) {
@@ -210,63 +352,74 @@ func (d *decoder) Stream(samples [][2]float64) (n int, ok bool) {
 	}
 	bytesPerFrame := int(d.h.BytesPerFrame)
 	wantBytes := len(samples) * bytesPerFrame
-	availableBytes := int(d.h.DataSize - d.pos)
-	numBytes := min(wantBytes, availableBytes)
-	p := make([]byte, numBytes)
-	n, err := d.r.Read(p)
-	if err != nil && err != io.EOF {
-		d.err = err
+	numBytes := int(min(int64(wantBytes), d.h.DataSize-d.pos))
+	if numBytes < bytesPerFrame {
+		return 0, false
 	}
-	switch {
-	case d.h.BitsPerSample == 8 && d.h.NumChans == 1:
-		for i, j := 0, 0; i <= n-bytesPerFrame; i, j = i+bytesPerFrame, j+1 {
-			val := float64(p[i])/(1<<8)*2 - 1
-			samples[j][0] = val
-			samples[j][1] = val
-		}
-	case d.h.BitsPerSample == 8 && d.h.NumChans >= 2:
-		for i, j := 0, 0; i <= n-bytesPerFrame; i, j = i+bytesPerFrame, j+1 {
-			samples[j][0] = float64(p[i+0])/(1<<8)*2 - 1
-			samples[j][1] = float64(p[i+1])/(1<<8)*2 - 1
-		}
-	case d.h.BitsPerSample == 16 && d.h.NumChans == 1:
-		for i, j := 0, 0; i <= n-bytesPerFrame; i, j = i+bytesPerFrame, j+1 {
-			val := float64(int16(p[i+0])+int16(p[i+1])*(1<<8)) / (1 << 15)
-			samples[j][0] = val
-			samples[j][1] = val
-		}
-	case d.h.BitsPerSample == 16 && d.h.NumChans >= 2:
-		for i, j := 0, 0; i <= n-bytesPerFrame; i, j = i+bytesPerFrame, j+1 {
-			samples[j][0] = float64(int16(p[i+0])+int16(p[i+1])*(1<<8)) / (1 << 15)
-			samples[j][1] = float64(int16(p[i+2])+int16(p[i+3])*(1<<8)) / (1 << 15)
-		}
-	case d.h.BitsPerSample == 24 && d.h.NumChans == 1:
-		for i, j := 0, 0; i <= n-bytesPerFrame; i, j = i+bytesPerFrame, j+1 {
-			val := float64((int32(p[i+0])<<8)+(int32(p[i+1])<<16)+(int32(p[i+2])<<24)) / (1 << 8) / (1 << 23)
-			samples[j][0] = val
-			samples[j][1] = val
-		}
-	case d.h.BitsPerSample == 24 && d.h.NumChans >= 2:
-		for i, j := 0, 0; i <= n-bytesPerFrame; i, j = i+bytesPerFrame, j+1 {
-			samples[j][0] = float64((int32(p[i+0])<<8)+(int32(p[i+1])<<16)+(int32(p[i+2])<<24)) / (1 << 8) / (1 << 23)
-			samples[j][1] = float64((int32(p[i+3])<<8)+(int32(p[i+4])<<16)+(int32(p[i+5])<<24)) / (1 << 8) / (1 << 23)
-		}
-	case d.h.FormatType == 3 && d.h.BitsPerSample == 32 && d.h.NumChans == 1:
-		for i, j := 0, 0; i <= n-bytesPerFrame; i, j = i+bytesPerFrame, j+1 {
-			val := math.Float32frombits(binary.LittleEndian.Uint32(p[i : i+4]))
-			samples[j][0] = float64(val)
-			samples[j][1] = float64(val)
+	if len(d.buf) < numBytes {
+		buf := make([]byte, numBytes)
+		copy(buf, d.buf[:d.left])
+		d.buf = buf
+	}
+
+	// The whole request is read, because returning fewer samples signals the end of the audio.
+	// A partial frame at the end of a read, like after seeking, is kept for the next call.
+	read, err := io.ReadFull(d.r, d.buf[d.left:numBytes])
+	numBytes = d.left + read
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		d.err = errors.Wrap(err, "wav")
+	}
+	// On io.EOF, the data chunk ended early, as in streams written with the maximum size.
+
+	p := d.buf[:numBytes]
+	bytesPerSample := int(d.h.BitsPerSample / 8)
+	for i, j := 0, 0; i <= numBytes-bytesPerFrame; i, j = i+bytesPerFrame, j+1 {
+		left := d.decodeSample(p[i:])
+		right := left
+		if d.h.NumChans >= 2 {
+			right = d.decodeSample(p[i+bytesPerSample:])
 		}
-	case d.h.FormatType == 3 && d.h.BitsPerSample == 32 && d.h.NumChans >= 2:
-		for i, j := 0, 0; i <= n-bytesPerFrame; i, j = i+bytesPerFrame, j+1 {
-			left := math.Float32frombits(binary.LittleEndian.Uint32(p[i : i+4]))
-			right := math.Float32frombits(binary.LittleEndian.Uint32(p[i+4 : i+8]))
-			samples[j][0] = float64(left)
-			samples[j][1] = float64(right)
+		samples[j][0] = left
+		samples[j][1] = right
+	}
+	n = numBytes / bytesPerFrame
+	d.left = copy(d.buf, p[n*bytesPerFrame:])
+	d.pos += int64(n * bytesPerFrame)
+	return n, n > 0
+}
+
+// decodeSample decodes a single sample from the start of p.
+func (d *decoder) decodeSample(p []byte) float64 {
+	if d.float {
+		if d.h.BitsPerSample == 32 {
+			return float64(math.Float32frombits(binary.LittleEndian.Uint32(p)))
 		}
+		return math.Float64frombits(binary.LittleEndian.Uint64(p))
 	}
-	d.pos += int32(n)
-	return n / bytesPerFrame, true
+
+	switch d.h.FormatType {
+	case formatTypeALaw:
+		return float64(alawToLinear[p[0]]) / (1 << 15)
+	case formatTypeMuLaw:
+		return float64(mulawToLinear[p[0]]) / (1 << 15)
+	}
+
+	// Integer samples are aligned to the most significant bits of an int32.
+	var x int32
+	switch d.h.BitsPerSample {
+	case 8:
+		// 8-bit samples are unsigned.
+		x = int32(uint32(p[0])<<24 ^ 1<<31)
+	case 16:
+		x = int32(uint32(p[0])<<16 | uint32(p[1])<<24)
+	case 24:
+		x = int32(uint32(p[0])<<8 | uint32(p[1])<<16 | uint32(p[2])<<24)
+	case 32:
+		x = int32(binary.LittleEndian.Uint32(p))
+	}
+	// Ignore the bits below the valid ones.
+	x &^= 1<<(32-d.validBits) - 1
+	return float64(x) / (1 << 31)
 }
 
 func (d *decoder) Err() error {
@@ -274,32 +427,55 @@ func (d *decoder) Err() error {
 }
 
 func (d *decoder) Len() int {
-	numBytes := time.Duration(d.h.DataSize)
-	perFrame := time.Duration(d.h.BytesPerFrame)
-	return int(numBytes / perFrame)
+	return int(d.h.DataSize / int64(d.h.BytesPerFrame))
 }
 
 func (d *decoder) Position() int {
-	return int(d.pos / int32(d.h.BytesPerFrame))
+	return int(d.pos / int64(d.h.BytesPerFrame))
 }
 
 func (d *decoder) Seek(p int) error {
-	seeker, ok := d.r.(io.Seeker)
-	if !ok {
-		panic(fmt.Errorf("wav: seek: resource is not io.Seeker"))
-	}
 	if p < 0 || d.Len() < p {
 		return fmt.Errorf("wav: seek position %v out of range [%v, %v]", p, 0, d.Len())
 	}
-	pos := int32(p) * int32(d.h.BytesPerFrame)
-	_, err := seeker.Seek(int64(pos+d.hsz), io.SeekStart) // hsz is the size of the header
+	pos := int64(p) * int64(d.h.BytesPerFrame)
+	if d.seeker == nil {
+		if pos < d.pos {
+			return errors.New("wav: seek error: can't seek backwards, because the resource isn't io.Seeker")
+		}
+		// Discard the audio up to the position. Like in Stream, the bytes of a partial frame
+		// are kept, so that the position stays consistent with r if reading fails midway.
+		bytesPerFrame := int(d.h.BytesPerFrame)
+		if len(d.buf) < 64*bytesPerFrame {
+			buf := make([]byte, 64*bytesPerFrame)
+			copy(buf, d.buf[:d.left])
+			d.buf = buf
+		}
+		for d.pos < pos {
+			numBytes := int(min(pos-d.pos, int64(len(d.buf)/bytesPerFrame*bytesPerFrame)))
+			read, err := io.ReadFull(d.r, d.buf[d.left:numBytes])
+			frames := (d.left + read) / bytesPerFrame
+			d.left = copy(d.buf, d.buf[frames*bytesPerFrame:d.left+read])
+			d.pos += int64(frames * bytesPerFrame)
+			if err != nil {
+				return errors.Wrap(err, "wav: seek error")
+			}
+		}
+		return nil
+	}
+	_, err := d.seeker.Seek(pos+d.hsz, io.SeekStart) // hsz is the size of the header
 	if err != nil {
 		return errors.Wrap(err, "wav: seek error")
 	}
 	d.pos = pos
+	d.left = 0
 	return nil
 }
 
+func (d *decoder) Metadata() *Metadata {
+	return d.metadata
+}
+
 func (d *decoder) Close() error {
 	if closer, ok := d.r.(io.Closer); ok {
 		err := closer.Close()
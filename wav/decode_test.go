@@ -1,9 +1,14 @@
 package wav
 
 import (
+	"bufio"
 	"bytes"
+	"encoding/binary"
+	"io"
+	"math"
 	"os"
 	"testing"
+	"testing/iotest"
 
 	"github.com/gopxl/beep/v2"
 	"github.com/gopxl/beep/v2/internal/testtools"
@@ -215,3 +220,197 @@ func TestDecoder_ReturnBehaviour(t *testing.T) {
 
 	testtools.AssertStreamerHasCorrectReturnBehaviour(t, s, s.Len())
 }
+
+func TestDecoder_DoesNotAllocate(t *testing.T) {
+	data, err := os.ReadFile(testtools.TestFilePath("valid_44100hz_22050_samples.wav"))
+	assert.NoError(t, err)
+
+	s, _, err := Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+
+	testtools.AssertStreamerDoesNotAllocate(t, s)
+}
+
+func TestDecode_RF64(t *testing.T) {
+	for _, mark := range []string{"RF64", "BW64"} {
+		t.Run(mark, func(t *testing.T) {
+			var b bytes.Buffer
+			write := func(data any) {
+				assert.NoError(t, binary.Write(&b, binary.LittleEndian, data))
+			}
+			write([]byte(mark))
+			write(uint32(math.MaxUint32))
+			write([]byte("WAVE"))
+			write([]byte("ds64"))
+			write(uint32(28 + 12))
+			write(ds64chunk{RiffSize: 4 + 48 + 24 + 8 + 8, DataSize: 8, SampleCount: 2, TableLength: 1})
+			write([]byte("JUNK"))
+			write(uint64(0))
+			write([]byte("fmt "))
+			write(uint32(16))
+			write(int16(formatTypePCM))
+			write(formatchunk{NumChans: 2, SampleRate: 44100, ByteRate: 44100 * 4, BytesPerFrame: 4, BitsPerSample: 16})
+			write([]byte("data"))
+			write(uint32(math.MaxUint32))
+			write([]int16{1 << 14, -1 << 14, 0, 1 << 13})
+
+			s, format, err := Decode(bytes.NewReader(b.Bytes()))
+			assert.NoError(t, err)
+			assert.Equal(t, beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}, format)
+			assert.Equal(t, 2, s.Len())
+			testtools.AssertSamplesEqual(t, [][2]float64{{0.5, -0.5}, {0, 0.25}}, testtools.Collect(s))
+		})
+	}
+}
+
+func TestDecode_ValidBits(t *testing.T) {
+	var b bytes.Buffer
+	write := func(data any) {
+		assert.NoError(t, binary.Write(&b, binary.LittleEndian, data))
+	}
+	write([]byte("RIFF"))
+	write(uint32(4 + 48 + 8 + 6))
+	write([]byte("WAVE"))
+	write([]byte("fmt "))
+	write(uint32(40))
+	write(int16(formatTypeExtensible))
+	write(formatchunkextensible{
+		formatchunk:   formatchunk{NumChans: 1, SampleRate: 48000, ByteRate: 48000 * 3, BytesPerFrame: 3, BitsPerSample: 24},
+		SubFormatSize: 22,
+		Samples:       20, // valid bits per sample
+		ChannelMask:   0x4,
+		SubFormat:     subFormatPCM,
+	})
+	write([]byte("data"))
+	write(uint32(6))
+	// The lowest 4 bits aren't valid and must be ignored.
+	write([]byte{0x0f, 0x00, 0x40, 0xff, 0xff, 0xff})
+
+	s, format, err := Decode(bytes.NewReader(b.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, beep.Format{SampleRate: 48000, NumChannels: 1, Precision: 3}, format)
+	testtools.AssertSamplesEqual(t, [][2]float64{{0.5, 0.5}, {-1.0 / (1 << 19), -1.0 / (1 << 19)}}, testtools.Collect(s))
+}
+
+func TestDecode_Int32(t *testing.T) {
+	var b bytes.Buffer
+	write := func(data any) {
+		assert.NoError(t, binary.Write(&b, binary.LittleEndian, data))
+	}
+	write([]byte("RIFF"))
+	write(uint32(4 + 24 + 8 + 8))
+	write([]byte("WAVE"))
+	write([]byte("fmt "))
+	write(uint32(16))
+	write(int16(formatTypePCM))
+	write(formatchunk{NumChans: 2, SampleRate: 48000, ByteRate: 48000 * 8, BytesPerFrame: 8, BitsPerSample: 32})
+	write([]byte("data"))
+	write(uint32(8))
+	write([]int32{-1 << 31, 1 << 29})
+
+	s, format, err := Decode(bytes.NewReader(b.Bytes()))
+	assert.NoError(t, err)
+	assert.Equal(t, beep.Format{SampleRate: 48000, NumChannels: 2, Precision: 4}, format)
+	testtools.AssertSamplesEqual(t, [][2]float64{{-1, 0.25}}, testtools.Collect(s))
+}
+
+func TestDecode_PartialReads(t *testing.T) {
+	data, err := os.ReadFile(testtools.TestFilePath("valid_44100hz_22050_samples.wav"))
+	assert.NoError(t, err)
+
+	s, _, err := Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	expected := testtools.Collect(s)
+
+	readers := map[string]func(io.Reader) io.Reader{
+		"one_byte": iotest.OneByteReader,
+		"half":     iotest.HalfReader,
+		"odd":      func(r io.Reader) io.Reader { return bufio.NewReaderSize(iotest.OneByteReader(r), 16) },
+	}
+	for name, reader := range readers {
+		t.Run(name, func(t *testing.T) {
+			s, _, err := Decode(reader(bytes.NewReader(data)))
+			assert.NoError(t, err)
+			// Stream in chunks which don't match the reads.
+			var actual [][2]float64
+			buf := make([][2]float64, 7)
+			for {
+				n, ok := s.Stream(buf)
+				if !ok {
+					break
+				}
+				actual = append(actual, buf[:n]...)
+			}
+			assert.NoError(t, s.Err())
+			testtools.AssertSamplesEqual(t, expected, actual)
+		})
+	}
+}
+
+func TestDecode_NonSeekable(t *testing.T) {
+	data, err := os.ReadFile(testtools.TestFilePath("valid_44100hz_22050_samples.wav"))
+	assert.NoError(t, err)
+
+	s, _, err := Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	expected := testtools.Collect(s)
+
+	s, _, err = Decode(iotest.HalfReader(bytes.NewReader(data)))
+	assert.NoError(t, err)
+	testtools.CollectNum(101, s)
+	assert.NoError(t, s.Seek(1000), "seeking forward discards the audio in between")
+	assert.Equal(t, 1000, s.Position())
+	testtools.AssertSamplesEqual(t, expected[1000:1100], testtools.CollectNum(100, s))
+	assert.Error(t, s.Seek(500), "seeking backward isn't possible")
+	assert.Equal(t, 1100, s.Position())
+}
+
+func TestDecode_ChunkedReader(t *testing.T) {
+	data, err := os.ReadFile(testtools.TestFilePath("valid_44100hz_22050_samples.wav"))
+	assert.NoError(t, err)
+
+	// Short reads must not end the audio early, which a Mixer would take as drained.
+	s, _, err := Decode(testtools.NewChunkedReader(bytes.NewReader(data), 100))
+	assert.NoError(t, err)
+	var m beep.Mixer
+	m.KeepAlive(false)
+	m.Add(s)
+	assert.Len(t, testtools.Collect(&m), 22050)
+	assert.NoError(t, s.Err())
+}
+
+func TestDecode_NonSeekableReadError(t *testing.T) {
+	data, err := os.ReadFile(testtools.TestFilePath("valid_44100hz_22050_samples.wav"))
+	assert.NoError(t, err)
+
+	s, format, err := Decode(bytes.NewReader(data))
+	assert.NoError(t, err)
+	expected := testtools.Collect(s)
+	headerSize := len(data) - s.Len()*format.Width()
+
+	// The reader fails in the middle of the frame at 1000.
+	r := testtools.NewFailOnceReader(bytes.NewReader(data), int64(headerSize+1000*format.Width()+1), io.ErrClosedPipe)
+	s, _, err = Decode(iotest.HalfReader(r))
+	assert.NoError(t, err)
+	testtools.CollectNum(100, s)
+	assert.ErrorIs(t, s.Seek(2000), io.ErrClosedPipe)
+	assert.Equal(t, 1000, s.Position(), "the position is where the reading stopped")
+	assert.NoError(t, s.Err())
+	assert.NoError(t, s.Seek(1500))
+	testtools.AssertSamplesEqual(t, expected[1500:1600], testtools.CollectNum(100, s))
+	assert.NoError(t, s.Err())
+}
+
+func TestDecode_UnknownLength(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	var buf bytes.Buffer
+	e, err := NewEncoder(struct{ io.Writer }{&buf}, format)
+	assert.NoError(t, err)
+	assert.NoError(t, e.Write(make([][2]float64, 1000)))
+	assert.NoError(t, e.Close())
+
+	s, _, err := Decode(iotest.HalfReader(&buf))
+	assert.NoError(t, err)
+	assert.Len(t, testtools.Collect(s), 1000, "the audio ends with the stream")
+	assert.NoError(t, s.Err())
+}
@@ -2,97 +2,499 @@ package wav
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
-	"fmt"
 	"io"
+	"math"
 
 	"github.com/pkg/errors"
 
 	"github.com/gopxl/beep/v2"
 )
 
+const (
+	formatTypePCM        = 1
+	formatTypeMSADPCM    = 2
+	formatTypeFloat      = 3
+	formatTypeALaw       = 6
+	formatTypeMuLaw      = 7
+	formatTypeIMAADPCM   = 0x11
+	formatTypeExtensible = -2 // 0xFFFE
+)
+
+// EncodeOption configures how Encode writes the audio.
+type EncodeOption func(opts *encodeOptions)
+
+type encodeOptions struct {
+	dither      beep.Dither
+	shaping     beep.NoiseShaping
+	float       bool
+	extensible  bool
+	channelMask int32
+	length      int64
+	progress    func(frames int64)
+	largeFile   bool
+	metadata    *Metadata
+}
+
+// Dither sets the dither and noise shaping used when the samples are quantized to integers.
+// By default, samples are quantized without dither.
+func Dither(dither beep.Dither, shaping beep.NoiseShaping) EncodeOption {
+	return func(opts *encodeOptions) {
+		opts.dither = dither
+		opts.shaping = shaping
+	}
+}
+
+// Float makes Encode write IEEE floating point samples instead of integers. The precision of the
+// format must be 4 or 8 bytes. Floating point samples aren't clipped.
+func Float() EncodeOption {
+	return func(opts *encodeOptions) {
+		opts.float = true
+	}
+}
+
+// Extensible makes Encode write a WAVE_FORMAT_EXTENSIBLE format chunk. Such a chunk is always
+// written for more than 2 channels or more than 16 bits per integer sample, because many tools
+// expect it for those formats.
+func Extensible() EncodeOption {
+	return func(opts *encodeOptions) {
+		opts.extensible = true
+	}
+}
+
+// ChannelMask sets the speaker positions of the channels written to a WAVE_FORMAT_EXTENSIBLE
+// format chunk, see the dwChannelMask field of WAVEFORMATEXTENSIBLE. By default, the common
+// layouts for up to 8 channels are used (mono, stereo, 2.1, quad, 5.0, 5.1, 6.1 and 7.1) and no
+// positions are assigned to more channels.
+func ChannelMask(mask uint32) EncodeOption {
+	return func(opts *encodeOptions) {
+		opts.channelMask = int32(mask)
+	}
+}
+
+// defaultChannelMasks are the channel masks of the common layouts, indexed by the number of
+// channels.
+var defaultChannelMasks = [...]int32{
+	1: 0x4,   // front center
+	2: 0x3,   // front left, front right
+	3: 0xb,   // 2.1
+	4: 0x33,  // quad
+	5: 0x37,  // 5.0
+	6: 0x3f,  // 5.1
+	7: 0x13f, // 6.1
+	8: 0x63f, // 7.1
+}
+
+// Length sets the number of frames that will be encoded. An Encoder writing to a writer which
+// can't seek uses it to write the correct sizes to the header right away.
+func Length(frames int64) EncodeOption {
+	return func(opts *encodeOptions) {
+		opts.length = frames
+	}
+}
+
+// Progress sets a function which is called with the total number of encoded frames after every
+// write and once more when the header is finalized.
+func Progress(f func(frames int64)) EncodeOption {
+	return func(opts *encodeOptions) {
+		opts.progress = f
+	}
+}
+
+// LargeFile makes an Encoder writing to a writer which can seek reserve space for the header of
+// RF64, so the audio may grow larger than 4 GiB. The space is taken by a JUNK chunk, which most
+// tools skip, and the file is promoted to RF64 by Close once it grows that large.
+func LargeFile() EncodeOption {
+	return func(opts *encodeOptions) {
+		opts.largeFile = true
+	}
+}
+
 // Encode writes all audio streamed from s to w in WAVE format.
 //
-// Format precision must be 1 or 2 bytes.
-func Encode(w io.WriteSeeker, s beep.Streamer, format beep.Format) (err error) {
-	defer func() {
-		if err != nil {
-			err = errors.Wrap(err, "wav")
-		}
-	}()
-
-	if format.NumChannels <= 0 {
-		return errors.New("wav: invalid number of channels (less than 1)")
-	}
-	if format.Precision != 1 && format.Precision != 2 && format.Precision != 3 {
-		return errors.New("wav: unsupported precision, 1, 2 or 3 is supported")
-	}
-
-	h := header{
-		RiffMark:      [4]byte{'R', 'I', 'F', 'F'},
-		FileSize:      -1, // finalization
-		WaveMark:      [4]byte{'W', 'A', 'V', 'E'},
-		FmtMark:       [4]byte{'f', 'm', 't', ' '},
-		FormatSize:    16,
-		FormatType:    1,
-		NumChans:      int16(format.NumChannels),
-		SampleRate:    int32(format.SampleRate),
-		ByteRate:      int32(int(format.SampleRate) * format.NumChannels * format.Precision),
-		BytesPerFrame: int16(format.NumChannels * format.Precision),
-		BitsPerSample: int16(format.Precision) * 8,
-		DataMark:      [4]byte{'d', 'a', 't', 'a'},
-		DataSize:      -1, // finalization
-	}
-	if err := binary.Write(w, binary.LittleEndian, &h); err != nil {
+// Format precision must be 1, 2, 3 or 4 bytes for integer samples and 4 or 8 bytes for floating
+// point samples, see Float.
+func Encode(w io.WriteSeeker, s beep.Streamer, format beep.Format, opts ...EncodeOption) error {
+	e, err := NewEncoder(w, format, opts...)
+	if err != nil {
 		return err
 	}
-
-	var (
-		bw      = bufio.NewWriter(w)
-		samples = make([][2]float64, 512)
-		buffer  = make([]byte, len(samples)*format.Width())
-		written int
-	)
+	samples := make([][2]float64, 512)
 	for {
 		n, ok := s.Stream(samples)
 		if !ok {
 			break
 		}
-		buf := buffer
-		switch {
-		case format.Precision == 1:
-			for _, sample := range samples[:n] {
-				buf = buf[format.EncodeUnsigned(buf, sample):]
-			}
-		case format.Precision == 2 || format.Precision == 3:
-			for _, sample := range samples[:n] {
-				buf = buf[format.EncodeSigned(buf, sample):]
-			}
-		default:
-			panic(fmt.Errorf("wav: encode: invalid precision: %d", format.Precision))
-		}
-		nn, err := bw.Write(buffer[:n*format.Width()])
-		if err != nil {
+		if err := e.Write(samples[:n]); err != nil {
 			return err
 		}
-		written += nn
 	}
-	if err := bw.Flush(); err != nil {
-		return err
+	return e.Close()
+}
+
+// Encoder writes audio to an io.Writer in WAVE format incrementally.
+//
+// If the writer is an io.WriteSeeker which can seek, the sizes in the header are finalized by
+// Close. Otherwise, like for pipes, the header is written with the sizes given by the Length
+// option, or with the maximum sizes if the length is unknown. Most tools read such streams until
+// their end.
+//
+// Files larger than 4 GiB are written in RF64 format. If the writer can seek and the length isn't
+// known in advance, such files need the LargeFile option.
+type Encoder struct {
+	w        io.Writer
+	bw       *bufio.Writer
+	l        *layout
+	seeker   io.Seeker // nil if w can't seek
+	start    int64     // offset of the header if seeker isn't nil
+	length   int64     // number of frames announced in the header, or -1
+	progress func(frames int64)
+	header   int // size of the header written by NewEncoder
+	buf      []byte
+	written  int64 // bytes of audio data
+	closed   bool
+}
+
+// NewEncoder creates an Encoder writing audio in the given format to w and writes the header.
+//
+// Format precision must be 1, 2, 3 or 4 bytes for integer samples and 4 or 8 bytes for floating
+// point samples, see Float.
+func NewEncoder(w io.Writer, format beep.Format, opts ...EncodeOption) (*Encoder, error) {
+	o := encodeOptions{length: -1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	l, err := newLayout(format, o)
+	if err != nil {
+		return nil, err
 	}
 
-	// finalize header
-	h.FileSize = int32(44 - 8 + written) // 44-8 is the size of the header without RIFF signature and the length of the RIFF chunk
-	h.DataSize = int32(written)
-	if _, err := w.Seek(0, io.SeekStart); err != nil {
-		return err
+	e := &Encoder{
+		w:        w,
+		bw:       bufio.NewWriter(w),
+		l:        l,
+		length:   o.length,
+		progress: o.progress,
+	}
+	if seeker, ok := w.(io.Seeker); ok {
+		// Files like stdout may be pipes which can't seek.
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			e.seeker = seeker
+			e.start = start
+			l.reserve = o.largeFile
+		}
+	}
+
+	dataSize := int64(-1)
+	if e.length >= 0 {
+		dataSize = e.length * int64(format.Width())
+	}
+	header := l.header(dataSize)
+	if _, err := w.Write(header); err != nil {
+		return nil, errors.Wrap(err, "wav")
+	}
+	e.header = len(header)
+	if e.seeker != nil && len(header) > len(l.header(0)) {
+		// The length needs RF64, so the space of the ds64 chunk is kept if fewer frames are written.
+		l.reserve = true
+	}
+	return e, nil
+}
+
+// Write encodes samples. The samples may be buffered until Close is called.
+func (e *Encoder) Write(samples [][2]float64) error {
+	if e.closed {
+		return errors.New("wav: write to closed encoder")
+	}
+	if e.length >= 0 && e.frames()+int64(len(samples)) > e.length {
+		return errors.New("wav: more frames written than announced by the length")
+	}
+	width := e.l.format.Width()
+	if len(e.buf) < len(samples)*width {
+		e.buf = make([]byte, len(samples)*width)
+	}
+	n, err := e.bw.Write(e.l.encode(e.buf, samples))
+	e.written += int64(n)
+	if err != nil {
+		return errors.Wrap(err, "wav")
+	}
+	if e.progress != nil {
+		e.progress(e.frames())
+	}
+	return nil
+}
+
+// frames returns the number of encoded frames.
+func (e *Encoder) frames() int64 {
+	return e.written / int64(e.l.format.Width())
+}
+
+// Close flushes the buffered audio and finalizes the header if possible. It doesn't close the
+// underlying writer.
+//
+// If the writer can't seek and a length was set, it's an error if fewer frames were written.
+func (e *Encoder) Close() error {
+	if e.closed {
+		return nil
 	}
-	if err := binary.Write(w, binary.LittleEndian, &h); err != nil {
+	e.closed = true
+
+	if e.written%2 != 0 {
+		// Chunks are padded to an even size.
+		if err := e.bw.WriteByte(0); err != nil {
+			return errors.Wrap(err, "wav")
+		}
+	}
+	if err := e.bw.Flush(); err != nil {
+		return errors.Wrap(err, "wav")
+	}
+
+	frames := e.frames()
+	switch {
+	case e.seeker != nil:
+		if err := e.finalize(); err != nil {
+			return errors.Wrap(err, "wav")
+		}
+	case e.length >= 0 && frames != e.length:
+		return errors.Errorf("wav: %d frames written, but the header announces %d", frames, e.length)
+	}
+	if e.progress != nil {
+		e.progress(frames)
+	}
+	return nil
+}
+
+// finalize rewrites the header with the sizes of the written audio.
+func (e *Encoder) finalize() error {
+	header := e.l.header(e.written)
+	if len(header) != e.header {
+		// The ds64 chunk of RF64 would overwrite the start of the audio.
+		return errors.New("audio larger than 4 GiB needs the LargeFile option")
+	}
+	if _, err := e.seeker.Seek(e.start, io.SeekStart); err != nil {
 		return err
 	}
-	if _, err := w.Seek(0, io.SeekEnd); err != nil {
+	if _, err := e.w.Write(header); err != nil {
 		return err
 	}
+	_, err := e.seeker.Seek(0, io.SeekEnd)
+	return err
+}
 
-	return nil
+// layout determines how audio in a format is encoded in a WAVE file.
+type layout struct {
+	format      beep.Format
+	formatType  int16
+	extensible  bool
+	channelMask int32
+	reserve     bool   // whether to reserve space for a ds64 chunk
+	metadata    []byte // metadata chunks written before the data chunk
+	q           *beep.Quantizer
+}
+
+func newLayout(format beep.Format, o encodeOptions) (*layout, error) {
+	if format.NumChannels <= 0 {
+		return nil, errors.New("wav: invalid number of channels (less than 1)")
+	}
+	if format.NumChannels > math.MaxInt16 {
+		return nil, errors.New("wav: invalid number of channels (too many)")
+	}
+	if o.float && format.Precision != 4 && format.Precision != 8 {
+		return nil, errors.New("wav: unsupported precision, 4 or 8 is supported for floating point samples")
+	}
+	if !o.float && (format.Precision < 1 || format.Precision > 4) {
+		return nil, errors.New("wav: unsupported precision, 1, 2, 3 or 4 is supported")
+	}
+	if err := beep.CheckDither(o.dither, o.shaping); err != nil {
+		return nil, errors.Wrap(err, "wav")
+	}
+
+	l := &layout{
+		format:      format,
+		formatType:  formatTypePCM,
+		extensible:  o.extensible || format.NumChannels > 2 || (!o.float && format.Precision > 2),
+		channelMask: o.channelMask,
+	}
+	if o.float {
+		l.formatType = formatTypeFloat
+	} else {
+		l.q = beep.NewQuantizer(format, o.dither, o.shaping)
+	}
+	if o.metadata != nil {
+		l.metadata = o.metadata.encode()
+	}
+	if l.channelMask == 0 && format.NumChannels < len(defaultChannelMasks) {
+		l.channelMask = defaultChannelMasks[format.NumChannels]
+	}
+	return l, nil
+}
+
+// header returns the header of a file with dataSize bytes of audio data. If dataSize is negative,
+// the size is unknown and the maximum sizes are written. If the file doesn't fit into 4 GiB, the
+// header is in RF64 format.
+func (l *layout) header(dataSize int64) []byte {
+	var (
+		f     = l.format
+		fmtCk = formatchunk{
+			NumChans:      int16(f.NumChannels),
+			SampleRate:    int32(f.SampleRate),
+			ByteRate:      int32(int(f.SampleRate) * f.Width()),
+			BytesPerFrame: int16(f.Width()),
+			BitsPerSample: int16(f.Precision * 8),
+		}
+		b bytes.Buffer
+	)
+	write := func(data any) {
+		// Writing to a bytes.Buffer can't fail.
+		_ = binary.Write(&b, binary.LittleEndian, data)
+	}
+
+	// The size of the header up to the data chunk size, without the RIFF signature and the
+	// length of the RIFF chunk.
+	headerSize := int64(4 + 8 + 16 + 8)
+	switch {
+	case l.extensible:
+		headerSize += 40 - 16
+	case l.formatType == formatTypeFloat:
+		headerSize += 18 - 16
+	}
+	if l.formatType != formatTypePCM {
+		headerSize += 8 + 4
+	}
+	headerSize += int64(len(l.metadata))
+	rf64 := dataSize >= 0 && headerSize+dataSize+dataSize%2 > math.MaxUint32
+	if l.reserve || rf64 {
+		headerSize += 8 + 28
+	}
+
+	// size32 returns the value of a 32-bit size field, which is the maximum if the size is
+	// unknown or doesn't fit.
+	size32 := func(size int64) uint32 {
+		if size < 0 || size > math.MaxUint32 {
+			return math.MaxUint32
+		}
+		return uint32(size)
+	}
+	riffSize, frames := int64(-1), int64(-1)
+	if dataSize >= 0 {
+		riffSize = headerSize + dataSize + dataSize%2
+		frames = dataSize / int64(f.Width())
+	}
+
+	if rf64 {
+		write([]byte("RF64"))
+	} else {
+		write([]byte("RIFF"))
+	}
+	write(size32(riffSize))
+	write([]byte("WAVE"))
+
+	switch {
+	case rf64:
+		write([]byte("ds64"))
+		write(int32(28))
+		write(ds64chunk{
+			RiffSize:    uint64(riffSize),
+			DataSize:    uint64(dataSize),
+			SampleCount: uint64(frames),
+		})
+	case l.reserve:
+		// Space for a ds64 chunk, in case the file is promoted to RF64.
+		write([]byte("JUNK"))
+		write(int32(28))
+		write(ds64chunk{})
+	}
+
+	write([]byte("fmt "))
+	switch {
+	case l.extensible:
+		subFormat := subFormatPCM
+		if l.formatType == formatTypeFloat {
+			subFormat = subFormatFloat
+		}
+		write(int32(40))
+		write(int16(formatTypeExtensible))
+		write(formatchunkextensible{
+			formatchunk:   fmtCk,
+			SubFormatSize: 22,
+			Samples:       fmtCk.BitsPerSample, // valid bits per sample
+			ChannelMask:   l.channelMask,
+			SubFormat:     subFormat,
+		})
+	case l.formatType == formatTypeFloat:
+		// Formats other than PCM have the cbSize field, even if it's 0.
+		write(int32(18))
+		write(l.formatType)
+		write(fmtCk)
+		write(int16(0))
+	default:
+		write(int32(16))
+		write(l.formatType)
+		write(fmtCk)
+	}
+
+	if l.formatType != formatTypePCM {
+		// Formats other than PCM require the number of frames in a fact chunk.
+		write([]byte("fact"))
+		write(int32(4))
+		write(size32(frames))
+	}
+
+	write(l.metadata)
+
+	write([]byte("data"))
+	switch {
+	case dataSize < 0:
+		// The largest data size which fits into the RIFF chunk.
+		write(uint32(math.MaxUint32 - headerSize))
+	case rf64:
+		// The size is in the ds64 chunk.
+		write(uint32(math.MaxUint32))
+	default:
+		write(uint32(dataSize))
+	}
+	return b.Bytes()
+}
+
+// encode encodes samples to p, which must be large enough, and returns the encoded part of p.
+func (l *layout) encode(p []byte, samples [][2]float64) []byte {
+	f := l.format
+	buf := p
+	switch {
+	case l.formatType == formatTypeFloat:
+		for _, sample := range samples {
+			buf = buf[encodeFloat(f, buf, sample):]
+		}
+	case f.Precision == 1:
+		for _, sample := range samples {
+			buf = buf[l.q.EncodeUnsigned(buf, sample):]
+		}
+	default:
+		for _, sample := range samples {
+			buf = buf[l.q.EncodeSigned(buf, sample):]
+		}
+	}
+	return p[:len(samples)*f.Width()]
+}
+
+// encodeFloat encodes a single sample as floating point numbers of the precision of f.
+func encodeFloat(f beep.Format, p []byte, sample [2]float64) (n int) {
+	put := func(i int, x float64) {
+		if f.Precision == 4 {
+			binary.LittleEndian.PutUint32(p[i*4:], math.Float32bits(float32(x)))
+		} else {
+			binary.LittleEndian.PutUint64(p[i*8:], math.Float64bits(x))
+		}
+	}
+	if f.NumChannels == 1 {
+		put(0, (sample[0]+sample[1])/2)
+		return f.Width()
+	}
+	put(0, sample[0])
+	put(1, sample[1])
+	for c := 2; c < f.NumChannels; c++ {
+		put(c, 0)
+	}
+	return f.Width()
 }
@@ -1,7 +1,10 @@
 package wav
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
+	"io"
 	"math"
 	"testing"
 
@@ -79,7 +82,7 @@ func TestEncode(t *testing.T) {
 
 func TestEncodeDecodeRoundTrip(t *testing.T) {
 	numChannelsS := []int{1, 2}
-	precisions := []int{1, 2, 3}
+	precisions := []int{1, 2, 3, 4}
 
 	for _, numChannels := range numChannelsS {
 		for _, precision := range precisions {
@@ -137,3 +140,331 @@ func TestEncodeDecodeRoundTrip(t *testing.T) {
 		}
 	}
 }
+
+func TestEncode_Dither(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	s, data := testtools.RandomDataStreamer(1000)
+
+	var w writerseeker.WriterSeeker
+	err := Encode(&w, s, format, Dither(beep.DitherTPDF, beep.NoiseShapingLipshitz))
+	assert.NoError(t, err)
+
+	d, decodedFormat, err := Decode(w.Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, format, decodedFormat)
+
+	actual := testtools.Collect(d)
+	assert.Len(t, actual, len(data))
+	for i := range data {
+		assert.InDelta(t, data[i][0], actual[i][0], 32.0/(1<<15))
+		assert.InDelta(t, data[i][1], actual[i][1], 32.0/(1<<15))
+	}
+}
+
+func TestEncode_Float(t *testing.T) {
+	for _, precision := range []int{4, 8} {
+		t.Run(fmt.Sprintf("%d_precision", precision), func(t *testing.T) {
+			format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: precision}
+			data := [][2]float64{{0.5, -0.25}, {1.5, -1}, {0.1, 0.2}}
+
+			var w writerseeker.WriterSeeker
+			err := Encode(&w, testtools.NewDataStreamer(data), format, Float())
+			assert.NoError(t, err)
+
+			encoded, err := io.ReadAll(w.Reader())
+			assert.NoError(t, err)
+			assert.Len(t, encoded, 58+len(data)*format.Width())
+			assert.Equal(t, []byte("fmt "), encoded[12:16])
+			assert.Equal(t, uint32(18), binary.LittleEndian.Uint32(encoded[16:]), "the format chunk must contain cbSize")
+			assert.Equal(t, uint16(3), binary.LittleEndian.Uint16(encoded[20:]), "the format type must be IEEE float")
+			assert.Equal(t, uint16(precision*8), binary.LittleEndian.Uint16(encoded[34:]))
+			assert.Equal(t, []byte("fact"), encoded[38:42])
+			assert.Equal(t, uint32(len(data)), binary.LittleEndian.Uint32(encoded[46:]))
+			assert.Equal(t, []byte("data"), encoded[50:54])
+
+			samples := encoded[58:]
+			for i := range data {
+				for c := range data[i] {
+					var got float64
+					if precision == 4 {
+						got = float64(math.Float32frombits(binary.LittleEndian.Uint32(samples[(2*i+c)*4:])))
+					} else {
+						got = math.Float64frombits(binary.LittleEndian.Uint64(samples[(2*i+c)*8:]))
+					}
+					assert.InDelta(t, data[i][c], got, 1e-7, "float samples must not be clipped")
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeDecodeRoundTrip_Float(t *testing.T) {
+	formats := []beep.Format{
+		{SampleRate: 44100, NumChannels: 2, Precision: 4},
+		{SampleRate: 44100, NumChannels: 2, Precision: 8},
+		{SampleRate: 44100, NumChannels: 4, Precision: 4}, // WAVE_FORMAT_EXTENSIBLE
+	}
+	for _, format := range formats {
+		t.Run(fmt.Sprintf("%d_channels_%d_precision", format.NumChannels, format.Precision), func(t *testing.T) {
+			s, data := testtools.RandomDataStreamer(1000)
+
+			var w writerseeker.WriterSeeker
+			err := Encode(&w, s, format, Float())
+			assert.NoError(t, err)
+
+			d, decodedFormat, err := Decode(w.Reader())
+			assert.NoError(t, err)
+			assert.Equal(t, format, decodedFormat)
+
+			actual := testtools.Collect(d)
+			assert.Len(t, actual, len(data))
+			for i := range data {
+				for c := range data[i] {
+					expected := data[i][c]
+					if format.Precision == 4 {
+						expected = float64(float32(expected))
+					}
+					assert.Equal(t, expected, actual[i][c])
+				}
+			}
+		})
+	}
+}
+
+func TestEncode_Int32(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 1, Precision: 4}
+
+	var w writerseeker.WriterSeeker
+	err := Encode(&w, testtools.NewDataStreamer([][2]float64{{0.5, 0.5}, {-1, -1}}), format)
+	assert.NoError(t, err)
+
+	encoded, err := io.ReadAll(w.Reader())
+	assert.NoError(t, err)
+	assert.Len(t, encoded, 68+2*4)
+	assert.Equal(t, uint16(32), binary.LittleEndian.Uint16(encoded[34:]))
+	assert.Equal(t, []byte{0x00, 0x00, 0x00, 0x40, 0x00, 0x00, 0x00, 0x80}, encoded[68:])
+}
+
+func TestEncode_Extensible(t *testing.T) {
+	tests := []struct {
+		name        string
+		format      beep.Format
+		opts        []EncodeOption
+		subFormat   byte
+		channelMask uint32
+	}{
+		{"24_bit", beep.Format{SampleRate: 48000, NumChannels: 2, Precision: 3}, nil, 1, 0x3},
+		{"5.1", beep.Format{SampleRate: 48000, NumChannels: 6, Precision: 2}, nil, 1, 0x3f},
+		{"float_multichannel", beep.Format{SampleRate: 48000, NumChannels: 4, Precision: 4}, []EncodeOption{Float()}, 3, 0x33},
+		{"forced", beep.Format{SampleRate: 48000, NumChannels: 1, Precision: 2}, []EncodeOption{Extensible()}, 1, 0x4},
+		{"channel_mask", beep.Format{SampleRate: 48000, NumChannels: 3, Precision: 2}, []EncodeOption{ChannelMask(0x7)}, 1, 0x7},
+		{"many_channels", beep.Format{SampleRate: 48000, NumChannels: 10, Precision: 2}, nil, 1, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var w writerseeker.WriterSeeker
+			err := Encode(&w, generators.Silence(3), test.format, test.opts...)
+			assert.NoError(t, err)
+
+			encoded, err := io.ReadAll(w.Reader())
+			assert.NoError(t, err)
+			assert.Equal(t, uint32(40), binary.LittleEndian.Uint32(encoded[16:]))
+			assert.Equal(t, uint16(0xfffe), binary.LittleEndian.Uint16(encoded[20:]))
+			assert.Equal(t, uint16(22), binary.LittleEndian.Uint16(encoded[36:]), "cbSize")
+			assert.Equal(t, uint16(test.format.Precision*8), binary.LittleEndian.Uint16(encoded[38:]), "valid bits per sample")
+			assert.Equal(t, test.channelMask, binary.LittleEndian.Uint32(encoded[40:]))
+			assert.Equal(t, test.subFormat, encoded[44], "sub format")
+			assert.Equal(t, uint32(len(encoded)-8), binary.LittleEndian.Uint32(encoded[4:]))
+		})
+	}
+}
+
+func TestEncode_PadsOddDataSize(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 1, Precision: 1}
+
+	var w writerseeker.WriterSeeker
+	err := Encode(&w, generators.Silence(3), format)
+	assert.NoError(t, err)
+
+	encoded, err := io.ReadAll(w.Reader())
+	assert.NoError(t, err)
+	assert.Len(t, encoded, 44+3+1)
+	assert.Equal(t, uint32(44-8+3+1), binary.LittleEndian.Uint32(encoded[4:]))
+	assert.Equal(t, uint32(3), binary.LittleEndian.Uint32(encoded[40:]), "the data size must not include the padding")
+}
+
+func TestEncode_InvalidPrecision(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 5}
+	assert.Error(t, Encode(&writerseeker.WriterSeeker{}, generators.Silence(1), format))
+
+	format.Precision = 2
+	assert.Error(t, Encode(&writerseeker.WriterSeeker{}, generators.Silence(1), format, Float()))
+}
+
+func TestEncode_InvalidDither(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	assert.Error(t, Encode(&writerseeker.WriterSeeker{}, generators.Silence(1), format, Dither(beep.Dither(-1), beep.NoiseShapingNone)))
+	assert.Error(t, Encode(&writerseeker.WriterSeeker{}, generators.Silence(1), format, Dither(beep.DitherTPDF, beep.NoiseShaping(99))))
+
+	_, err := NewEncoder(&bytes.Buffer{}, format, Dither(beep.Dither(99), beep.NoiseShapingNone))
+	assert.Error(t, err)
+}
+
+// writerOnly hides all methods of the writer except Write.
+type writerOnly struct {
+	io.Writer
+}
+
+func TestEncoder_NonSeekableUnknownLength(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	var buf bytes.Buffer
+	e, err := NewEncoder(writerOnly{&buf}, format)
+	assert.NoError(t, err)
+	assert.NoError(t, e.Write(make([][2]float64, 10)))
+	assert.NoError(t, e.Close())
+
+	encoded := buf.Bytes()
+	assert.Len(t, encoded, 44+10*4)
+	assert.Equal(t, uint32(math.MaxUint32), binary.LittleEndian.Uint32(encoded[4:]))
+	assert.Equal(t, uint32(math.MaxUint32-36), binary.LittleEndian.Uint32(encoded[40:]))
+}
+
+func TestEncoder_NonSeekableKnownLength(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	s, data := testtools.RandomDataStreamer(1000)
+	samples := testtools.Collect(s)
+
+	var buf bytes.Buffer
+	e, err := NewEncoder(writerOnly{&buf}, format, Length(int64(len(data))))
+	assert.NoError(t, err)
+	assert.NoError(t, e.Write(samples[:600]))
+	assert.NoError(t, e.Write(samples[600:]))
+	assert.Error(t, e.Write(samples[:1]), "writing more frames than announced must fail")
+	assert.NoError(t, e.Close())
+
+	d, decodedFormat, err := Decode(&buf)
+	assert.NoError(t, err)
+	assert.Equal(t, format, decodedFormat)
+	assert.Equal(t, len(data), d.Len())
+	actual := testtools.Collect(d)
+	for i := range data {
+		assert.InDelta(t, data[i][0], actual[i][0], 2.0/(1<<16))
+	}
+}
+
+func TestEncoder_NonSeekableShortLength(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	e, err := NewEncoder(writerOnly{io.Discard}, format, Length(10))
+	assert.NoError(t, err)
+	assert.NoError(t, e.Write(make([][2]float64, 5)))
+	assert.Error(t, e.Close())
+}
+
+func TestEncoder_SeekableFinalizesHeader(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 1, Precision: 2}
+	var w writerseeker.WriterSeeker
+	_, err := w.Write([]byte("junk"))
+	assert.NoError(t, err)
+
+	var progress []int64
+	e, err := NewEncoder(&w, format, Progress(func(frames int64) {
+		progress = append(progress, frames)
+	}))
+	assert.NoError(t, err)
+	assert.NoError(t, e.Write(make([][2]float64, 3)))
+	assert.NoError(t, e.Write(make([][2]float64, 4)))
+	assert.NoError(t, e.Close())
+	assert.NoError(t, e.Close(), "closing twice is fine")
+	assert.Error(t, e.Write(make([][2]float64, 1)))
+	assert.Equal(t, []int64{3, 7, 7}, progress)
+
+	encoded, err := io.ReadAll(w.Reader())
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("junk"), encoded[:4], "the header must be written at the start of the encoded audio")
+	encoded = encoded[4:]
+	assert.Len(t, encoded, 44+7*2)
+	assert.Equal(t, uint32(36+7*2), binary.LittleEndian.Uint32(encoded[4:]))
+	assert.Equal(t, uint32(7*2), binary.LittleEndian.Uint32(encoded[40:]))
+}
+
+// findChunk returns the body of the first chunk with the given ID in a RIFF file. The body is cut
+// off at the end of the file.
+func findChunk(t *testing.T, file []byte, id string) []byte {
+	t.Helper()
+	for p := file[12:]; len(p) >= 8; {
+		size := int(binary.LittleEndian.Uint32(p[4:]))
+		if string(p[:4]) == id {
+			return p[8:min(8+size, len(p))]
+		}
+		if 8+size+size%2 > len(p) {
+			break
+		}
+		p = p[8+size+size%2:]
+	}
+	t.Fatalf("chunk %q not found", id)
+	return nil
+}
+
+func TestEncoder_RF64WithKnownLength(t *testing.T) {
+	format := beep.Format{SampleRate: 48000, NumChannels: 2, Precision: 2}
+	var buf bytes.Buffer
+	_, err := NewEncoder(writerOnly{&buf}, format, Length(1<<31))
+	assert.NoError(t, err)
+
+	encoded := buf.Bytes()
+	assert.Equal(t, []byte("RF64"), encoded[:4])
+	assert.Equal(t, uint32(math.MaxUint32), binary.LittleEndian.Uint32(encoded[4:]))
+	ds64 := findChunk(t, encoded, "ds64")
+	assert.Len(t, ds64, 28)
+	assert.Equal(t, uint64(72+4<<31), binary.LittleEndian.Uint64(ds64[0:]), "RIFF size")
+	assert.Equal(t, uint64(4<<31), binary.LittleEndian.Uint64(ds64[8:]), "data size")
+	assert.Equal(t, uint64(1<<31), binary.LittleEndian.Uint64(ds64[16:]), "sample count")
+	assert.Equal(t, uint32(math.MaxUint32), binary.LittleEndian.Uint32(encoded[len(encoded)-4:]), "data size")
+}
+
+func TestEncoder_PromotesToRF64(t *testing.T) {
+	format := beep.Format{SampleRate: 48000, NumChannels: 2, Precision: 2}
+	var w writerseeker.WriterSeeker
+	e, err := NewEncoder(&w, format, LargeFile())
+	assert.NoError(t, err)
+	assert.NoError(t, e.Write(make([][2]float64, 3)))
+	// Pretend that more than 4 GiB were written.
+	e.written += 1 << 32
+	assert.NoError(t, e.Close())
+
+	encoded, err := io.ReadAll(w.Reader())
+	assert.NoError(t, err)
+	assert.Len(t, encoded, 80+3*4, "the ds64 chunk must replace the reserved JUNK chunk")
+	assert.Equal(t, []byte("RF64"), encoded[:4])
+	ds64 := findChunk(t, encoded, "ds64")
+	assert.Equal(t, uint64(72+3*4+1<<32), binary.LittleEndian.Uint64(ds64[0:]), "RIFF size")
+	assert.Equal(t, uint64(3*4+1<<32), binary.LittleEndian.Uint64(ds64[8:]), "data size")
+	assert.Equal(t, uint64(3+1<<30), binary.LittleEndian.Uint64(ds64[16:]), "sample count")
+}
+
+func TestEncoder_LargeFileWithoutReservation(t *testing.T) {
+	format := beep.Format{SampleRate: 48000, NumChannels: 2, Precision: 2}
+	var w writerseeker.WriterSeeker
+	e, err := NewEncoder(&w, format)
+	assert.NoError(t, err)
+	assert.NoError(t, e.Write(make([][2]float64, 3)))
+	// Pretend that more than 4 GiB were written.
+	e.written += 1 << 32
+	assert.Error(t, e.Close())
+}
+
+func TestEncoder_SeekableRF64WithKnownLength(t *testing.T) {
+	format := beep.Format{SampleRate: 48000, NumChannels: 2, Precision: 2}
+	var w writerseeker.WriterSeeker
+	e, err := NewEncoder(&w, format, Length(1<<31))
+	assert.NoError(t, err)
+	assert.NoError(t, e.Write(make([][2]float64, 3)))
+	assert.NoError(t, e.Close(), "the space of the ds64 chunk is kept for fewer frames")
+
+	encoded, err := io.ReadAll(w.Reader())
+	assert.NoError(t, err)
+	assert.Len(t, encoded, 80+3*4)
+	assert.Equal(t, []byte("RIFF"), encoded[:4])
+	assert.Len(t, findChunk(t, encoded, "JUNK"), 28)
+	assert.Len(t, findChunk(t, encoded, "data"), 3*4)
+}
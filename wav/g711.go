@@ -0,0 +1,44 @@
+package wav
+
+// alawToLinear and mulawToLinear map G.711 A-law and µ-law encoded bytes to 16-bit linear samples.
+var (
+	alawToLinear  [256]int16
+	mulawToLinear [256]int16
+)
+
+func init() {
+	for i := 0; i < 256; i++ {
+		alawToLinear[i] = alawDecode(byte(i))
+		mulawToLinear[i] = mulawDecode(byte(i))
+	}
+}
+
+// alawDecode decodes a single A-law encoded sample as described in ITU-T G.711.
+func alawDecode(a byte) int16 {
+	a ^= 0x55
+	t := int16(a&0x0f) << 4
+	switch seg := (a & 0x70) >> 4; seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if a&0x80 != 0 {
+		return t
+	}
+	return -t
+}
+
+// mulawDecode decodes a single µ-law encoded sample as described in ITU-T G.711.
+func mulawDecode(u byte) int16 {
+	const bias = 0x84
+	u = ^u
+	t := (int16(u&0x0f)<<3 + bias) << ((u & 0x70) >> 4)
+	if u&0x80 != 0 {
+		return bias - t
+	}
+	return t - bias
+}
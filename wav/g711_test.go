@@ -0,0 +1,43 @@
+package wav
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+func TestDecode_G711(t *testing.T) {
+	tests := []struct {
+		name       string
+		formatType int16
+		data       []byte
+		expected   []int16
+	}{
+		{"A-law", formatTypeALaw, []byte{0xd5, 0x55, 0xaa, 0x2a, 0x80}, []int16{8, -8, 32256, -32256, 5504}},
+		{"µ-law", formatTypeMuLaw, []byte{0xff, 0x7f, 0x80, 0x00, 0xe0}, []int16{0, 0, 32124, -32124, 372}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			format := formatchunk{NumChans: 1, SampleRate: 8000, ByteRate: 8000, BytesPerFrame: 1, BitsPerSample: 8}
+			file := compressedFile(t, test.formatType, format, nil, len(test.data), test.data)
+
+			s, f, err := Decode(bytes.NewReader(file))
+			assert.NoError(t, err)
+			assert.Equal(t, beep.Format{SampleRate: 8000, NumChannels: 1, Precision: 2}, f)
+			assert.Equal(t, len(test.data), s.Len())
+
+			var expected [][2]float64
+			for _, x := range test.expected {
+				expected = append(expected, [2]float64{float64(x) / (1 << 15), float64(x) / (1 << 15)})
+			}
+			testtools.AssertSamplesEqual(t, expected, testtools.Collect(s))
+
+			assert.NoError(t, s.Seek(2))
+			testtools.AssertSamplesEqual(t, expected[2:3], testtools.CollectNum(1, s))
+		})
+	}
+}
@@ -0,0 +1,491 @@
+package wav
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/gopxl/beep/v2"
+)
+
+// Metadata holds the metadata chunks of a WAVE file.
+type Metadata struct {
+	// Info holds the tags of the LIST/INFO chunk by their IDs, for example "INAM" for the title,
+	// "IART" for the artist and "ICMT" for a comment.
+	Info map[string]string
+
+	// Broadcast is the broadcast extension (bext chunk) of Broadcast Wave Format files.
+	Broadcast *BroadcastExtension
+
+	// Cues are the cue points (cue chunk) with their labels and notes (LIST/adtl chunk).
+	Cues []Cue
+
+	// Sampler holds the sampler information and loop points (smpl chunk).
+	Sampler *Sampler
+}
+
+// BroadcastExtension is the bext chunk of Broadcast Wave Format files, see EBU Tech 3285.
+type BroadcastExtension struct {
+	Description         string
+	Originator          string
+	OriginatorReference string
+	OriginationDate     string // yyyy-mm-dd
+	OriginationTime     string // hh-mm-ss
+
+	// TimeReference is the timecode origin of the audio as the number of samples since midnight.
+	TimeReference uint64
+
+	Version uint16
+	UMID    [64]byte
+
+	// Loudness values of version 2, in hundredths of LUFS, LU or dBTP.
+	LoudnessValue        int16
+	LoudnessRange        int16
+	MaxTruePeakLevel     int16
+	MaxMomentaryLoudness int16
+	MaxShortTermLoudness int16
+
+	CodingHistory string
+}
+
+// TimeOffset returns the TimeReference as the time since midnight.
+func (b *BroadcastExtension) TimeOffset(sr beep.SampleRate) time.Duration {
+	return sr.D(int(b.TimeReference))
+}
+
+// Cue is a cue point.
+type Cue struct {
+	ID       uint32
+	Position int // in samples
+	Label    string
+	Note     string
+}
+
+// Sampler is the smpl chunk, which describes how a sampler plays the audio.
+type Sampler struct {
+	Manufacturer      uint32
+	Product           uint32
+	SamplePeriod      uint32 // in nanoseconds
+	MIDIUnityNote     uint32
+	MIDIPitchFraction uint32
+	SMPTEFormat       uint32
+	SMPTEOffset       uint32
+	Loops             []SampleLoop
+}
+
+// SampleLoopType is the direction in which a SampleLoop is played.
+type SampleLoopType uint32
+
+const (
+	SampleLoopForward SampleLoopType = iota
+	SampleLoopAlternating
+	SampleLoopBackward
+)
+
+// SampleLoop is a loop of a Sampler.
+type SampleLoop struct {
+	CuePointID uint32
+	Type       SampleLoopType
+	Start      int // in samples
+	End        int // in samples, inclusive
+	Fraction   uint32
+	PlayCount  int // the number of times the loop is played, 0 for infinitely
+}
+
+// LoopOptions returns the options to play the loop with beep.Loop2. The loop is always played
+// forward, since Loop2 doesn't support other directions.
+func (l SampleLoop) LoopOptions() []beep.LoopOption {
+	opts := []beep.LoopOption{beep.LoopBetween(l.Start, l.End+1)}
+	if l.PlayCount > 0 {
+		// Loop2 counts the repetitions after the first time.
+		opts = append(opts, beep.LoopTimes(l.PlayCount-1))
+	}
+	return opts
+}
+
+// MetadataStreamer is implemented by the StreamSeekCloser returned by Decode. Use a type
+// assertion to get the metadata chunks of the file:
+//
+//	if ms, ok := s.(wav.MetadataStreamer); ok {
+//		title := ms.Metadata().Info["INAM"]
+//	}
+type MetadataStreamer interface {
+	beep.StreamSeekCloser
+	// Metadata returns the metadata chunks which precede the audio data. The fields are empty
+	// if there are none.
+	Metadata() *Metadata
+}
+
+// WithMetadata makes Encode write the given metadata chunks. They are written before the audio
+// data.
+func WithMetadata(m *Metadata) EncodeOption {
+	return func(opts *encodeOptions) {
+		opts.metadata = m
+	}
+}
+
+// ReadMetadata reads the metadata chunks of a WAVE file from r. The audio data is skipped by
+// seeking if r is an io.Seeker, otherwise it's read and discarded.
+func ReadMetadata(r io.Reader) (*Metadata, error) {
+	var riff struct {
+		Mark     [4]byte
+		Size     uint32
+		WaveMark [4]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &riff); err != nil {
+		return nil, errors.Wrap(err, "wav: missing RIFF header")
+	}
+	switch string(riff.Mark[:]) {
+	case "RIFF", "RF64", "BW64":
+	default:
+		return nil, fmt.Errorf("wav: missing RIFF at the beginning > %s", string(riff.Mark[:]))
+	}
+	if string(riff.WaveMark[:]) != "WAVE" {
+		return nil, errors.New("wav: unsupported file type")
+	}
+
+	var (
+		m        Metadata
+		dataSize int64 = -1 // from the ds64 chunk
+		chunk    struct {
+			ID   [4]byte
+			Size uint32
+		}
+	)
+	for {
+		if err := binary.Read(r, binary.LittleEndian, &chunk); err != nil {
+			if err == io.EOF {
+				return &m, nil
+			}
+			return nil, errors.Wrap(err, "wav: missing chunk header")
+		}
+		id, size := string(chunk.ID[:]), int64(chunk.Size)
+		switch id {
+		case "ds64", "LIST", "bext", "cue ", "smpl":
+		case "data":
+			if size == 0xFFFFFFFF && dataSize >= 0 {
+				size = dataSize
+			}
+			if err := skip(r, size+size%2); err != nil {
+				// Streams with unknown length end within the data chunk.
+				if err == io.EOF || err == io.ErrUnexpectedEOF {
+					return &m, nil
+				}
+				return nil, errors.Wrap(err, "wav")
+			}
+			continue
+		default:
+			if err := skip(r, size+size%2); err != nil {
+				return nil, errors.Wrapf(err, "wav: missing %s chunk body", id)
+			}
+			continue
+		}
+
+		body := make([]byte, size)
+		if _, err := io.ReadFull(r, body); err != nil {
+			return nil, errors.Wrapf(err, "wav: missing %s chunk body", id)
+		}
+		if size%2 != 0 {
+			// Some files lack the padding of their last chunk.
+			if _, err := io.ReadFull(r, make([]byte, 1)); err != nil && err != io.EOF {
+				return nil, errors.Wrap(err, "wav")
+			}
+		}
+		if id == "ds64" {
+			if len(body) >= 16 {
+				dataSize = int64(binary.LittleEndian.Uint64(body[8:]))
+			}
+			continue
+		}
+		m.parseChunk(id, body)
+	}
+}
+
+// isMetadataChunk reports whether the chunk with the given ID is parsed by parseChunk.
+func isMetadataChunk(id string) bool {
+	switch id {
+	case "LIST", "bext", "cue ", "smpl":
+		return true
+	}
+	return false
+}
+
+// parseChunk adds the metadata of a LIST, bext, cue or smpl chunk to m.
+func (m *Metadata) parseChunk(id string, body []byte) {
+	switch id {
+	case "LIST":
+		if len(body) >= 4 {
+			m.parseList(string(body[:4]), body[4:])
+		}
+	case "bext":
+		m.Broadcast = parseBroadcastExtension(body)
+	case "cue ":
+		m.parseCues(body)
+	case "smpl":
+		m.Sampler = parseSampler(body)
+	}
+}
+
+// skip skips n bytes of r.
+func skip(r io.Reader, n int64) error {
+	if seeker, ok := r.(io.Seeker); ok {
+		cur, err := seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return err
+		}
+		end, err := seeker.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		if cur+n > end {
+			return io.ErrUnexpectedEOF
+		}
+		_, err = seeker.Seek(cur+n, io.SeekStart)
+		return err
+	}
+	_, err := io.CopyN(io.Discard, r, n)
+	return err
+}
+
+// subchunks calls f with the ID and body of each chunk in p.
+func subchunks(p []byte, f func(id string, body []byte)) {
+	for len(p) >= 8 {
+		size := int(binary.LittleEndian.Uint32(p[4:]))
+		if 8+size > len(p) {
+			return
+		}
+		f(string(p[:4]), p[8:8+size])
+		p = p[min(8+size+size%2, len(p)):]
+	}
+}
+
+// zstring returns the text of a zero-terminated or zero-padded string.
+func zstring(p []byte) string {
+	if i := bytes.IndexByte(p, 0); i >= 0 {
+		p = p[:i]
+	}
+	return string(p)
+}
+
+func (m *Metadata) parseList(listType string, p []byte) {
+	switch listType {
+	case "INFO":
+		subchunks(p, func(id string, body []byte) {
+			if m.Info == nil {
+				m.Info = make(map[string]string)
+			}
+			m.Info[id] = zstring(body)
+		})
+	case "adtl":
+		subchunks(p, func(id string, body []byte) {
+			if (id != "labl" && id != "note") || len(body) < 4 {
+				return
+			}
+			cue := m.cue(binary.LittleEndian.Uint32(body))
+			if id == "labl" {
+				cue.Label = zstring(body[4:])
+			} else {
+				cue.Note = zstring(body[4:])
+			}
+		})
+	}
+}
+
+// cue returns the cue point with the given ID, which is added if there is none.
+func (m *Metadata) cue(id uint32) *Cue {
+	for i := range m.Cues {
+		if m.Cues[i].ID == id {
+			return &m.Cues[i]
+		}
+	}
+	m.Cues = append(m.Cues, Cue{ID: id})
+	return &m.Cues[len(m.Cues)-1]
+}
+
+func (m *Metadata) parseCues(p []byte) {
+	if len(p) < 4 {
+		return
+	}
+	n := int(binary.LittleEndian.Uint32(p))
+	p = p[4:]
+	for i := 0; i < n && len(p) >= 24; i++ {
+		cue := m.cue(binary.LittleEndian.Uint32(p))
+		cue.Position = int(binary.LittleEndian.Uint32(p[20:])) // sample offset
+		p = p[24:]
+	}
+}
+
+// bextFixedSize is the size of the bext chunk without the coding history.
+const bextFixedSize = 602
+
+func parseBroadcastExtension(p []byte) *BroadcastExtension {
+	if len(p) < bextFixedSize {
+		p = append(p, make([]byte, bextFixedSize-len(p))...)
+	}
+	b := &BroadcastExtension{
+		Description:          zstring(p[0:256]),
+		Originator:           zstring(p[256:288]),
+		OriginatorReference:  zstring(p[288:320]),
+		OriginationDate:      zstring(p[320:330]),
+		OriginationTime:      zstring(p[330:338]),
+		TimeReference:        binary.LittleEndian.Uint64(p[338:]),
+		Version:              binary.LittleEndian.Uint16(p[346:]),
+		LoudnessValue:        int16(binary.LittleEndian.Uint16(p[412:])),
+		LoudnessRange:        int16(binary.LittleEndian.Uint16(p[414:])),
+		MaxTruePeakLevel:     int16(binary.LittleEndian.Uint16(p[416:])),
+		MaxMomentaryLoudness: int16(binary.LittleEndian.Uint16(p[418:])),
+		MaxShortTermLoudness: int16(binary.LittleEndian.Uint16(p[420:])),
+		CodingHistory:        zstring(p[bextFixedSize:]),
+	}
+	copy(b.UMID[:], p[348:412])
+	return b
+}
+
+func parseSampler(p []byte) *Sampler {
+	if len(p) < 36 {
+		return nil
+	}
+	u := func(i int) uint32 {
+		return binary.LittleEndian.Uint32(p[4*i:])
+	}
+	s := &Sampler{
+		Manufacturer:      u(0),
+		Product:           u(1),
+		SamplePeriod:      u(2),
+		MIDIUnityNote:     u(3),
+		MIDIPitchFraction: u(4),
+		SMPTEFormat:       u(5),
+		SMPTEOffset:       u(6),
+	}
+	n := int(u(7))
+	p = p[36:]
+	for i := 0; i < n && len(p) >= 24; i++ {
+		s.Loops = append(s.Loops, SampleLoop{
+			CuePointID: u(0),
+			Type:       SampleLoopType(u(1)),
+			Start:      int(u(2)),
+			End:        int(u(3)),
+			Fraction:   u(4),
+			PlayCount:  int(u(5)),
+		})
+		p = p[24:]
+	}
+	return s
+}
+
+// encode returns the metadata as chunks.
+func (m *Metadata) encode() []byte {
+	var b bytes.Buffer
+	write := func(data any) {
+		// Writing to a bytes.Buffer can't fail.
+		_ = binary.Write(&b, binary.LittleEndian, data)
+	}
+	writeChunk := func(id string, body []byte) {
+		write([]byte(id))
+		write(uint32(len(body)))
+		write(body)
+		if len(body)%2 != 0 {
+			write(byte(0))
+		}
+	}
+	// zterm returns s as zero-terminated string.
+	zterm := func(s string) []byte {
+		return append([]byte(s), 0)
+	}
+	// fixed returns s in a zero-padded field of n bytes.
+	fixed := func(s string, n int) []byte {
+		p := make([]byte, n)
+		copy(p, s)
+		return p
+	}
+
+	if bext := m.Broadcast; bext != nil {
+		var p bytes.Buffer
+		for _, data := range []any{
+			fixed(bext.Description, 256),
+			fixed(bext.Originator, 32),
+			fixed(bext.OriginatorReference, 32),
+			fixed(bext.OriginationDate, 10),
+			fixed(bext.OriginationTime, 8),
+			bext.TimeReference,
+			bext.Version,
+			bext.UMID,
+			[]int16{bext.LoudnessValue, bext.LoudnessRange, bext.MaxTruePeakLevel, bext.MaxMomentaryLoudness, bext.MaxShortTermLoudness},
+			make([]byte, 180), // reserved
+			[]byte(bext.CodingHistory),
+		} {
+			_ = binary.Write(&p, binary.LittleEndian, data)
+		}
+		writeChunk("bext", p.Bytes())
+	}
+
+	if len(m.Info) > 0 {
+		ids := make([]string, 0, len(m.Info))
+		for id := range m.Info {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		list := []byte("INFO")
+		for _, id := range ids {
+			text := zterm(m.Info[id])
+			list = append(list, fixed(id, 4)...)
+			list = binary.LittleEndian.AppendUint32(list, uint32(len(text)))
+			list = append(list, text...)
+			if len(text)%2 != 0 {
+				list = append(list, 0)
+			}
+		}
+		writeChunk("LIST", list)
+	}
+
+	if len(m.Cues) > 0 {
+		cues := binary.LittleEndian.AppendUint32(nil, uint32(len(m.Cues)))
+		adtl := []byte("adtl")
+		for i, cue := range m.Cues {
+			for _, x := range []uint32{cue.ID, uint32(i), 0, 0, 0, uint32(cue.Position)} {
+				cues = binary.LittleEndian.AppendUint32(cues, x)
+			}
+			copy(cues[len(cues)-16:], "data")
+
+			for _, text := range []struct{ id, s string }{{"labl", cue.Label}, {"note", cue.Note}} {
+				if text.s == "" {
+					continue
+				}
+				body := append(binary.LittleEndian.AppendUint32(nil, cue.ID), zterm(text.s)...)
+				adtl = append(adtl, text.id...)
+				adtl = binary.LittleEndian.AppendUint32(adtl, uint32(len(body)))
+				adtl = append(adtl, body...)
+				if len(body)%2 != 0 {
+					adtl = append(adtl, 0)
+				}
+			}
+		}
+		writeChunk("cue ", cues)
+		if len(adtl) > 4 {
+			writeChunk("LIST", adtl)
+		}
+	}
+
+	if s := m.Sampler; s != nil {
+		var p []byte
+		for _, x := range []uint32{
+			s.Manufacturer, s.Product, s.SamplePeriod, s.MIDIUnityNote, s.MIDIPitchFraction,
+			s.SMPTEFormat, s.SMPTEOffset, uint32(len(s.Loops)), 0,
+		} {
+			p = binary.LittleEndian.AppendUint32(p, x)
+		}
+		for _, l := range s.Loops {
+			for _, x := range []uint32{l.CuePointID, uint32(l.Type), uint32(l.Start), uint32(l.End), l.Fraction, uint32(l.PlayCount)} {
+				p = binary.LittleEndian.AppendUint32(p, x)
+			}
+		}
+		writeChunk("smpl", p)
+	}
+
+	return b.Bytes()
+}
@@ -0,0 +1,117 @@
+package wav
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/orcaman/writerseeker"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gopxl/beep/v2"
+	"github.com/gopxl/beep/v2/internal/testtools"
+)
+
+func testMetadata() *Metadata {
+	bext := &BroadcastExtension{
+		Description:         "Field recording",
+		Originator:          "Recorder",
+		OriginatorReference: "REF-1",
+		OriginationDate:     "2024-05-01",
+		OriginationTime:     "12-30-00",
+		TimeReference:       44100 * 3600,
+		Version:             2,
+		LoudnessValue:       -2300,
+		MaxTruePeakLevel:    -100,
+		CodingHistory:       "A=PCM,F=44100,W=16,M=stereo\r\n",
+	}
+	bext.UMID[0] = 0x06
+	return &Metadata{
+		Info: map[string]string{
+			"INAM": "Title",
+			"IART": "Artist",
+			"ICMT": "An odd comment",
+		},
+		Broadcast: bext,
+		Cues: []Cue{
+			{ID: 1, Position: 10, Label: "Intro"},
+			{ID: 2, Position: 500, Label: "Chorus", Note: "loud"},
+			{ID: 3, Position: 700},
+		},
+		Sampler: &Sampler{
+			Manufacturer:  1,
+			SamplePeriod:  22675,
+			MIDIUnityNote: 60,
+			Loops: []SampleLoop{
+				{CuePointID: 2, Type: SampleLoopForward, Start: 500, End: 699, PlayCount: 3},
+			},
+		},
+	}
+}
+
+func TestMetadata_RoundTrip(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}
+	s, data := testtools.RandomDataStreamer(1000)
+	m := testMetadata()
+
+	var w writerseeker.WriterSeeker
+	assert.NoError(t, Encode(&w, s, format, WithMetadata(m)))
+
+	got, err := ReadMetadata(w.BytesReader())
+	assert.NoError(t, err)
+	assert.Equal(t, m, got)
+	assert.Equal(t, time.Hour, got.Broadcast.TimeOffset(format.SampleRate))
+
+	d, _, err := Decode(w.BytesReader())
+	assert.NoError(t, err)
+	if assert.Implements(t, (*MetadataStreamer)(nil), d) {
+		assert.Equal(t, m, d.(MetadataStreamer).Metadata())
+	}
+	assert.Equal(t, len(data), d.Len())
+	actual := testtools.Collect(d)
+	assert.InDelta(t, data[999][0], actual[999][0], 2.0/(1<<16))
+}
+
+func TestReadMetadata_AfterDataFromNonSeekableReader(t *testing.T) {
+	format := beep.Format{SampleRate: 44100, NumChannels: 1, Precision: 1}
+
+	var w writerseeker.WriterSeeker
+	assert.NoError(t, Encode(&w, beep.Silence(3), format))
+	encoded, err := io.ReadAll(w.Reader())
+	assert.NoError(t, err)
+
+	// Append a LIST/INFO chunk after the padded data chunk.
+	m := &Metadata{Info: map[string]string{"INAM": "After"}}
+	encoded = append(encoded, m.encode()...)
+
+	got, err := ReadMetadata(struct{ io.Reader }{bytes.NewReader(encoded)})
+	assert.NoError(t, err)
+	assert.Equal(t, m, got)
+}
+
+func TestReadMetadata_None(t *testing.T) {
+	var w writerseeker.WriterSeeker
+	assert.NoError(t, Encode(&w, beep.Silence(3), beep.Format{SampleRate: 44100, NumChannels: 2, Precision: 2}))
+
+	got, err := ReadMetadata(w.BytesReader())
+	assert.NoError(t, err)
+	assert.Equal(t, &Metadata{}, got)
+
+	d, _, err := Decode(w.BytesReader())
+	assert.NoError(t, err)
+	assert.Equal(t, &Metadata{}, d.(MetadataStreamer).Metadata())
+}
+
+func TestSampleLoop_LoopOptions(t *testing.T) {
+	s, data := testtools.RandomDataStreamer(10)
+	l := SampleLoop{Start: 2, End: 4, PlayCount: 2}
+
+	looped, err := beep.Loop2(s, l.LoopOptions()...)
+	assert.NoError(t, err)
+
+	var expected [][2]float64
+	expected = append(expected, data[:5]...)
+	expected = append(expected, data[2:]...)
+	testtools.AssertSamplesEqual(t, expected, testtools.Collect(looped))
+}